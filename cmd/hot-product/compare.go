@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"update_one_record/report"
+	"update_one_record/schema"
+)
+
+// runCompareCommand implements the compare subcommand: it loads two saved
+// run reports and prints their deltas, flagging metrics that got worse by
+// more than -threshold percent. A report is either a file written by
+// -output json or run:<id>, a row of the benchmark_runs table.
+func runCompareCommand(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	threshold := fs.Float64("threshold", 5, "Percent change in the wrong direction reported as a regression")
+	resultsDSN := fs.String("results-dsn", "", "DSN of the database holding benchmark_runs for run:<id> reports (default DB_DSN)")
+	driver := fs.String("driver", "mysql", "Database driver of -results-dsn: "+strings.Join(schema.DriverNames(), ", "))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] BASE NEW\n\nBASE and NEW are report JSON files or run:<id> rows of benchmark_runs.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 || !slices.Contains(schema.DriverNames(), *driver) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	loader := &reportLoader{driver: *driver, dsn: *resultsDSN}
+	defer loader.Close()
+	base, err := loader.load(fs.Arg(0))
+	if err != nil {
+		fatal("Failed to load report", "report", fs.Arg(0), "err", err)
+	}
+	next, err := loader.load(fs.Arg(1))
+	if err != nil {
+		fatal("Failed to load report", "report", fs.Arg(1), "err", err)
+	}
+
+	// Reports of a single run are compared with each other whatever their
+	// strategy; -compare reports are paired up by strategy.
+	if len(base) == 1 && len(next) == 1 {
+		report.PrintDiff(base[0], next[0], *threshold)
+		return
+	}
+	byStrategy := make(map[string]report.Report, len(next))
+	for _, r := range next {
+		byStrategy[r.Strategy] = r
+	}
+	for _, b := range base {
+		n, ok := byStrategy[b.Strategy]
+		if !ok {
+			fmt.Printf("=== %s: missing from %s\n\n", b.Strategy, fs.Arg(1))
+			continue
+		}
+		fmt.Printf("=== %s\n", b.Strategy)
+		report.PrintDiff(b, n, *threshold)
+		fmt.Println()
+	}
+}
+
+// runReportCommand implements the report subcommand: it prints the summary
+// of each saved report, a file written by -output json or run:<id>.
+func runReportCommand(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	resultsDSN := fs.String("results-dsn", "", "DSN of the database holding benchmark_runs for run:<id> reports (default DB_DSN)")
+	driver := fs.String("driver", "mysql", "Database driver of -results-dsn: "+strings.Join(schema.DriverNames(), ", "))
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s report [flags] REPORT...\n\nEach REPORT is a report JSON file or a run:<id> row of benchmark_runs.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 || !slices.Contains(schema.DriverNames(), *driver) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	loader := &reportLoader{driver: *driver, dsn: *resultsDSN}
+	defer loader.Close()
+	for _, ref := range fs.Args() {
+		reports, err := loader.load(ref)
+		if err != nil {
+			fatal("Failed to load report", "report", ref, "err", err)
+		}
+		for _, r := range reports {
+			report.Print(r)
+		}
+	}
+}
+
+// reportLoader reads reports from files and from the benchmark_runs table,
+// opening the database on first use.
+type reportLoader struct {
+	driver string // -driver of dsn
+	dsn    string
+	db     *sql.DB
+}
+
+func (l *reportLoader) load(ref string) ([]report.Report, error) {
+	if id, ok := strings.CutPrefix(ref, "run:"); ok {
+		return l.loadRun(id)
+	}
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return nil, err
+	}
+	return report.Decode(data)
+}
+
+func (l *reportLoader) loadRun(id string) ([]report.Report, error) {
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid run id %q", id)
+	}
+	if l.db == nil {
+		dsn := l.dsn
+		if dsn == "" {
+			dsn = os.Getenv("DB_DSN")
+		}
+		if dsn == "" {
+			return nil, fmt.Errorf("neither -results-dsn nor DB_DSN is set")
+		}
+		db, err := sql.Open(schema.NewDialect(l.driver, schema.TiDB{}).DriverName(), dsn)
+		if err != nil {
+			return nil, err
+		}
+		l.db = db
+	}
+	var data []byte
+	if err := l.db.QueryRowContext(context.Background(), "SELECT report FROM benchmark_runs WHERE id = ?", id).Scan(&data); err != nil {
+		return nil, fmt.Errorf("query benchmark_runs: %w", err)
+	}
+	return report.Decode(data)
+}
+
+func (l *reportLoader) Close() error {
+	if l.db == nil {
+		return nil
+	}
+	return l.db.Close()
+}
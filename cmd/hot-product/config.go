@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"update_one_record/loadgen"
+)
+
+// applyConfigFile sets the flags of fs from the -config file at path, a
+// YAML, TOML or JSON document by its extension. Its keys are flag names, and
+// a section of them, such as tls or push, stands for the flags named after
+// it (tls-ca, push-job) or else its keys themselves. A list sets a
+// repeatable flag, such as session-var, once per element. The scenario key
+// takes a -scenario file or the scenario itself, as in the file.
+func applyConfigFile(fs *flag.FlagSet, cfg *loadgen.Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("unknown config format %q (want .yaml, .yml, .toml or .json)", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if scenario, ok := doc["scenario"]; ok {
+		if _, isFile := scenario.(string); !isFile {
+			delete(doc, "scenario")
+			if cfg.Scenario, err = inlineScenario(scenario); err != nil {
+				return fmt.Errorf("%s: scenario: %w", path, err)
+			}
+		}
+	}
+	if err := setFlags(fs, "", doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// setFlags sets a flag for every key of values, in order, with the keys of
+// section qualified by it where that names a flag.
+func setFlags(fs *flag.FlagSet, section string, values map[string]any) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		if section != "" && fs.Lookup(section+"-"+k) != nil {
+			name = section + "-" + k
+		}
+		switch v := values[k].(type) {
+		case map[string]any:
+			if err := setFlags(fs, k, v); err != nil {
+				return err
+			}
+			continue
+		case []any:
+			for _, e := range v {
+				if err := setFlag(fs, name, e); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := setFlag(fs, name, values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setFlag(fs *flag.FlagSet, name string, value any) error {
+	if name == "config" || fs.Lookup(name) == nil {
+		return fmt.Errorf("unknown flag %q", name)
+	}
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		// Whole numbers such as 1e7 must still parse as integers.
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int, int64, uint64, bool:
+		s = fmt.Sprint(v)
+	default:
+		return fmt.Errorf("flag %q: unsupported value %v", name, value)
+	}
+	if err := fs.Set(name, s); err != nil {
+		return fmt.Errorf("flag %q: %w", name, err)
+	}
+	return nil
+}
+
+// inlineScenario decodes a scenario written in the config file, going
+// through JSON so that it reads like a -scenario file.
+func inlineScenario(v any) (*loadgen.Scenario, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var s loadgen.Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
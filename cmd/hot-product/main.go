@@ -0,0 +1,325 @@
+// Command hot-product benchmarks strategies for selling a single hot product
+// under heavy concurrency. It parses the flags into a loadgen.Config and runs
+// it against the databases listed in DB_DSN. The init, run, verify and clean
+// commands split a run into its steps so that several load passes can share
+// one initialized stock, and serve sells it over HTTP; "hot-product compare"
+// diffs two saved reports and "hot-product report" prints them.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"update_one_record/loadgen"
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// initialStock is the default stock per product.
+const initialStock = 10000000
+
+// The exit statuses of the commands, besides 0 and the 2 of a usage error,
+// so that scripts can tell a slow run from lost updates without reading the
+// log.
+const (
+	// exitThresholdViolated is the exit status of a run that returned
+	// ErrThresholdViolated.
+	exitThresholdViolated = 1
+	// exitInconsistent is the exit status of a run or verify that found
+	// inconsistent stock, ErrInconsistent.
+	exitInconsistent = 3
+	// exitFailed is the exit status of a command that could not run or
+	// failed before it could be verified, and of invalid configuration.
+	exitFailed = 4
+)
+
+func main() {
+	cmd, args := "", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "compare":
+		runCompareCommand(args)
+		return
+	case "report":
+		runReportCommand(args)
+		return
+	case "", "init", "run", "serve", "agent", "coordinate", "verify", "clean":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", cmd, commandsUsage)
+		os.Exit(2)
+	}
+	cfg, initOnly := parseConfig(cmd, args)
+	if initOnly {
+		// -init-only stops a run or coordinate after its first step.
+		switch cmd {
+		case "", "coordinate":
+			cmd = "init"
+		default:
+			fatal("-init-only only applies without a command or to coordinate; use init", "command", cmd)
+		}
+	}
+
+	// SIGINT or SIGTERM stops the command gracefully: a run stops issuing
+	// purchases, lets those under way finish and still verifies and reports
+	// them. A second signal kills the process.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	var err error
+	switch cmd {
+	case "init":
+		err = loadgen.Init(ctx, cfg)
+	case "verify":
+		_, err = loadgen.Verify(ctx, cfg)
+	case "clean":
+		err = loadgen.Clean(ctx, cfg)
+	case "serve":
+		err = loadgen.Serve(ctx, cfg)
+	case "agent":
+		err = loadgen.Agent(ctx, cfg)
+	case "coordinate":
+		_, err = loadgen.Coordinate(ctx, cfg)
+	default:
+		// Without a command the run initializes the stock itself, as
+		// before the subcommands existed, unless -skip-init; "run" reuses
+		// the stock of init.
+		cfg.SkipInit = cfg.SkipInit || cmd == "run"
+		if cfg.Compare {
+			_, err = loadgen.Compare(ctx, cfg)
+		} else {
+			_, err = loadgen.Run(ctx, cfg)
+		}
+	}
+	switch {
+	case errors.Is(err, loadgen.ErrInconsistent):
+		os.Exit(exitInconsistent)
+	case errors.Is(err, loadgen.ErrThresholdViolated):
+		os.Exit(exitThresholdViolated)
+	case err != nil:
+		fatal("Command failed", "command", cmd, "err", err)
+	}
+}
+
+// commandsUsage lists the commands in the usage message.
+const commandsUsage = `Commands:
+  init        Initialize the schema and stock
+  run         Run a load pass against the stock left by init or an earlier run
+  serve       Sell the stock left by init over HTTP (POST /buy/{productID}) and gRPC,
+              and start, follow and abort runs through /runs
+  agent       Run the shards a coordinator sends to -listen against DB_DSN
+  coordinate  Run a load pass over the -agents and verify it
+  verify      Check the stock left by earlier runs for consistency
+  clean       Drop the benchmark tables
+  compare     Diff two saved reports
+  report      Print saved reports
+
+Without a command, hot-product initializes the stock, runs a load pass and
+verifies it; coordinate does the same over agents. Either drops and
+recreates the tables only without -skip-init, and stops there with
+-init-only.
+
+Exit status: 0 on success, 1 if a threshold was violated, 2 on a usage
+error, 3 if the stock was found inconsistent and 4 if the command failed.
+
+`
+
+// parseConfig parses the flags of command name, shared by every command but
+// compare and report, into a Config, and sets up logging and profiling. It
+// also reports whether -init-only was given.
+func parseConfig(name string, args []string) (loadgen.Config, bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [command] [flags]\n\n%sFlags:\n", os.Args[0], commandsUsage)
+		fs.PrintDefaults()
+	}
+
+	var cfg loadgen.Config
+	fs.IntVar(&cfg.Concurrency, "concurrency", 100, "Number of concurrent purchase workers")
+	fs.IntVar(&cfg.BatchSize, "batchsize", 10, "Number of purchases per worker, though each of the run's purchases goes to whichever worker is free")
+	fs.Float64Var(&cfg.TargetQPS, "target-qps", 0, "Purchases per second to offer over all workers together, 0 to run flat out")
+	fs.Float64Var(&cfg.ArrivalRate, "arrival-rate", 0, "Open loop: purchases per second arriving as a Poisson process, queued to the workers and timed from arrival")
+	fs.Var(&cfg.SaleOpen, "sale-open", "Hold all workers until a flash sale opens, a delay (10s) or an RFC 3339 time, then release them at once")
+	fs.DurationVar(&cfg.SaleJitter, "sale-jitter", 0, "Random delay of up to this much per worker after -sale-open")
+	fs.Float64Var(&cfg.ReadRatio, "read-ratio", 0, "Fraction of worker operations that read a product's stock instead of purchasing, e.g. 0.9")
+	fs.IntVar(&cfg.Users, "users", 0, "Simulated users buying at random, each allowed one unit of every product, enforced by a unique key in an orders table")
+	fs.BoolVar(&cfg.RecordOrders, "orders", false, "Record every successful purchase in the orders table within its transaction and check the orders against the stock taken (for-update, conditional, crdb, skip-locked, mutex, get-lock and serializer)")
+	fs.BoolVar(&cfg.Idempotency, "idempotency", false, "Give every purchase an idempotency key stored with its order (implies -orders) and retry ambiguous failures, such as a lost COMMIT, up to -max-retries times without selling twice")
+	fs.Float64Var(&cfg.CancelRatio, "cancel-ratio", 0, "Fraction of successful purchases cancelled later, their stock refunded in a second transaction, e.g. 0.05")
+	fs.DurationVar(&cfg.CancelAfter, "cancel-after", time.Second, "How long after a purchase its -cancel-ratio cancellation is applied")
+	fs.Var(&cfg.Restock, "restock", `Stock added to every product during the run, as +units@time since the start, e.g. "+5000@60s,+5000@120s"`)
+	fs.Int64Var(&cfg.Seed, "seed", 0, "Seed of the random products, quantities, users, pauses and jitter, to repeat a run's choices; 0 picks one")
+	fs.Var(&cfg.ThinkTime, "think-time", "Pause of each worker between purchases: fixed (200ms) or exponentially distributed around a mean (exp:200ms)")
+	fs.StringVar(&cfg.ScenarioFile, "scenario", "", "JSON file of phases (e.g. warm-up, spike, sustained, drain), each with its own concurrency, target QPS, distribution and duration")
+	fs.Var(&cfg.Ramp, "ramp", `Load schedule of level@duration steps, e.g. "100@30s,500@60s,1000@120s": target QPS with -target-qps, active workers otherwise`)
+	fs.DurationVar(&cfg.Duration, "duration", 0, "Run purchases for this long after the warm-up instead of -batchsize per worker, e.g. 5m")
+	fs.IntVar(&cfg.NumProducts, "products", 1, "Number of distinct products (rows) to simulate")
+	fs.Int64Var(&cfg.Stock, "stock", initialStock, "Initial stock per product")
+	fs.BoolVar(&cfg.SkipInit, "skip-init", false, "Run against the existing tables and the stock left in them instead of dropping and recreating them")
+	initOnly := fs.Bool("init-only", false, "Drop and recreate the tables with -products and -stock, then exit without a load pass (same as init)")
+	dryRun := fs.Bool("dry-run", false, "Print the schema statements and one purchase transaction of every strategy, with placeholders filled, then exit without touching the database")
+	cfg.Quantity = loadgen.QuantityRange{Min: 1, Max: 1}
+	fs.Var(&cfg.Quantity, "quantity", "Units per purchase: fixed (3) or an inclusive range (1-5)")
+	cfg.Distribution = loadgen.ProductDistribution{Kind: "uniform"}
+	fs.Var(&cfg.Distribution, "distribution", "How purchases pick products: uniform, zipfian:s (e.g. zipfian:1.1), hotspot:p (a fraction p on product 1) or hotspot:p:n (on products 1 to n)")
+	fs.StringVar(&cfg.Affinity, "affinity", "none", "Pin workers to products instead of drawing from -distribution: none, product (worker w buys product w) or range (a contiguous range per worker)")
+	fs.Float64Var(&cfg.HotFraction, "hot-fraction", 0, "Fraction of purchases on the -hot-products hot set, the rest spread over the others as background load (same as -distribution hotspot:p:n)")
+	fs.IntVar(&cfg.HotProducts, "hot-products", 1, "Products in the hot set of -hot-fraction")
+	fs.StringVar(&cfg.Strategy, "strategy", "for-update", "Purchase strategy: "+strings.Join(strategy.Names(), ", ")+", or list to print the strategies available, including those of -plugin")
+	var plugins []string
+	fs.Func("plugin", "Load a Go plugin (.so) that registers more strategies; may be repeated", func(s string) error {
+		plugins = append(plugins, s)
+		return nil
+	})
+	fs.DurationVar(&cfg.Thresholds.MaxP99, "max-p99", 0, "Fail the run if the p99 latency exceeds this")
+	fs.Float64Var(&cfg.Thresholds.MinTPS, "min-tps", 0, "Fail the run if the throughput is below this many purchases/s")
+	fs.Var(&cfg.Thresholds.MaxErrorRate, "max-error-rate", "Fail the run if the error rate exceeds this, e.g. 1% or 0.01")
+	fs.DurationVar(&cfg.Warmup, "warmup", 0, "Run purchases for this long before recording latencies and throughput")
+	fs.StringVar(&cfg.Driver, "driver", "mysql", "Database driver: mysql (MySQL, TiDB), postgres, cockroach, sqlite (DB_DSN defaults to "+schema.DefaultSQLiteDSN+"), vitess (VTGate) or none for strategies that need no SQL database, such as redis-only")
+	fs.StringVar(&cfg.Conn.TLSCA, "tls-ca", "", "PEM file of the CA that signed the server certificate (mysql driver)")
+	fs.StringVar(&cfg.Conn.TLSCert, "tls-cert", "", "PEM client certificate, with -tls-key (mysql driver)")
+	fs.StringVar(&cfg.Conn.TLSKey, "tls-key", "", "PEM client key, with -tls-cert (mysql driver)")
+	fs.StringVar(&cfg.Conn.TLSServerName, "tls-server-name", "", "Server name to verify the certificate against (default the DSN host; mysql driver)")
+	fs.BoolVar(&cfg.Conn.TLSSkipVerify, "tls-skip-verify", false, "Use TLS without verifying the server certificate (mysql driver)")
+	fs.DurationVar(&cfg.Conn.DialTimeout, "dial-timeout", 0, "Timeout for establishing connections (mysql driver)")
+	fs.DurationVar(&cfg.StmtTimeout, "stmt-timeout", 0, "Timeout of every BEGIN, query and statement, so lock-wait pile-ups fail as stmt_timeout errors instead of hanging until the server's lock wait timeout; 0 to disable")
+	fs.DurationVar(&cfg.TraceSlow, "trace-slow", 0, "Log the SQL, phase timings and error of every purchase slower than this, e.g. 100ms; 0 to disable")
+	fs.IntVar(&cfg.TraceSlowRate, "trace-slow-rate", 10, "Most slow purchases logged per second with -trace-slow; the rest are only counted")
+	fs.Var(&cfg.Conn.SessionVars, "session-var", "Session variable name=value set on every connection, repeatable; quote string values (mysql driver)")
+	fs.IntVar(&cfg.TopProducts, "top-products", 10, "Number of hottest products listed in the summary when -products > 1")
+	fs.BoolVar(&cfg.Compare, "compare", false, "Run every strategy in turn and print a comparison table")
+	fs.StringVar(&cfg.Output, "output", "text", "Summary format: text or json")
+	fs.StringVar(&cfg.OutputFile, "output-file", "", "File for -output json (default stdout)")
+	fs.DurationVar(&cfg.TickInterval, "tick", time.Second, "Interval of the live throughput log line, 0 to disable")
+	fs.StringVar(&cfg.CSVFile, "csv", "", "Write a per-second CSV time series (timestamp, tps, errors, p99) to this file")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", "", "OTLP/gRPC collector (host:port) to export purchase traces to; empty disables tracing")
+	fs.Float64Var(&cfg.TraceSampleRatio, "trace-sample", 1, "Fraction of purchases traced with -otlp-endpoint")
+	fs.StringVar(&cfg.HGRMFile, "hgrm", "", "Write the latency percentile distribution in HdrHistogram .hgrm format to this file")
+	fs.StringVar(&cfg.HDRLogFile, "hdr-log", "", "Write per-tick latency histograms as an HdrHistogram interval log (.hlog) to this file")
+	fs.BoolVar(&cfg.TUI, "tui", false, "Show a live terminal dashboard during the run")
+	fs.StringVar(&cfg.WebAddr, "web", "", "Serve a live web dashboard of throughput, latency, errors and remaining stock on this address (e.g. localhost:8090)")
+	fs.StringVar(&cfg.PushGateway, "pushgateway", "", "Prometheus Pushgateway URL to push run metrics to")
+	fs.DurationVar(&cfg.PushInterval, "push-interval", 10*time.Second, "Interval of periodic pushes with -pushgateway")
+	fs.StringVar(&cfg.PushJob, "push-job", "sell_single_hot_product", "Pushgateway job name")
+	fs.StringVar(&cfg.PushLabels, "push-labels", "", "Extra Pushgateway grouping labels as name=value,name=value")
+	fs.StringVar(&cfg.StatsdAddr, "statsd", "", "StatsD/DogStatsD address (host:port) to emit purchase metrics to")
+	fs.StringVar(&cfg.StatsdPrefix, "statsd-prefix", "hot_product.", "Prefix of the emitted StatsD metric names")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug (logs every failed purchase), info, warn or error")
+	fs.StringVar(&cfg.LogFormat, "log-format", "text", "Log format: text or json")
+	fs.DurationVar(&cfg.LockSampleInterval, "lock-sample", 0, "Sample server lock waits (innodb_trx or TiDB's CLUSTER_TIDB_TRX) at this interval, 0 to disable")
+	fs.StringVar(&cfg.ServeAddr, "listen", ":8080", "Address the serve command listens on for POST /buy/{productID}")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-listen", "", "Address the serve command also serves the gRPC InventoryService (Buy, GetStock, Restock) on, empty to disable")
+	fs.Func("agents", "Comma-separated host:port addresses of the agents the coordinate command spreads the workers over", func(s string) error {
+		cfg.Agents = strings.Split(s, ",")
+		return nil
+	})
+	fs.StringVar(&cfg.PprofAddr, "pprof", "", "Serve net/http/pprof on this address (e.g. localhost:6060) to profile the load generator")
+	fs.BoolVar(&cfg.SaveResults, "save-results", false, "Record each run in the benchmark_runs table")
+	fs.StringVar(&cfg.ResultsDSN, "results-dsn", "", "DSN of the -driver database holding benchmark_runs (default DB_DSN)")
+	fs.BoolVar(&cfg.NoWait, "nowait", false, "Use SELECT ... FOR UPDATE NOWAIT in the for-update strategy")
+	fs.DurationVar(&cfg.HoldTime, "hold-time", 0, "Sleep this long between SELECT ... FOR UPDATE and COMMIT in the for-update strategy, holding the row lock")
+	fs.StringVar(&cfg.TxnMode, "txn-mode", "", "TiDB transaction mode for every connection: optimistic or pessimistic")
+	fs.IntVar(&cfg.BrowseReaders, "browse-readers", 0, "Readers browsing the stock outside transactions alongside the purchases, 0 to disable")
+	fs.StringVar(&cfg.BrowseMode, "browse-mode", "leader", "How browse readers read: leader, stale (TiDB AS OF TIMESTAMP) or follower (TiDB follower read)")
+	fs.DurationVar(&cfg.BrowseStaleness, "browse-staleness", 5*time.Second, "How far in the past -browse-mode stale reads")
+	fs.BoolVar(&cfg.Failover, "failover", false, "Keep purchasing through a failover of the primary, reconnecting, and report downtime and lost or double-sold stock")
+	fs.DurationVar(&cfg.FailoverTimeout, "failover-timeout", 2*time.Minute, "How long -failover workers keep reconnecting without a successful purchase, 0 for no limit")
+	fs.StringVar(&cfg.Vitess.Vindex, "vitess-vindex", "", "Shard the products table by this primary vindex on id with -driver vitess, e.g. hash or xxhash (default the keyspace's VSchema)")
+	fs.StringVar(&cfg.Vitess.TxnMode, "vitess-txn-mode", "single", "VTGate transaction_mode with -driver vitess: single, multi or twopc")
+	fs.DurationVar(&cfg.Vitess.LockWaitTimeout, "vitess-lock-wait-timeout", 0, "innodb_lock_wait_timeout for FOR UPDATE with -driver vitess, which reserves a tablet connection per session (default the tablet's)")
+	fs.StringVar(&cfg.TiDBSchema.PrimaryKey, "tidb-pk", "", "TiDB primary key of the products table: clustered or nonclustered (default the server's)")
+	fs.IntVar(&cfg.TiDBSchema.ShardRowIDBits, "shard-row-id-bits", 0, "TiDB SHARD_ROW_ID_BITS of the products table, requires -tidb-pk nonclustered")
+	fs.IntVar(&cfg.TiDBSchema.PreSplitRegions, "pre-split-regions", 0, "TiDB PRE_SPLIT_REGIONS of the products table, requires -shard-row-id-bits or -auto-random")
+	fs.IntVar(&cfg.TiDBSchema.AutoRandomBits, "auto-random", 0, "Key the products table by a TiDB AUTO_RANDOM row ID with this many shard bits, looking products up by a unique key")
+	fs.IntVar(&cfg.MaxRetries, "max-retries", 10, "Maximum retries per purchase for retrying strategies and -retry-locks")
+	fs.BoolVar(&cfg.RetryLocks, "retry-locks", false, "Retry purchases failing with a MySQL deadlock (1213) or lock wait timeout (1205), or a TiDB write conflict, up to -max-retries times with backoff, requires -driver mysql")
+	fs.DurationVar(&cfg.BackoffBase, "backoff-base", time.Millisecond, "Initial retry backoff for retrying strategies and -retry-locks")
+	fs.DurationVar(&cfg.BackoffMax, "backoff-max", 100*time.Millisecond, "Maximum retry backoff for retrying strategies and -retry-locks")
+	fs.StringVar(&cfg.RedisAddr, "redis-addr", "localhost:6379", "Redis address for the redis strategy")
+	fs.StringVar(&cfg.DynamoDBTable, "dynamodb-table", "hot-products", "DynamoDB table for the dynamodb strategy, created if missing")
+	fs.StringVar(&cfg.DynamoDBEndpoint, "dynamodb-endpoint", "", "DynamoDB endpoint URL for the dynamodb strategy, e.g. http://localhost:8000 for DynamoDB Local (default AWS)")
+	fs.StringVar(&cfg.EtcdEndpoints, "etcd-endpoints", "127.0.0.1:2379", "Comma-separated etcd endpoints for the etcd strategy")
+	fs.StringVar(&cfg.PDAddrs, "pd-addrs", "127.0.0.1:2379", "Comma-separated PD addresses for the tikv strategy")
+	fs.IntVar(&cfg.Buckets, "buckets", 10, "Stock buckets per product for the buckets strategy")
+	fs.IntVar(&cfg.CartSize, "cart-size", 3, "Distinct products per order for the cart strategy")
+	fs.StringVar(&cfg.Queue, "queue", "chan", "Queue backend for the queue strategy: chan or kafka")
+	fs.IntVar(&cfg.QueueConsumers, "queue-consumers", 4, "Number of queue consumers (and Kafka partitions)")
+	fs.StringVar(&cfg.KafkaBrokers, "kafka-brokers", "localhost:9092", "Comma-separated Kafka brokers for -queue kafka")
+	fs.StringVar(&cfg.KafkaTopic, "kafka-topic", "hot-product-orders", "Kafka topic prefix for -queue kafka")
+	fs.DurationVar(&cfg.CoalesceWindow, "coalesce-window", 5*time.Millisecond, "Batching window for the coalesce strategy")
+	fs.DurationVar(&cfg.ReservationTTL, "reservation-ttl", 2*time.Second, "Reservation lifetime for the reserve strategy")
+	fs.Float64Var(&cfg.AbandonRate, "abandon-rate", 0.1, "Fraction of reservations never confirmed in the reserve strategy")
+	fs.Int64Var(&cfg.TokenQuota, "token-quota", 100, "Units claimed per transaction by each worker in the tokens strategy")
+	fs.DurationVar(&cfg.FoldInterval, "fold-interval", 100*time.Millisecond, "Ledger aggregation interval for the ledger strategy")
+	fs.DurationVar(&cfg.CompensateInterval, "compensate-interval", 200*time.Millisecond, "Compensation interval for the oversell strategy")
+	fs.DurationVar(&cfg.ReconcileInterval, "reconcile-interval", time.Second, "Cache reconciliation interval for the cache strategy")
+	configFile := fs.String("config", "", "YAML, TOML or JSON file of flag values, sections of them and an inline scenario; flags on the command line override it")
+	fs.Parse(args)
+	if *configFile != "" {
+		// The file goes beneath the command line, which is parsed again to
+		// override it.
+		if err := applyConfigFile(fs, &cfg, *configFile); err != nil {
+			fatal("Invalid config file", "err", err)
+		}
+		fs.Parse(args)
+	}
+
+	if err := loadgen.SetupLogging(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Invalid logging flags", "err", err)
+	}
+	if cfg.PprofAddr != "" {
+		servePprof(cfg.PprofAddr)
+	}
+	if err := loadPlugins(plugins); err != nil {
+		fatal("Failed to load plugin", "err", err)
+	}
+	if cfg.Strategy == "list" {
+		for _, name := range strategy.Names() {
+			fmt.Println(name)
+		}
+		os.Exit(0)
+	}
+	if *dryRun {
+		// Like the run itself, "run" keeps the tables of init.
+		cfg.SkipInit = cfg.SkipInit || name == "run"
+		if err := loadgen.DryRun(context.Background(), cfg); err != nil {
+			fatal("Dry run failed", "err", err)
+		}
+		os.Exit(0)
+	}
+
+	// DB_DSN may list several comma-separated DSNs, see Endpoint, and
+	// DB_READER_DSN replicas for the browse readers.
+	if dsns := os.Getenv("DB_DSN"); dsns != "" {
+		cfg.DSNs = loadgen.SplitDSNs(dsns)
+	} else if cfg.Driver != "sqlite" && cfg.Driver != "none" {
+		fatal("DB_DSN env var is not set")
+	}
+	if readers := os.Getenv("DB_READER_DSN"); readers != "" {
+		cfg.ReaderDSNs = loadgen.SplitDSNs(readers)
+	}
+	if cfg.SkipInit && *initOnly {
+		fatal("-skip-init and -init-only cannot be combined")
+	}
+
+	return cfg, *initOnly
+}
+
+// fatal logs msg at error level and exits with exitFailed, like log.Fatal.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(exitFailed)
+}
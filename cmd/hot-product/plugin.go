@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"plugin"
+)
+
+// loadPlugins opens the Go plugins at paths, whose init functions register
+// their strategies with strategy.Register. A plugin must be built with
+// go build -buildmode=plugin by the same toolchain, against the same
+// versions of the packages it shares with this command.
+func loadPlugins(paths []string) error {
+	for _, path := range paths {
+		if _, err := plugin.Open(path); err != nil {
+			return fmt.Errorf("load plugin %s: %w", path, err)
+		}
+		slog.Debug("Loaded plugin", "path", path)
+	}
+	return nil
+}
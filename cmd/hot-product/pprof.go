@@ -0,0 +1,22 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+	"runtime"
+)
+
+// servePprof serves net/http/pprof on addr in the background, with mutex and
+// block profiling enabled so contention inside the load generator itself
+// (the rand lock, the stats mutexes, the connection pool) shows up.
+func servePprof(addr string) {
+	runtime.SetMutexProfileFraction(5)
+	runtime.SetBlockProfileRate(int(1e6)) // one sample per millisecond blocked
+	go func() {
+		slog.Info("Serving pprof", "url", "http://"+addr+"/debug/pprof/")
+		if err := http.ListenAndServe(addr, nil); err != nil {
+			slog.Error("Failed to serve pprof", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,105 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName is the full gRPC name of InventoryService.
+const ServiceName = "hotproduct.inventory.v1.InventoryService"
+
+// codecName is the content subtype of the JSON messages.
+const codecName = "json"
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// jsonCodec marshals the messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return codecName }
+
+// Register registers s as InventoryService on gs.
+func Register(gs *grpc.Server, s *Server) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+// serviceDesc is what protoc-gen-go-grpc would generate for the service.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*service)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Buy", Handler: unaryHandler("Buy", (*Server).Buy)},
+		{MethodName: "GetStock", Handler: unaryHandler("GetStock", (*Server).GetStock)},
+		{MethodName: "Restock", Handler: unaryHandler("Restock", (*Server).Restock)},
+	},
+}
+
+// service is the interface Server implements, which RegisterService checks.
+type service interface {
+	Buy(context.Context, *BuyRequest) (*BuyResponse, error)
+	GetStock(context.Context, *GetStockRequest) (*GetStockResponse, error)
+	Restock(context.Context, *RestockRequest) (*RestockResponse, error)
+}
+
+// unaryHandler adapts a method of Server to a grpc.MethodDesc handler.
+func unaryHandler[Req, Resp any](method string, call func(*Server, context.Context, *Req) (*Resp, error)) func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error) {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(srv.(*Server), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+			return call(srv.(*Server), ctx, req.(*Req))
+		})
+	}
+}
+
+// Client calls InventoryService.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client calling the service over cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) Buy(ctx context.Context, req *BuyRequest, opts ...grpc.CallOption) (*BuyResponse, error) {
+	resp := new(BuyResponse)
+	if err := c.invoke(ctx, "Buy", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) GetStock(ctx context.Context, req *GetStockRequest, opts ...grpc.CallOption) (*GetStockResponse, error) {
+	resp := new(GetStockResponse)
+	if err := c.invoke(ctx, "GetStock", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) Restock(ctx context.Context, req *RestockRequest, opts ...grpc.CallOption) (*RestockResponse, error) {
+	resp := new(RestockResponse)
+	if err := c.invoke(ctx, "Restock", req, resp, opts); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req, resp any, opts []grpc.CallOption) error {
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype(codecName)}, opts...)
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, opts...)
+}
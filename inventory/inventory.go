@@ -0,0 +1,153 @@
+// Package inventory is InventoryService, a gRPC service that buys, reads
+// and restocks products through a strategy.Strategy, for prototyping an
+// inventory microservice on the deduction logic of the strategies.
+//
+// The service needs no generated code: its messages are the Go structs of
+// this package, sent as JSON with the "json" gRPC codec that the package
+// registers. Client calls it from Go; other clients send
+// application/grpc+json requests to the methods of ServiceName.
+package inventory
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"update_one_record/strategy"
+)
+
+type BuyRequest struct {
+	ProductID int   `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+	UserID    int   `json:"user_id,omitempty"`
+}
+
+type BuyResponse struct {
+	ProductID int   `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+type GetStockRequest struct {
+	ProductID int `json:"product_id"`
+}
+
+type GetStockResponse struct {
+	ProductID int   `json:"product_id"`
+	Stock     int64 `json:"stock"`
+}
+
+type RestockRequest struct {
+	ProductID int   `json:"product_id"`
+	Units     int64 `json:"units"`
+}
+
+type RestockResponse struct {
+	ProductID int   `json:"product_id"`
+	Stock     int64 `json:"stock"`
+}
+
+// Server implements InventoryService over products 1 to NumProducts.
+//
+// Buy fails with codes.FailedPrecondition when the product is sold out,
+// codes.AlreadyExists when the user bought it already and codes.Unavailable
+// when the purchase failed otherwise. GetStock and Restock use
+// products.count, so they fail with codes.Unimplemented for strategies that
+// keep the stock elsewhere.
+type Server struct {
+	// Strategy sells the products.
+	Strategy strategy.Strategy
+
+	// Purchaser, if set, buys in place of Strategy, such as a
+	// strategy.ConflictRetrier around it.
+	Purchaser strategy.Strategy
+
+	DB          *sql.DB
+	NumProducts int
+}
+
+func (s *Server) Buy(ctx context.Context, req *BuyRequest) (*BuyResponse, error) {
+	if err := s.checkProduct(req.ProductID); err != nil {
+		return nil, err
+	}
+	if req.Quantity < 1 {
+		return nil, status.Error(codes.InvalidArgument, "quantity must be positive")
+	}
+	purchaser := s.Purchaser
+	if purchaser == nil {
+		purchaser = s.Strategy
+	}
+	order := strategy.Order{ProductID: req.ProductID, Quantity: req.Quantity, UserID: req.UserID}
+	switch err := purchaser.Purchase(ctx, s.DB, order); {
+	case err == nil:
+		return &BuyResponse{ProductID: req.ProductID, Quantity: req.Quantity}, nil
+	case errors.Is(err, strategy.ErrSoldOut):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, strategy.ErrAlreadyPurchased):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	default:
+		return nil, status.Error(codes.Unavailable, strategy.ErrorClass(err))
+	}
+}
+
+func (s *Server) GetStock(ctx context.Context, req *GetStockRequest) (*GetStockResponse, error) {
+	if err := s.checkProduct(req.ProductID); err != nil {
+		return nil, err
+	}
+	if err := s.checkStockInProducts(); err != nil {
+		return nil, err
+	}
+	stock, err := s.stock(ctx, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetStockResponse{ProductID: req.ProductID, Stock: stock}, nil
+}
+
+func (s *Server) Restock(ctx context.Context, req *RestockRequest) (*RestockResponse, error) {
+	if err := s.checkProduct(req.ProductID); err != nil {
+		return nil, err
+	}
+	if req.Units < 1 {
+		return nil, status.Error(codes.InvalidArgument, "units must be positive")
+	}
+	if err := s.checkStockInProducts(); err != nil {
+		return nil, err
+	}
+	if _, err := s.DB.ExecContext(ctx, "UPDATE products SET count = count + ?, version = version + 1 WHERE id = ?", req.Units, req.ProductID); err != nil {
+		return nil, status.Errorf(codes.Unavailable, "restock: %v", err)
+	}
+	stock, err := s.stock(ctx, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	return &RestockResponse{ProductID: req.ProductID, Stock: stock}, nil
+}
+
+func (s *Server) checkProduct(id int) error {
+	if id < 1 || id > s.NumProducts {
+		return status.Errorf(codes.NotFound, "product %d does not exist (want 1 to %d)", id, s.NumProducts)
+	}
+	return nil
+}
+
+// checkStockInProducts fails unless the strategy keeps its stock in
+// products.count.
+func (s *Server) checkStockInProducts() error {
+	_, counter := s.Strategy.(strategy.StockCounter)
+	_, sold := s.Strategy.(strategy.SoldCounter)
+	if counter || sold || s.DB == nil {
+		return status.Error(codes.Unimplemented, "the strategy does not keep its stock in products.count")
+	}
+	return nil
+}
+
+func (s *Server) stock(ctx context.Context, id int) (int64, error) {
+	var stock int64
+	if err := s.DB.QueryRowContext(ctx, "SELECT count FROM products WHERE id = ?", id).Scan(&stock); err != nil {
+		return 0, status.Errorf(codes.Unavailable, "query stock: %v", err)
+	}
+	return stock, nil
+}
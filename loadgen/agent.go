@@ -0,0 +1,109 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Agent runs the shards a coordinator posts to cfg.ServeAddr until ctx is
+// done, one at a time. POST /run takes the Config of a shard as JSON, runs
+// it against cfg's databases without initializing or verifying the stock,
+// and answers with its Result as JSON; a shard posted while another runs is
+// refused with 409. POST /stop interrupts the running shard, which then
+// answers with the purchases it completed.
+func Agent(ctx context.Context, cfg Config) error {
+	a := &agent{dsns: cfg.DSNs, readerDSNs: cfg.ReaderDSNs}
+	mux := http.NewServeMux()
+	mux.Handle("POST /run", a)
+	mux.HandleFunc("POST /stop", a.stop)
+	srv := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	ln, err := net.Listen("tcp", cfg.ServeAddr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Waiting for shards", "addr", ln.Addr().String())
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err := <-errc:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+	// A shard in flight sees ctx canceled and returns what it has.
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serveShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// agent serves POST /run and POST /stop.
+type agent struct {
+	dsns, readerDSNs []string
+	running          sync.Mutex
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // of the running shard, or nil
+}
+
+func (a *agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.running.TryLock() {
+		http.Error(w, "a shard is already running", http.StatusConflict)
+		return
+	}
+	defer a.running.Unlock()
+
+	var shard Config
+	if err := json.NewDecoder(r.Body).Decode(&shard); err != nil {
+		http.Error(w, fmt.Sprintf("decode shard: %v", err), http.StatusBadRequest)
+		return
+	}
+	// The coordinator's databases are reached through this agent's own
+	// DSNs; the stock is initialized and verified by the coordinator.
+	shard.DSNs, shard.ReaderDSNs = a.dsns, a.readerDSNs
+	shard.SkipInit = true
+	slog.Info("Running shard", "coordinator", r.RemoteAddr, "workers", shard.Concurrency, "strategy", shard.Strategy)
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	a.mu.Lock()
+	a.cancel = cancel
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.cancel = nil
+		a.mu.Unlock()
+	}()
+	result, err := runShard(ctx, shard)
+	if err != nil {
+		slog.Error("Shard failed", "err", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Shard finished", "succeeded", result.Succeeded, "failed", result.Failed, "elapsed", result.Elapsed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// stop serves POST /stop.
+func (a *agent) stop(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.cancel != nil {
+		slog.Info("Stopping shard", "coordinator", r.RemoteAddr)
+		a.cancel()
+	}
+}
+
+// runShard runs one shard in a session of its own.
+func runShard(ctx context.Context, cfg Config) (*Result, error) {
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close(context.WithoutCancel(ctx))
+	return run(ctx, s.endpoints, cfg)
+}
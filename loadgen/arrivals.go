@@ -0,0 +1,61 @@
+package loadgen
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// arrivalBacklog is how many arrivals may wait for a worker before the
+// generator falls behind. It does not skew the latencies when it does, as
+// every arrival keeps the time it was scheduled for.
+const arrivalBacklog = 100000
+
+// OpenLoopSummary describes the arrivals of -arrival-rate. Latencies in an
+// open-loop run count from when a purchase arrived, so QueueWait, the time
+// it waited for a free worker, is part of them rather than hidden by
+// coordinated omission.
+type OpenLoopSummary struct {
+	Rate       float64 // arrivals per second
+	Arrivals   int64
+	MaxBacklog int
+	QueueWait  LatencySummary
+}
+
+// arrivalProcess schedules the jobs of -arrival-rate at exponentially
+// distributed intervals, a Poisson process, regardless of how fast the
+// workers complete them.
+type arrivalProcess struct {
+	rate float64
+	rng  *rand.Rand // used by the producer alone
+
+	arrivals   atomic.Int64
+	maxBacklog atomic.Int64
+	queueWait  Histogram
+}
+
+func newArrivalProcess(rate float64, rng *rand.Rand) *arrivalProcess {
+	return &arrivalProcess{rate: rate, rng: rng}
+}
+
+// after returns when the arrival following the one at at is due.
+func (a *arrivalProcess) after(at time.Time) time.Time {
+	return at.Add(time.Duration(a.rng.ExpFloat64() / a.rate * float64(time.Second)))
+}
+
+// issued accounts for an arrival sent to a queue now holding backlog jobs.
+func (a *arrivalProcess) issued(backlog int) {
+	a.arrivals.Add(1)
+	if int64(backlog) > a.maxBacklog.Load() {
+		a.maxBacklog.Store(int64(backlog))
+	}
+}
+
+func (a *arrivalProcess) summary() *OpenLoopSummary {
+	return &OpenLoopSummary{
+		Rate:       a.rate,
+		Arrivals:   a.arrivals.Load(),
+		MaxBacklog: int(a.maxBacklog.Load()),
+		QueueWait:  a.queueWait.Summary(),
+	}
+}
@@ -0,0 +1,148 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// BrowseSummary describes the stock reads of -browse-readers. Running the
+// same load with -browse-mode leader and then stale or follower shows how
+// much offloading the reads from the leader helps the purchases on the hot
+// row.
+type BrowseSummary struct {
+	Mode       string
+	Readers    int
+	Reads      int64
+	Failed     int64
+	Throughput float64 // reads per second
+	Latency    LatencySummary
+}
+
+// browser reads the stock of products outside any transaction, as a product
+// page would, alongside the purchases and picking products the way they do.
+// In leader mode the reads go to the region leaders like the purchases do;
+// stale reads them AS OF a past timestamp and follower sets
+// tidb_replica_read, both of which TiDB can serve from other replicas.
+type browser struct {
+	mode      string
+	staleness time.Duration
+	readers   int
+	products  *productPicker
+	seed      int64
+
+	reads   atomic.Int64
+	failed  atomic.Int64
+	latency Histogram
+	wg      sync.WaitGroup
+	start   time.Time
+	elapsed time.Duration
+}
+
+func newBrowser(cfg Config) (*browser, error) {
+	switch cfg.BrowseMode {
+	case "leader":
+	case "stale", "follower":
+		if cfg.Driver != "mysql" {
+			return nil, fmt.Errorf("browse mode %s requires TiDB (-driver mysql)", cfg.BrowseMode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown browse mode %q (want leader, stale or follower)", cfg.BrowseMode)
+	}
+	return &browser{mode: cfg.BrowseMode, staleness: cfg.BrowseStaleness, readers: cfg.BrowseReaders, products: newProductPicker(cfg.Distribution, cfg.NumProducts), seed: cfg.Seed}, nil
+}
+
+// query returns the stock read of b's mode.
+func (b *browser) query() string {
+	if b.mode == "stale" {
+		return fmt.Sprintf("SELECT count FROM products AS OF TIMESTAMP NOW(6) - INTERVAL %d MICROSECOND WHERE id = ?", b.staleness.Microseconds())
+	}
+	return "SELECT count FROM products WHERE id = ?"
+}
+
+// run starts the readers, which read until ctx is done. Each holds a
+// connection of its own for the whole run, spread over dbs round-robin.
+func (b *browser) run(ctx context.Context, dbs []*sql.DB) error {
+	conns := make([]*sql.Conn, b.readers)
+	for i := range conns {
+		conn, err := dbs[endpointIndex(i+1, len(dbs))].Conn(ctx)
+		if err == nil && b.mode == "follower" {
+			_, err = conn.ExecContext(ctx, "SET SESSION tidb_replica_read = 'follower'")
+		}
+		if err != nil {
+			for _, c := range conns[:i] {
+				c.Close()
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			return fmt.Errorf("open browse connection: %w", err)
+		}
+		conns[i] = conn
+	}
+
+	b.start = time.Now()
+	query := b.query()
+	for i, conn := range conns {
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer b.release(conn)
+			rng := newStream(b.seed, browseStream-i)
+			for ctx.Err() == nil {
+				var count int64
+				begin := time.Now()
+				err := conn.QueryRowContext(ctx, query, b.products.Pick(rng)).Scan(&count)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					b.failed.Add(1)
+					slog.Debug("Browse read failed", "err", err, "class", strategy.ErrorClass(err))
+					continue
+				}
+				b.reads.Add(1)
+				b.latency.Record(time.Since(begin))
+			}
+		}()
+	}
+	return nil
+}
+
+// release returns conn to the pool with the leader reads the workers expect.
+func (b *browser) release(conn *sql.Conn) {
+	if b.mode == "follower" {
+		if _, err := conn.ExecContext(context.Background(), "SET SESSION tidb_replica_read = 'leader'"); err != nil {
+			slog.Debug("Failed to reset browse connection", "err", err)
+			conn.Raw(func(any) error { return driver.ErrBadConn }) // discard it
+		}
+	}
+	conn.Close()
+}
+
+// wait waits for the readers to stop once their context is done.
+func (b *browser) wait() {
+	b.wg.Wait()
+	b.elapsed = time.Since(b.start)
+}
+
+func (b *browser) summary() *BrowseSummary {
+	s := &BrowseSummary{
+		Mode:    b.mode,
+		Readers: b.readers,
+		Reads:   b.reads.Load(),
+		Failed:  b.failed.Load(),
+		Latency: b.latency.Summary(),
+	}
+	if b.elapsed > 0 {
+		s.Throughput = float64(s.Reads) / b.elapsed.Seconds()
+	}
+	return s
+}
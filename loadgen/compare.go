@@ -0,0 +1,105 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"update_one_record/report"
+	"update_one_record/strategy"
+)
+
+// runComparison runs every registered strategy in turn, each against a
+// freshly initialized schema with the same configuration, and prints the
+// results side by side. Strategies that fail to run, for example because
+// their backing service is unreachable, are listed with their error. With
+// -output json the reports of all runs are written as one JSON array, and
+// output files such as -csv get the strategy name appended. It returns the
+// reports, and ErrThresholdViolated unless every strategy that ran passed
+// the thresholds, ErrInconsistent if any left inconsistent stock.
+func runComparison(ctx context.Context, endpoints []Endpoint, cfg Config, results *resultStore) ([]report.Report, error) {
+	type row struct {
+		name   string
+		result *Result
+		err    error
+	}
+	var rows []row
+	for _, name := range strategy.Names() {
+		slog.Info("=== Strategy " + name + " ===")
+		c := cfg
+		c.Strategy = name
+		c.CSVFile = strategyFile(cfg.CSVFile, name)
+		c.HGRMFile = strategyFile(cfg.HGRMFile, name)
+		c.HDRLogFile = strategyFile(cfg.HDRLogFile, name)
+		r, err := run(ctx, endpoints, c)
+		if err != nil {
+			slog.Error("Strategy failed", "strategy", name, "err", err)
+		} else if results != nil {
+			if err := results.save(context.WithoutCancel(ctx), c, r); err != nil {
+				slog.Error("Failed to save results", "strategy", name, "err", err)
+			}
+		}
+		rows = append(rows, row{name: name, result: r, err: err})
+		if ctx.Err() != nil {
+			// The strategies not yet run are left out of an interrupted
+			// comparison.
+			break
+		}
+	}
+
+	// Every strategy is held to the thresholds; strategies that could not
+	// run at all are reported but do not fail the comparison.
+	var err error
+	for _, r := range rows {
+		if r.err == nil && !checkThresholds(cfg, r.result) && err != ErrInconsistent {
+			err = thresholdError(r.result)
+		}
+	}
+	reports := make([]report.Report, 0, len(rows))
+	for _, r := range rows {
+		c := cfg
+		c.Strategy = r.name
+		reports = append(reports, newReport(c, r.result, r.err))
+	}
+	switch cfg.Output {
+	case "json":
+		if err := writeJSON(cfg.OutputFile, reports); err != nil {
+			return reports, fmt.Errorf("write report: %w", err)
+		}
+		return reports, err
+	case "":
+		return reports, err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STRATEGY\tTPS\tP99\tERRORS\tSOLD OUT\tCONSISTENT")
+	for _, r := range rows {
+		if r.err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\terror: %v\n", r.name, r.err)
+			continue
+		}
+		consistent := "yes"
+		if n := len(r.result.Oversold); n > 0 {
+			consistent = fmt.Sprintf("no (%d oversold)", n)
+		} else if !r.result.Consistent() {
+			consistent = fmt.Sprintf("no (%+d)", r.result.ActualStock-r.result.ExpectedStock)
+		}
+		fmt.Fprintf(w, "%s\t%.1f\t%v\t%.2f%%\t%d\t%s\n", r.name, r.result.Throughput(), r.result.Latency.P99, r.result.ErrorRate()*100, r.result.SoldOut, consistent)
+	}
+	w.Flush()
+	return reports, err
+}
+
+// strategyFile returns path with the strategy name inserted before its
+// extension, or "" if path is empty.
+func strategyFile(path, strategy string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + strategy + ext
+}
@@ -0,0 +1,347 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// Config holds the options of a run, which the command line sets from its
+// flags.
+type Config struct {
+	strategy.Config
+
+	BatchSize int           `json:"batchsize"`
+	Quantity  QuantityRange `json:"quantity"`
+
+	// Duration, if set, runs the workers until it has passed after the
+	// warm-up instead of BatchSize purchases each.
+	Duration time.Duration `json:"duration,omitempty"`
+
+	// TargetQPS, if set, caps the purchases all workers together start per
+	// second, so that latency is measured at a fixed offered load.
+	TargetQPS float64 `json:"target_qps,omitempty"`
+
+	// ArrivalRate, if set, issues purchases as a Poisson process of this
+	// many per second whether or not the workers keep up, and times each
+	// from its arrival.
+	ArrivalRate float64 `json:"arrival_rate,omitempty"`
+
+	// SaleOpen, if set, holds every worker until the sale opens and then
+	// releases them together, each after up to SaleJitter.
+	SaleOpen   saleOpen      `json:"sale_open,omitempty"`
+	SaleJitter time.Duration `json:"sale_jitter,omitempty"`
+
+	// ReadRatio is the fraction of the workers' operations that read a
+	// product's stock instead of buying it.
+	ReadRatio float64 `json:"read_ratio,omitempty"`
+
+	// Users, if set, is a population of simulated buyers each allowed a
+	// single order of every product.
+	Users int `json:"users,omitempty"`
+
+	// CancelRatio is the fraction of successful purchases that are cancelled
+	// CancelAfter later, their units put back in a second transaction.
+	CancelRatio float64       `json:"cancel_ratio,omitempty"`
+	CancelAfter time.Duration `json:"cancel_after,omitempty"`
+
+	// Idempotency gives every purchase an idempotency key stored with its
+	// order, which implies RecordOrders, and retries the purchases that
+	// failed ambiguously without selling twice; see idempotentPurchaser.
+	Idempotency bool `json:"idempotency,omitempty"`
+
+	// Restock adds stock to every product at set times during the run.
+	Restock restockSchedule `json:"restock,omitempty"`
+
+	// SkipInit runs against the stock left by Init or an earlier run instead
+	// of initializing it afresh; the stock found at the start is the initial
+	// stock the run is verified against.
+	SkipInit bool `json:"skip_init,omitempty"`
+
+	// Seed makes the workers' random choices the same in every run with it;
+	// without -seed a run picks its own, which the report records.
+	Seed int64 `json:"seed"`
+
+	// ThinkTime is how long each worker, a buyer, pauses between purchases.
+	ThinkTime thinkTime `json:"think_time,omitempty"`
+
+	// Ramp steps the target QPS, or without TargetQPS the active workers,
+	// through its levels; the run lasts as long as the schedule.
+	Ramp rampSchedule `json:"ramp,omitempty"`
+
+	// Scenario, set directly, read from ScenarioFile or made from Ramp,
+	// runs the workers through its phases in turn; the run lasts as long as
+	// all of them.
+	Scenario     *Scenario `json:"scenario,omitempty"`
+	ScenarioFile string    `json:"-"`
+
+	// Affinity pins every worker to a product or a range of products, one of
+	// affinityModes, in place of Distribution.
+	Affinity string `json:"affinity,omitempty"`
+
+	// Distribution is how purchases pick the product they buy. HotFraction
+	// and HotProducts are the flags that set a hotspot distribution.
+	Distribution ProductDistribution `json:"distribution"`
+	HotFraction  float64             `json:"-"`
+	HotProducts  int                 `json:"-"`
+	Strategy     string              `json:"strategy"`
+
+	// DSNs are the databases the workers purchase from, see Endpoint, and
+	// ReaderDSNs optionally replicas for the browse readers. -driver sqlite
+	// defaults to DefaultSQLiteDSN.
+	DSNs       []string `json:"-"`
+	ReaderDSNs []string `json:"-"`
+
+	// Conn are connection settings applied to every DSN.
+	Conn ConnOptions `json:"conn"`
+
+	// StmtTimeout bounds every statement on the endpoints, see schema.OpenDB;
+	// 0 leaves them to the server's timeouts.
+	StmtTimeout time.Duration `json:"stmt_timeout,omitempty"`
+
+	// TraceSlow, if set, logs the statements, phase timings and error of
+	// every purchase slower than it, at most TraceSlowRate a second.
+	TraceSlow     time.Duration `json:"trace_slow,omitempty"`
+	TraceSlowRate int           `json:"trace_slow_rate,omitempty"`
+
+	// Thresholds fail the run with ErrThresholdViolated when broken.
+	Thresholds Thresholds `json:"thresholds"`
+
+	// Warmup is how long purchases run before statistics are recorded.
+	Warmup time.Duration `json:"warmup"`
+
+	// TopProducts is how many of the hottest products the summary lists.
+	TopProducts int `json:"top_products"`
+
+	// Compare runs every strategy in turn instead of just Strategy.
+	Compare bool `json:"compare"`
+
+	// Output selects the summary format ("text" or "json", or none if it is
+	// empty); JSON goes to OutputFile, or stdout if it is empty.
+	Output     string `json:"output"`
+	OutputFile string `json:"output_file"`
+
+	// TickInterval is how often live progress is logged; 0 disables it.
+	// CSVFile receives the same samples as CSV, every TickInterval or every
+	// second if ticking is disabled.
+	TickInterval time.Duration `json:"tick"`
+	CSVFile      string        `json:"csv"`
+
+	// HGRMFile receives the run's latency percentile distribution and
+	// HDRLogFile an HdrHistogram interval log with one histogram per tick.
+	HGRMFile   string `json:"hgrm"`
+	HDRLogFile string `json:"hdr_log"`
+
+	// TUI shows a live terminal dashboard instead of the progress log lines.
+	TUI bool `json:"tui"`
+
+	// WebAddr serves a live web dashboard of the run on this address.
+	WebAddr string `json:"web,omitempty"`
+
+	// OTLPEndpoint enables OpenTelemetry tracing of purchases, exported over
+	// OTLP/gRPC; TraceSampleRatio is the fraction of purchases traced.
+	OTLPEndpoint     string  `json:"otlp_endpoint"`
+	TraceSampleRatio float64 `json:"trace_sample_ratio"`
+
+	// PushGateway is the Prometheus Pushgateway URL the run's metrics are
+	// pushed to every PushInterval and at the end, grouped under PushJob and
+	// the comma-separated name=value PushLabels.
+	PushGateway  string        `json:"push_gateway"`
+	PushInterval time.Duration `json:"push_interval"`
+	PushJob      string        `json:"push_job"`
+	PushLabels   string        `json:"push_labels"`
+
+	// StatsdAddr is the StatsD/DogStatsD agent every purchase is reported to,
+	// with metric names prefixed by StatsdPrefix.
+	StatsdAddr   string `json:"statsd"`
+	StatsdPrefix string `json:"statsd_prefix"`
+
+	// LogLevel and LogFormat configure the slog output; debug logs every
+	// failed purchase.
+	LogLevel  string `json:"log_level"`
+	LogFormat string `json:"log_format"`
+
+	// LockSampleInterval is how often the server's lock waits are sampled
+	// from its transaction views; 0 disables sampling.
+	LockSampleInterval time.Duration `json:"lock_sample"`
+
+	// PprofAddr is where net/http/pprof is served during the run.
+	PprofAddr string `json:"pprof"`
+
+	// ServeAddr is where Serve listens for purchases and Agent for the
+	// shards of a coordinator.
+	ServeAddr string `json:"serve_addr,omitempty"`
+
+	// GRPCAddr, if set, is where Serve serves the gRPC InventoryService.
+	GRPCAddr string `json:"grpc_addr,omitempty"`
+
+	// Agents are the host:port addresses of the agents Coordinate
+	// distributes the workers over.
+	Agents []string `json:"agents,omitempty"`
+
+	// SaveResults records each run in the benchmark_runs table of the target
+	// database, or of ResultsDSN, a database of the same Driver, if it is set.
+	SaveResults bool   `json:"save_results"`
+	ResultsDSN  string `json:"-"`
+
+	// TxnMode sets tidb_txn_mode on every connection when not empty.
+	TxnMode string `json:"txn_mode"`
+
+	// RetryLocks retries the purchases that fail with a MySQL deadlock or
+	// lock wait timeout, or a TiDB write conflict, up to MaxRetries times
+	// with a backoff between BackoffBase and BackoffMax.
+	RetryLocks bool `json:"retry_locks"`
+
+	// BrowseReaders read the stock alongside the purchases in BrowseMode:
+	// "leader", "stale" (BrowseStaleness in the past) or "follower".
+	BrowseReaders   int           `json:"browse_readers"`
+	BrowseMode      string        `json:"browse_mode"`
+	BrowseStaleness time.Duration `json:"browse_staleness"`
+
+	// Failover keeps the workers purchasing through a failover of the
+	// primary, reconnecting for up to FailoverTimeout, and reports the
+	// outages and whether any stock was lost or sold twice across them.
+	Failover        bool          `json:"failover"`
+	FailoverTimeout time.Duration `json:"failover_timeout"`
+
+	// Vitess configures -driver vitess.
+	Vitess schema.VitessOptions `json:"vitess"`
+
+	// progress receives the tick samples of a run started through the
+	// control API of Serve.
+	progress func(tickSample)
+}
+
+// resolve checks cfg and fills in the options that other options imply.
+func (cfg *Config) resolve() error {
+	if !slices.Contains(strategy.Names(), cfg.Strategy) && !cfg.Compare {
+		return fmt.Errorf("unknown strategy %q (available: %s)", cfg.Strategy, strings.Join(strategy.Names(), ", "))
+	}
+	if cfg.Output != "" && cfg.Output != "text" && cfg.Output != "json" {
+		return fmt.Errorf("unknown output format %q (want text or json)", cfg.Output)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	if !slices.Contains(schema.DriverNames(), cfg.Driver) && cfg.Driver != "none" {
+		return fmt.Errorf("unknown driver %q (available: %s)", cfg.Driver, strings.Join(append(schema.DriverNames(), "none"), ", "))
+	}
+	if cfg.TxnMode != "" && cfg.Driver != "mysql" {
+		return errors.New("-txn-mode requires -driver mysql")
+	}
+	if cfg.RetryLocks && cfg.Driver != "mysql" {
+		return errors.New("-retry-locks requires -driver mysql")
+	}
+	if !cfg.Conn.isZero() && cfg.Driver != "mysql" && cfg.Driver != "vitess" {
+		return errors.New("TLS, dial timeout and session variable flags require -driver mysql or vitess")
+	}
+	if cfg.Driver == "vitess" {
+		if err := cfg.Vitess.Validate(); err != nil {
+			return fmt.Errorf("invalid Vitess options: %w", err)
+		}
+	}
+	if cfg.HotFraction != 0 {
+		if cfg.Distribution.Kind != "uniform" {
+			return errors.New("-hot-fraction cannot be combined with -distribution")
+		}
+		if cfg.HotFraction < 0 || cfg.HotFraction > 1 || cfg.HotProducts < 1 {
+			return errors.New("-hot-fraction must be between 0 and 1 and -hot-products at least 1")
+		}
+		cfg.Distribution = ProductDistribution{Kind: "hotspot", Param: cfg.HotFraction, Hot: cfg.HotProducts}
+	}
+	if cfg.Distribution.Kind == "hotspot" && cfg.Distribution.Hot >= cfg.NumProducts {
+		slog.Warn("The hot set covers every product; purchases are spread evenly", "hot_products", cfg.Distribution.Hot, "products", cfg.NumProducts)
+	}
+	if !slices.Contains(affinityModes, cfg.Affinity) {
+		return fmt.Errorf("unknown affinity %q (available: %s)", cfg.Affinity, strings.Join(affinityModes, ", "))
+	}
+	if cfg.Affinity != "none" && (cfg.Distribution.Kind != "uniform" || cfg.ScenarioFile != "" || cfg.Scenario != nil) {
+		return errors.New("-affinity picks the products itself; it cannot be combined with -distribution, -hot-fraction or -scenario")
+	}
+	if cfg.ReadRatio < 0 || cfg.ReadRatio >= 1 {
+		return fmt.Errorf("-read-ratio must be at least 0 and less than 1, not %v", cfg.ReadRatio)
+	}
+	if cfg.Users < 0 {
+		return fmt.Errorf("-users must not be negative, not %d", cfg.Users)
+	}
+	if cfg.Users > 0 && (cfg.Quantity != QuantityRange{Min: 1, Max: 1} || cfg.Strategy == "cart") {
+		return errors.New("-users allows one unit per user; it needs -quantity 1 and cannot run the cart strategy")
+	}
+	if cfg.CancelRatio < 0 || cfg.CancelRatio > 1 || cfg.CancelAfter < 0 {
+		return errors.New("-cancel-ratio must be between 0 and 1 and -cancel-after not negative")
+	}
+	if cfg.Idempotency {
+		cfg.RecordOrders = true
+	}
+	if cfg.RecordOrders && cfg.CancelRatio > 0 && cfg.Users == 0 {
+		return errors.New("-orders with -cancel-ratio needs -users to tell which order a cancellation deletes")
+	}
+	if (cfg.CancelRatio > 0 || len(cfg.Restock) > 0) && cfg.Failover {
+		return errors.New("-cancel-ratio and -restock cannot be combined with -failover")
+	}
+	if cfg.ArrivalRate < 0 {
+		return fmt.Errorf("-arrival-rate must not be negative, not %v", cfg.ArrivalRate)
+	}
+	if cfg.MaxRetries < 0 {
+		return fmt.Errorf("-max-retries must not be negative, not %d", cfg.MaxRetries)
+	}
+	if cfg.TraceSlow < 0 || cfg.TraceSlow > 0 && cfg.TraceSlowRate < 1 {
+		return errors.New("-trace-slow must not be negative and -trace-slow-rate must be at least 1")
+	}
+	if cfg.ArrivalRate > 0 && (cfg.TargetQPS > 0 || cfg.ThinkTime.Mean > 0 || len(cfg.Ramp) > 0 || cfg.ScenarioFile != "" || cfg.Scenario != nil) {
+		return errors.New("-arrival-rate sets the load itself; it cannot be combined with -target-qps, -think-time, -ramp or -scenario")
+	}
+	if len(cfg.Ramp) > 0 && (cfg.ScenarioFile != "" || cfg.Scenario != nil) {
+		return errors.New("-ramp and -scenario cannot be combined")
+	}
+	if len(cfg.Ramp) > 0 {
+		cfg.Scenario = cfg.Ramp.scenario(cfg.TargetQPS > 0)
+	}
+	if cfg.ScenarioFile != "" {
+		var err error
+		if cfg.Scenario, err = loadScenario(cfg.ScenarioFile); err != nil {
+			return fmt.Errorf("load scenario: %w", err)
+		}
+	}
+	if cfg.Scenario != nil {
+		if cfg.Duration > 0 {
+			return errors.New("-ramp and -scenario set how long the run lasts; they cannot be combined with -duration")
+		}
+		if err := cfg.Scenario.resolve(*cfg); err != nil {
+			return fmt.Errorf("invalid scenario: %w", err)
+		}
+		cfg.Duration = cfg.Scenario.duration()
+		cfg.Concurrency = cfg.Scenario.maxConcurrency()
+	}
+	if err := cfg.Conn.registerTLS(); err != nil {
+		return fmt.Errorf("invalid TLS flags: %w", err)
+	}
+	if cfg.TiDBSchema != (schema.TiDB{}) && cfg.Driver != "mysql" {
+		return errors.New("TiDB schema options require -driver mysql")
+	}
+	if err := cfg.TiDBSchema.Validate(); err != nil {
+		return fmt.Errorf("invalid TiDB schema options: %w", err)
+	}
+	if cfg.Driver == "none" {
+		if cfg.LockSampleInterval > 0 || cfg.BrowseReaders > 0 || cfg.ReadRatio > 0 || cfg.Users > 0 || cfg.CancelRatio > 0 || len(cfg.Restock) > 0 {
+			return errors.New("-lock-sample, -browse-readers, -read-ratio, -users, -cancel-ratio and -restock need a SQL database, not -driver none")
+		}
+		if cfg.SaveResults && cfg.ResultsDSN == "" {
+			return errors.New("-save-results with -driver none requires -results-dsn")
+		}
+		return nil
+	}
+	if len(cfg.DSNs) == 0 && cfg.Driver == "sqlite" {
+		cfg.DSNs = []string{schema.DefaultSQLiteDSN}
+	}
+	if len(cfg.DSNs) == 0 {
+		return errors.New("no DSN to connect to")
+	}
+	return nil
+}
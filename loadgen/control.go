@@ -0,0 +1,236 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"update_one_record/report"
+)
+
+// Run states of the control API.
+const (
+	runRunning  = "running"
+	runFinished = "finished"
+	runFailed   = "failed"
+	runAborted  = "aborted"
+)
+
+// runController serves the control API of Serve, through which benchmark
+// orchestration starts runs, follows them and aborts them, one at a time:
+//
+//	POST   /runs       start a run of the Config in the body, as JSON over
+//	                   the flags Serve was started with; 409 while one runs
+//	GET    /runs       the status of every run so far
+//	GET    /runs/{id}  the status of a run, with its live progress and, once
+//	                   it ended, its report
+//	DELETE /runs/{id}  abort a run, which still verifies and reports the
+//	                   purchases it made
+//
+// The runs buy from the same databases as the purchases served over HTTP,
+// and unless their Config has skip_init they initialize the stock afresh.
+type runController struct {
+	ctx  context.Context
+	base Config
+	wg   sync.WaitGroup
+
+	mu   sync.Mutex
+	runs []*controlledRun // by ID - 1
+}
+
+// controlledRun is a run started through the control API.
+type controlledRun struct {
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	status runStatus
+}
+
+// runStatus is the JSON status of a controlled run.
+type runStatus struct {
+	ID         int            `json:"id"`
+	State      string         `json:"state"`
+	Strategy   string         `json:"strategy"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Progress   *runProgress   `json:"progress,omitempty"`
+	Report     *report.Report `json:"report,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// runProgress is the latest tick sample of a controlled run.
+type runProgress struct {
+	ElapsedS  float64 `json:"elapsed_s"`
+	TPS       float64 `json:"tps"`
+	OKPct     float64 `json:"ok_pct"`
+	Errors    int64   `json:"errors"`
+	AvgMs     float64 `json:"avg_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	Completed int64   `json:"completed"`
+	Total     int64   `json:"total,omitempty"`
+	Progress  float64 `json:"progress"`
+	ETAS      float64 `json:"eta_s"`
+}
+
+// newRunController returns the controller of runs with the flags of base,
+// which it stops when ctx is done.
+func newRunController(ctx context.Context, base Config) *runController {
+	// Every run picks a seed and writes a summary of its own unless told to.
+	base.Seed, base.Output, base.OutputFile = 0, "", ""
+	return &runController{ctx: ctx, base: base}
+}
+
+// register adds the endpoints of the control API to mux.
+func (c *runController) register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /runs", c.start)
+	mux.HandleFunc("GET /runs", c.list)
+	mux.HandleFunc("GET /runs/{id}", c.get)
+	mux.HandleFunc("DELETE /runs/{id}", c.abort)
+}
+
+// wait waits for the runs still going, which ctx being done aborts.
+func (c *runController) wait() {
+	c.wg.Wait()
+}
+
+func (c *runController) start(w http.ResponseWriter, r *http.Request) {
+	cfg := c.base
+	if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+		http.Error(w, fmt.Sprintf("decode config: %v", err), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case cfg.Compare:
+		http.Error(w, "a comparison cannot be started through the control API", http.StatusBadRequest)
+		return
+	case len(cfg.Agents) > 0:
+		http.Error(w, "a coordinated run cannot be started through the control API", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	if n := len(c.runs); n > 0 && c.runs[n-1].snapshot().State == runRunning {
+		c.mu.Unlock()
+		http.Error(w, "a run is already running", http.StatusConflict)
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	run := &controlledRun{cancel: cancel, status: runStatus{ID: len(c.runs) + 1, State: runRunning, Strategy: cfg.Strategy, StartedAt: time.Now()}}
+	c.runs = append(c.runs, run)
+	c.mu.Unlock()
+
+	cfg.progress = run.setProgress
+	slog.Info("Starting run", "id", run.status.ID, "client", r.RemoteAddr, "strategy", cfg.Strategy, "workers", cfg.Concurrency)
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer cancel()
+		rep, err := Run(ctx, cfg)
+		run.finish(ctx, rep, err)
+	}()
+	writeStatus(w, http.StatusAccepted, run.snapshot())
+}
+
+func (c *runController) list(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	statuses := make([]runStatus, len(c.runs))
+	for i, run := range c.runs {
+		statuses[i] = run.snapshot()
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (c *runController) get(w http.ResponseWriter, r *http.Request) {
+	run := c.lookup(w, r)
+	if run == nil {
+		return
+	}
+	writeStatus(w, http.StatusOK, run.snapshot())
+}
+
+func (c *runController) abort(w http.ResponseWriter, r *http.Request) {
+	run := c.lookup(w, r)
+	if run == nil {
+		return
+	}
+	if run.snapshot().State != runRunning {
+		http.Error(w, "the run is not running", http.StatusConflict)
+		return
+	}
+	slog.Info("Aborting run", "id", run.snapshot().ID, "client", r.RemoteAddr)
+	run.cancel()
+	writeStatus(w, http.StatusAccepted, run.snapshot())
+}
+
+// lookup returns the run of the request's {id}, or answers 404 and returns
+// nil.
+func (c *runController) lookup(w http.ResponseWriter, r *http.Request) *controlledRun {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil || id < 1 || id > len(c.runs) {
+		http.Error(w, "no such run", http.StatusNotFound)
+		return nil
+	}
+	return c.runs[id-1]
+}
+
+// setProgress is the tick sink of the run.
+func (r *controlledRun) setProgress(s tickSample) {
+	p := &runProgress{
+		ElapsedS:  s.Uptime.Seconds(),
+		TPS:       s.TPS,
+		OKPct:     s.OKRate,
+		Errors:    s.Errors,
+		AvgMs:     millis(s.AvgLatency),
+		P99Ms:     millis(s.P99),
+		Completed: s.Completed,
+		Total:     s.Total,
+		Progress:  s.Progress(),
+		ETAS:      s.ETA.Seconds(),
+	}
+	r.mu.Lock()
+	r.status.Progress = p
+	r.mu.Unlock()
+}
+
+// finish records how the run ended. A run that broke its thresholds still
+// finished, with its report and the error.
+func (r *controlledRun) finish(ctx context.Context, rep *report.Report, err error) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status.FinishedAt, r.status.Report = &now, rep
+	switch {
+	case ctx.Err() != nil:
+		r.status.State = runAborted
+	case err != nil && !errors.Is(err, ErrThresholdViolated):
+		r.status.State = runFailed
+	default:
+		r.status.State = runFinished
+	}
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	slog.Info("Run ended", "id", r.status.ID, "state", r.status.State, "err", err)
+}
+
+func (r *controlledRun) snapshot() runStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+func writeStatus(w http.ResponseWriter, code int, s runStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(s)
+}
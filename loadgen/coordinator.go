@@ -0,0 +1,319 @@
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"update_one_record/report"
+	"update_one_record/strategy"
+)
+
+// Coordinate runs cfg from the agents of cfg.Agents, because a single
+// client cannot saturate a large cluster: it initializes the stock unless
+// cfg.SkipInit, splits the workers and the offered load into one shard per
+// agent, runs the shards at once and verifies the stock they leave in one
+// global check. The merged result is reported like a run of Run, with one
+// endpoint per agent. Its latency percentiles are the highest of any agent,
+// an upper bound, and the phases and optional summaries of the agents other
+// than users and refunds are left to their logs.
+func Coordinate(ctx context.Context, cfg Config) (*report.Report, error) {
+	switch {
+	case len(cfg.Agents) == 0:
+		return nil, errors.New("coordinate needs at least one agent")
+	case cfg.Compare:
+		return nil, errors.New("a comparison cannot be distributed over agents")
+	}
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close(context.WithoutCancel(ctx))
+	switch {
+	case cfg.Scenario != nil, len(cfg.Restock) > 0, cfg.Failover, cfg.Affinity != "none":
+		return nil, errors.New("-scenario, -ramp, -restock, -failover and -affinity cannot be distributed over agents")
+	case cfg.Concurrency < len(cfg.Agents):
+		return nil, fmt.Errorf("-concurrency %d leaves some of the %d agents without workers", cfg.Concurrency, len(cfg.Agents))
+	}
+
+	db := s.endpoints[0].DB
+	strat, err := strategy.New(cfg.Strategy, &cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := strat.(io.Closer); ok {
+		defer c.Close()
+	}
+	if _, standalone := strat.(strategy.Seeder); db == nil && !standalone {
+		return nil, fmt.Errorf("strategy %s needs a SQL database, it cannot run with -driver none", cfg.Strategy)
+	}
+	if err := checkRecordsOrders(cfg, strat); err != nil {
+		return nil, err
+	}
+	if !cfg.SkipInit {
+		if err := initStock(ctx, db, cfg, strat, cfg.Users > 0 || cfg.RecordOrders); err != nil {
+			return nil, err
+		}
+	}
+	initialTotalStock, err := totalStock(ctx, db, strat)
+	if err != nil {
+		return nil, fmt.Errorf("query initial total stock: %w", err)
+	}
+	// The agents count the orders of one another, so they are counted here.
+	var ordersBefore, orderedUnitsBefore int64
+	if cfg.RecordOrders {
+		if ordersBefore, orderedUnitsBefore, err = countOrders(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	shards := cfg.shards(len(cfg.Agents))
+	results := make([]*Result, len(shards))
+	errs := make([]error, len(shards))
+	slog.Info("Distributing shards", "agents", len(cfg.Agents), "workers", cfg.Concurrency, "strategy", cfg.Strategy, "total_stock", initialTotalStock)
+	// Once ctx is done the agents are stopped rather than abandoned, and
+	// the run is verified with the purchases they completed.
+	var wg sync.WaitGroup
+	for i, shard := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if results[i], errs[i] = postShard(context.WithoutCancel(ctx), cfg.Agents[i], shard); errs[i] != nil {
+				errs[i] = fmt.Errorf("agent %s: %w", cfg.Agents[i], errs[i])
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			slog.Warn("Run interrupted; stopping the agents")
+			for _, addr := range cfg.Agents {
+				if err := stopShard(addr); err != nil {
+					slog.Error("Failed to stop agent", "agent", addr, "err", err)
+				}
+			}
+		case <-done:
+		}
+	}()
+	wg.Wait()
+	close(done)
+	ctx = context.WithoutCancel(ctx)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	result := mergeResults(cfg, shards, results)
+	finalTotalStock, err := totalStock(ctx, db, strat)
+	if err != nil {
+		return nil, fmt.Errorf("query final total stock: %w", err)
+	}
+	// Every agent accounts for the stock it took from what it found at its
+	// start, which the other agents were already selling.
+	result.InitialStock, result.ActualStock = initialTotalStock, finalTotalStock
+	result.ExpectedStock = initialTotalStock
+	for _, r := range results {
+		result.ExpectedStock -= r.InitialStock - r.ExpectedStock
+	}
+	// What each agent sold of a product is not reported, so only products
+	// sold below zero are found.
+	if _, counter := strat.(strategy.StockCounter); db != nil && !counter {
+		if result.Oversold, err = oversoldProducts(ctx, db, cfg.NumProducts, nil, 0); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.RecordOrders {
+		orders, units, err := countOrders(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		result.Orders = &OrdersSummary{Orders: orders - ordersBefore, Units: units - orderedUnitsBefore, StockTaken: initialTotalStock - finalTotalStock}
+	}
+	return s.finish(ctx, cfg, result)
+}
+
+// shards splits cfg into n shards, one per agent, that share its workers,
+// target QPS, arrival rate and browse readers between them and draw from
+// seeds of their own. The shards write no local files and leave the
+// results, thresholds and output to the coordinator.
+func (cfg Config) shards(n int) []Config {
+	shards := make([]Config, n)
+	for i := range shards {
+		shard := cfg
+		shard.Concurrency = cfg.Concurrency / n
+		if i < cfg.Concurrency%n {
+			shard.Concurrency++
+		}
+		share := float64(shard.Concurrency) / float64(cfg.Concurrency)
+		shard.TargetQPS = cfg.TargetQPS * share
+		shard.ArrivalRate = cfg.ArrivalRate * share
+		shard.BrowseReaders = cfg.BrowseReaders / n
+		if i < cfg.BrowseReaders%n {
+			shard.BrowseReaders++
+		}
+		shard.Seed = cfg.Seed + int64(i)
+		shard.SkipInit = true
+		shard.Agents = nil
+		shard.Output, shard.OutputFile = "", ""
+		shard.CSVFile, shard.HGRMFile, shard.HDRLogFile = "", "", ""
+		shard.TUI, shard.SaveResults, shard.PprofAddr, shard.WebAddr = false, false, "", ""
+		shard.Thresholds = Thresholds{}
+		shards[i] = shard
+	}
+	return shards
+}
+
+// postShard runs shard on the agent at addr and returns its result.
+func postShard(ctx context.Context, addr string, shard Config) (*Result, error) {
+	body, err := json.Marshal(shard)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var r Result
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("decode result: %w", err)
+	}
+	return &r, nil
+}
+
+// stopShard interrupts the shard running on the agent at addr.
+func stopShard(addr string) error {
+	resp, err := http.Post("http://"+addr+"/stop", "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// mergeResults combines the results of the shards into one, leaving the
+// stock to the caller.
+func mergeResults(cfg Config, shards []Config, results []*Result) *Result {
+	m := &Result{Strategy: cfg.Strategy, Errors: map[string]int64{}}
+	products := map[int]*ProductResult{}
+	var workerTPS, workerFailed float64
+	for i, r := range results {
+		m.Interrupted = m.Interrupted || r.Interrupted
+		if i == 0 || r.StartedAt.Before(m.StartedAt) {
+			m.StartedAt = r.StartedAt
+		}
+		m.Elapsed = max(m.Elapsed, r.Elapsed)
+		m.Attempts += r.Attempts
+		m.Succeeded += r.Succeeded
+		m.SoldOut += r.SoldOut
+		m.Failed += r.Failed
+		m.Latency = maxLatency(m.Latency, r.Latency)
+		for class, n := range r.Errors {
+			m.Errors[class] += n
+		}
+		for _, p := range r.Products {
+			mp, ok := products[p.ID]
+			if !ok {
+				mp = &ProductResult{ID: p.ID}
+				products[p.ID] = mp
+			}
+			// AvgLatency holds the latency sum until it is divided below.
+			mp.AvgLatency += p.AvgLatency * time.Duration(p.Attempts)
+			mp.Attempts += p.Attempts
+			mp.Succeeded += p.Succeeded
+			mp.SoldOut += p.SoldOut
+		}
+
+		e := EndpointResult{Name: cfg.Agents[i], Workers: shards[i].Concurrency, Attempts: r.Attempts, Succeeded: r.Succeeded, Failed: r.Failed, Throughput: r.Throughput()}
+		for _, re := range r.Endpoints {
+			e.AvgLatency += re.AvgLatency * time.Duration(re.Attempts)
+		}
+		if r.Attempts > 0 {
+			e.AvgLatency /= time.Duration(r.Attempts)
+		}
+		m.Endpoints = append(m.Endpoints, e)
+
+		w := r.Workers
+		if i == 0 {
+			m.Workers = WorkerSummary{MinTPS: w.MinTPS, MaxTPS: w.MaxTPS, MinFailed: w.MinFailed, MaxFailed: w.MaxFailed}
+		}
+		m.Workers.MinTPS, m.Workers.MaxTPS = min(m.Workers.MinTPS, w.MinTPS), max(m.Workers.MaxTPS, w.MaxTPS)
+		m.Workers.MinFailed, m.Workers.MaxFailed = min(m.Workers.MinFailed, w.MinFailed), max(m.Workers.MaxFailed, w.MaxFailed)
+		workerTPS += w.AvgTPS * float64(shards[i].Concurrency)
+		workerFailed += w.AvgFailed * float64(shards[i].Concurrency)
+
+		m.Retries.Total += r.Retries.Total
+		m.Retries.Retried += r.Retries.Retried
+		m.Retries.Abandoned += r.Retries.Abandoned
+		for n, count := range r.Retries.PerSuccess {
+			for len(m.Retries.PerSuccess) <= n {
+				m.Retries.PerSuccess = append(m.Retries.PerSuccess, 0)
+			}
+			m.Retries.PerSuccess[n] += count
+		}
+
+		if u := r.Users; u != nil {
+			if m.Users == nil {
+				m.Users = &UsersSummary{Users: u.Users}
+			}
+			// Every agent counts the orders table as a whole when it ends.
+			m.Users.Buyers = max(m.Users.Buyers, u.Buyers)
+			m.Users.Orders = max(m.Users.Orders, u.Orders)
+			m.Users.OrderedUnits = max(m.Users.OrderedUnits, u.OrderedUnits)
+			m.Users.Rejected += u.Rejected
+		}
+		if f := r.Refunds; f != nil {
+			if m.Refunds == nil {
+				m.Refunds = &RefundSummary{Ratio: f.Ratio, After: f.After}
+			}
+			m.Refunds.Refunds += f.Refunds
+			m.Refunds.RefundedUnits += f.RefundedUnits
+			m.Refunds.Failed += f.Failed
+			m.Refunds.Latency = maxLatency(m.Refunds.Latency, f.Latency)
+		}
+	}
+	m.Workers.AvgTPS = workerTPS / float64(cfg.Concurrency)
+	m.Workers.AvgFailed = workerFailed / float64(cfg.Concurrency)
+
+	for _, p := range products {
+		if p.Attempts > 0 {
+			p.AvgLatency /= time.Duration(p.Attempts)
+		}
+		if m.Attempts > 0 {
+			p.Share = float64(p.Attempts) / float64(m.Attempts)
+		}
+		m.Products = append(m.Products, *p)
+	}
+	sort.Slice(m.Products, func(i, j int) bool {
+		if m.Products[i].Attempts != m.Products[j].Attempts {
+			return m.Products[i].Attempts > m.Products[j].Attempts
+		}
+		return m.Products[i].ID < m.Products[j].ID
+	})
+	return m
+}
+
+// maxLatency returns the higher of each percentile of a and b.
+func maxLatency(a, b LatencySummary) LatencySummary {
+	return LatencySummary{P50: max(a.P50, b.P50), P90: max(a.P90, b.P90), P95: max(a.P95, b.P95), P99: max(a.P99, b.P99), Max: max(a.Max, b.Max)}
+}
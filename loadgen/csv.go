@@ -0,0 +1,46 @@
+package loadgen
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+// csvSampler writes one row per tick sample to the -csv file.
+type csvSampler struct {
+	f *os.File
+	w *csv.Writer
+}
+
+func newCSVSampler(path string) (*csvSampler, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"timestamp", "tps", "errors", "p99_ms"}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &csvSampler{f: f, w: w}, nil
+}
+
+func (c *csvSampler) write(s tickSample) {
+	c.w.Write([]string{
+		s.Time.Format(time.RFC3339),
+		strconv.FormatFloat(s.TPS, 'f', 1, 64),
+		strconv.FormatInt(s.Errors, 10),
+		strconv.FormatFloat(millis(s.P99), 'f', 3, 64),
+	})
+	c.w.Flush()
+}
+
+func (c *csvSampler) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		c.f.Close()
+		return err
+	}
+	return c.f.Close()
+}
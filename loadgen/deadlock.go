@@ -0,0 +1,99 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"update_one_record/schema"
+)
+
+// tidbLatestDeadlockSQL lists the transactions of the most recent deadlock in
+// TiDB's deadlock history.
+const tidbLatestDeadlockSQL = `SELECT OCCUR_TIME, TRY_LOCK_TRX_ID, TRX_HOLDING_LOCK,
+	IFNULL(CURRENT_SQL_DIGEST_TEXT, ''), IFNULL(KEY_INFO, KEY)
+FROM information_schema.DEADLOCKS
+WHERE DEADLOCK_ID = (SELECT MAX(DEADLOCK_ID) FROM information_schema.DEADLOCKS)`
+
+// deadlockCapture fetches the server's report of the latest deadlock the
+// first time a purchase fails with a deadlock, once per run.
+type deadlockCapture struct {
+	db *sql.DB
+
+	once   sync.Once
+	report string
+}
+
+// observe captures the deadlock report if err is the run's first deadlock.
+func (c *deadlockCapture) observe(ctx context.Context, err error) {
+	if !schema.IsMySQLError(err, schema.MySQLDeadlock) {
+		return
+	}
+	c.once.Do(func() {
+		report, err := latestDeadlock(ctx, c.db)
+		if err != nil {
+			slog.Warn("Failed to capture deadlock report", "err", err)
+			return
+		}
+		c.report = report
+	})
+}
+
+// Report returns the captured report, or "" if no deadlock was seen. It must
+// not be called before the workers have finished.
+func (c *deadlockCapture) Report() string {
+	return c.report
+}
+
+// latestDeadlock returns the LATEST DETECTED DEADLOCK section of the InnoDB
+// status, or on TiDB the latest entry of its deadlock history.
+func latestDeadlock(ctx context.Context, db *sql.DB) (string, error) {
+	tidb, err := schema.IsTiDB(ctx, db)
+	if err != nil {
+		return "", err
+	}
+	if tidb {
+		return tidbLatestDeadlock(ctx, db)
+	}
+
+	var typ, name, status string
+	if err := db.QueryRowContext(ctx, "SHOW ENGINE INNODB STATUS").Scan(&typ, &name, &status); err != nil {
+		return "", fmt.Errorf("show engine innodb status: %w", err)
+	}
+	return innodbDeadlockSection(status), nil
+}
+
+// innodbDeadlockSection cuts the LATEST DETECTED DEADLOCK section out of an
+// InnoDB status dump.
+func innodbDeadlockSection(status string) string {
+	_, section, ok := strings.Cut(status, "LATEST DETECTED DEADLOCK\n")
+	if !ok {
+		return ""
+	}
+	section = strings.TrimLeft(section, "-\n")
+	if i := strings.Index(section, "\nTRANSACTIONS\n"); i >= 0 {
+		section = section[:i]
+	}
+	return strings.TrimRight(section, "-\n")
+}
+
+func tidbLatestDeadlock(ctx context.Context, db *sql.DB) (string, error) {
+	rows, err := db.QueryContext(ctx, tidbLatestDeadlockSQL)
+	if err != nil {
+		return "", fmt.Errorf("query deadlocks: %w", err)
+	}
+	defer rows.Close()
+
+	var b strings.Builder
+	for rows.Next() {
+		var occurred, waiter, holder, sqlText, key string
+		if err := rows.Scan(&occurred, &waiter, &holder, &sqlText, &key); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s: txn %s waited for txn %s on key %s\n  %s\n", occurred, waiter, holder, key, sqlText)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), rows.Err()
+}
@@ -0,0 +1,138 @@
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProductDistribution is the -distribution flag: how purchases pick their
+// product. "uniform" spreads them evenly, "zipfian:s" makes the k-th product
+// 1/k^s as popular as the first, and "hotspot:p" sends a fraction p of them
+// to product 1 and the rest evenly to the others; "hotspot:p:n" sends them
+// to a hot set of products 1 to n instead.
+type ProductDistribution struct {
+	Kind  string
+	Param float64
+	Hot   int // products in the hot set of hotspot
+}
+
+func (d *ProductDistribution) String() string {
+	if d.Kind == "" || d.Kind == "uniform" {
+		return "uniform"
+	}
+	s := d.Kind + ":" + strconv.FormatFloat(d.Param, 'g', -1, 64)
+	if d.Kind == "hotspot" && d.Hot > 1 {
+		s += ":" + strconv.Itoa(d.Hot)
+	}
+	return s
+}
+
+func (d *ProductDistribution) Set(s string) error {
+	kind, param, hasParam := strings.Cut(strings.TrimSpace(s), ":")
+	hot := 1
+	if kind == "hotspot" {
+		if p, n, ok := strings.Cut(param, ":"); ok {
+			h, err := strconv.Atoi(n)
+			if err != nil || h < 1 {
+				return fmt.Errorf("invalid hot set size %q", n)
+			}
+			param, hot = p, h
+		}
+	}
+	switch kind {
+	case "uniform":
+		if hasParam {
+			return fmt.Errorf("uniform distribution takes no parameter")
+		}
+		*d = ProductDistribution{Kind: kind}
+		return nil
+	case "zipfian", "hotspot":
+	default:
+		return fmt.Errorf("unknown distribution %q (want uniform, zipfian:s or hotspot:p)", s)
+	}
+	p, err := strconv.ParseFloat(param, 64)
+	if !hasParam || err != nil {
+		return fmt.Errorf("invalid distribution %q (want %s:number)", s, kind)
+	}
+	switch {
+	case kind == "zipfian" && p <= 0:
+		return fmt.Errorf("zipfian exponent must be positive, got %v", p)
+	case kind == "hotspot" && (p < 0 || p > 1):
+		return fmt.Errorf("hotspot fraction must be between 0 and 1, got %v", p)
+	}
+	*d = ProductDistribution{Kind: kind, Param: p, Hot: hot}
+	return nil
+}
+
+// MarshalText encodes the distribution the way it is written on the command
+// line.
+func (d ProductDistribution) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a distribution written by MarshalText.
+func (d *ProductDistribution) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// productPicker draws product IDs from 1 to n from a distribution. It is safe
+// for concurrent use with a random number generator per caller.
+type productPicker struct {
+	kind string
+	n    int
+	hot  float64   // hotspot: the share of the hot set
+	nHot int       // hotspot: products 1 to nHot are hot
+	cdf  []float64 // zipfian: cdf[k] is the chance of a product <= k+1
+}
+
+func newProductPicker(d ProductDistribution, n int) *productPicker {
+	p := &productPicker{kind: d.Kind, n: n, hot: d.Param, nHot: min(max(d.Hot, 1), n)}
+	if d.Kind == "zipfian" {
+		p.cdf = make([]float64, n)
+		var sum float64
+		for k := range p.cdf {
+			sum += 1 / math.Pow(float64(k+1), d.Param)
+			p.cdf[k] = sum
+		}
+		for k := range p.cdf {
+			p.cdf[k] /= sum
+		}
+	}
+	return p
+}
+
+// Pick returns the product of the next purchase.
+func (p *productPicker) Pick(rng *rand.Rand) int {
+	switch {
+	case p.kind == "zipfian":
+		return min(sort.SearchFloat64s(p.cdf, rng.Float64()), p.n-1) + 1
+	case p.kind == "hotspot" && p.n > p.nHot:
+		if rng.Float64() < p.hot {
+			return rng.Intn(p.nHot) + 1
+		}
+		return rng.Intn(p.n-p.nHot) + p.nHot + 1
+	default:
+		return rng.Intn(p.n) + 1
+	}
+}
+
+// affinityModes are the values of -affinity: "none" lets every worker draw
+// from the distribution, "product" pins worker w to product w, wrapping
+// around, and "range" gives each worker a contiguous range of products to
+// spread its purchases over, so that no two workers share a row as long as
+// there are at least as many products as workers.
+var affinityModes = []string{"none", "product", "range"}
+
+// affinityRange returns the products from lo to hi that worker workerID of
+// workers is pinned to under mode "product" or "range".
+func affinityRange(mode string, workerID, workers, n int) (lo, hi int) {
+	if mode == "product" || workers >= n {
+		p := (workerID-1)%n + 1
+		return p, p
+	}
+	return (workerID-1)*n/workers + 1, workerID * n / workers
+}
@@ -0,0 +1,125 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// dryRunTimeout bounds the setup, purchase and shutdown of each strategy in
+// a dry run, which give up rather than hang on services such as Redis that
+// are not there.
+const dryRunTimeout = 5 * time.Second
+
+// DryRun prints the SQL a run of cfg would execute to standard output,
+// without connecting to any database: the statements that create the
+// schema, unless cfg.SkipInit, then for cfg.Strategy, or every registered
+// strategy with cfg.Compare, those of its setup, of one purchase and of its
+// shutdown, with their placeholders filled in. The dry-run database answers
+// every query with 1s, so what strategies check of the stock on shutdown is
+// not reported, and strategies that keep their stock outside the SQL
+// database are only listed.
+func DryRun(ctx context.Context, cfg Config) error {
+	if len(cfg.DSNs) == 0 {
+		// No database is reached; resolve only needs one to be named.
+		cfg.DSNs = []string{"dry-run"}
+	}
+	if err := cfg.resolve(); err != nil {
+		return err
+	}
+	db, out := schema.OpenDryRun(os.Stdout)
+	defer db.Close()
+
+	fmt.Fprintf(out, "-- Schema (%s)\n", cfg.Driver)
+	if cfg.SkipInit {
+		fmt.Fprintln(out, "-- The tables are left as they are with -skip-init.")
+	} else {
+		if err := schema.Init(ctx, db, cfg.Dialect(), cfg.Vitess.Vindex, cfg.NumProducts, cfg.Stock); err != nil {
+			return err
+		}
+		if err := schema.CreateOrders(ctx, db, cfg.Dialect()); err != nil {
+			return err
+		}
+	}
+
+	order := strategy.Order{ProductID: 1, Quantity: cfg.Quantity.Min}
+	if cfg.Users > 0 {
+		order.UserID = 1
+	}
+	if cfg.Idempotency {
+		order.Key = uuid.NewString()
+	}
+	names := []string{cfg.Strategy}
+	if cfg.Compare {
+		names = strategy.Names()
+	}
+	for _, name := range names {
+		fmt.Fprintf(out, "\n-- Strategy %s\n", name)
+		c := cfg
+		c.Strategy = name
+		strat, err := strategy.New(name, &c.Config)
+		if err != nil {
+			return err
+		}
+		if _, ok := strat.(strategy.Seeder); ok {
+			fmt.Fprintln(out, "-- Keeps its stock outside the SQL database.")
+			continue
+		}
+		purchaser := strat
+		if cfg.Users > 0 {
+			purchaser = &userLimiter{Strategy: strat, users: cfg.Users, recorded: cfg.RecordOrders}
+		}
+		if err := dryRunStrategy(ctx, db, out, strat, purchaser, order, !cfg.SkipInit); err != nil {
+			fmt.Fprintf(out, "-- Failed: %v\n", err)
+		}
+	}
+	// Counts the repeats of the last statement, if any.
+	out.Write(nil)
+	return nil
+}
+
+// dryRunStrategy prints the setup of strat, with the tables of its own if
+// init, one purchase of order through purchaser, which wraps it, and its
+// shutdown against the dry-run db, giving up after dryRunTimeout even on
+// clients that do not heed ctx.
+func dryRunStrategy(ctx context.Context, db *sql.DB, out io.Writer, strat, purchaser strategy.Strategy, order strategy.Order, init bool) error {
+	ctx, cancel := context.WithTimeout(ctx, dryRunTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		if i, ok := strat.(strategy.Initializer); ok && init {
+			fmt.Fprintln(out, "-- Init")
+			if err := i.Init(ctx, db); err != nil {
+				done <- fmt.Errorf("init: %w", err)
+				return
+			}
+		}
+		if s, ok := strat.(strategy.Starter); ok {
+			fmt.Fprintln(out, "-- Setup")
+			if err := s.Start(ctx, db); err != nil {
+				done <- fmt.Errorf("start: %w", err)
+				return
+			}
+		}
+		fmt.Fprintln(out, "-- Purchase")
+		err := purchaser.Purchase(strategy.WithWorkerID(ctx, 1), db, order)
+		if s, ok := strat.(strategy.Stopper); ok {
+			fmt.Fprintln(out, "-- Shutdown")
+			s.Stop(ctx)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("gave up after %v: %w", dryRunTimeout, ctx.Err())
+	}
+}
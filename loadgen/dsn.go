@@ -0,0 +1,119 @@
+package loadgen
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// tlsConfigName is the name the -tls-* flags register their TLS config with
+// the mysql driver under.
+const tlsConfigName = "hot-product"
+
+// sessionVars is the repeatable -session-var flag: name=value pairs the
+// driver sets on every new connection.
+type sessionVars map[string]string
+
+func (v *sessionVars) String() string {
+	pairs := make([]string, 0, len(*v))
+	for name, value := range *v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v *sessionVars) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid session variable %q (want name=value)", s)
+	}
+	if *v == nil {
+		*v = make(sessionVars)
+	}
+	(*v)[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	return nil
+}
+
+// ConnOptions are the connection settings that can be given as flags
+// instead of being spelled out in every DB_DSN.
+type ConnOptions struct {
+	TLSCA         string `json:"tls_ca,omitempty"`
+	TLSCert       string `json:"tls_cert,omitempty"`
+	TLSKey        string `json:"tls_key,omitempty"`
+	TLSServerName string `json:"tls_server_name,omitempty"`
+	TLSSkipVerify bool   `json:"tls_skip_verify,omitempty"`
+
+	DialTimeout time.Duration `json:"dial_timeout,omitempty"`
+
+	// SessionVars are SQL literals, so string values must be quoted:
+	// -session-var "sql_mode='STRICT_ALL_TABLES'".
+	SessionVars sessionVars `json:"session_vars,omitempty"`
+}
+
+func (o ConnOptions) tls() bool {
+	return o.TLSCA != "" || o.TLSCert != "" || o.TLSKey != "" || o.TLSServerName != "" || o.TLSSkipVerify
+}
+
+// isZero reports whether no option is set.
+func (o ConnOptions) isZero() bool {
+	return !o.tls() && o.DialTimeout == 0 && len(o.SessionVars) == 0
+}
+
+// registerTLS registers the TLS config of the -tls-* flags with the mysql
+// driver, if any is set.
+func (o ConnOptions) registerTLS() error {
+	if !o.tls() {
+		return nil
+	}
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		return fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	c := &tls.Config{ServerName: o.TLSServerName, InsecureSkipVerify: o.TLSSkipVerify}
+	if o.TLSCA != "" {
+		pem, err := os.ReadFile(o.TLSCA)
+		if err != nil {
+			return fmt.Errorf("read CA: %w", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates in %s", o.TLSCA)
+		}
+	}
+	if o.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.TLSCert, o.TLSKey)
+		if err != nil {
+			return fmt.Errorf("load client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return mysql.RegisterTLSConfig(tlsConfigName, c)
+}
+
+// apply returns dsn with the options set; options override what dsn says.
+func (o ConnOptions) apply(dsn string) (string, error) {
+	if o.isZero() {
+		return dsn, nil
+	}
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	if o.tls() {
+		c.TLS, c.TLSConfig = nil, tlsConfigName
+	}
+	if o.DialTimeout > 0 {
+		c.Timeout = o.DialTimeout
+	}
+	if len(o.SessionVars) > 0 && c.Params == nil {
+		c.Params = make(map[string]string)
+	}
+	for name, value := range o.SessionVars {
+		c.Params[name] = value
+	}
+	return c.FormatDSN(), nil
+}
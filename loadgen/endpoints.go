@@ -0,0 +1,245 @@
+package loadgen
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"update_one_record/schema"
+)
+
+// Endpoint is one of the databases listed in DB_DSN, such as one of several
+// TiDB servers or ProxySQL instances in front of the same data. Workers are
+// spread over the endpoints round-robin; the first one also initializes the
+// schema and verifies the stock.
+//
+// Reader endpoints, listed in DB_READER_DSN, are replicas that only serve the
+// browse readers.
+type Endpoint struct {
+	Name   string // host of the DSN, for reporting
+	DB     *sql.DB
+	Reader bool
+}
+
+// SplitDSNs splits the comma-separated DSNs of DB_DSN. Commas inside quotes,
+// as in sql_mode='A,B', do not split.
+func SplitDSNs(s string) []string {
+	var dsns []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ',':
+			dsns = append(dsns, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(dsns, strings.TrimSpace(s[start:]))
+}
+
+// endpointName returns a name for the i-th DSN that does not leak its
+// credentials.
+func endpointName(driver, dsn string, i int) string {
+	if driver == "mysql" || driver == "vitess" {
+		if c, err := mysql.ParseDSN(dsn); err == nil && c.Addr != "" {
+			return c.Addr
+		}
+	} else if u, err := url.Parse(dsn); err == nil {
+		switch {
+		case u.Host != "":
+			return u.Host
+		case u.Opaque != "": // a SQLite file: URI
+			return u.Opaque
+		}
+	}
+	return fmt.Sprintf("endpoint-%d", i+1)
+}
+
+// openEndpoints opens and pings a pool for every writer and reader DSN, sized
+// for the workers and browse readers it serves, and exits if any of them
+// fails.
+func openEndpoints(cfg Config) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	open := func(dsn string, i, conns int, reader bool) error {
+		name := endpointName(cfg.Driver, dsn, i)
+		if cfg.Driver == "sqlite" {
+			dsn = schema.SQLiteDSN(dsn)
+		}
+		dsn, err := schema.TxnModeDSN(dsn, cfg.TxnMode)
+		if err == nil {
+			dsn, err = cfg.Conn.apply(dsn)
+		}
+		if err == nil && cfg.Driver == "vitess" {
+			dsn, err = schema.VitessDSN(dsn, cfg.Vitess)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid DSN of %s: %w", name, err)
+		}
+		db, err := schema.OpenDB(schema.NewDialect(cfg.Driver, cfg.TiDBSchema).DriverName(), dsn, cfg.StmtTimeout, cfg.TraceSlow > 0)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", name, err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return fmt.Errorf("ping %s: %w", name, err)
+		}
+		db.SetMaxOpenConns(max(conns, 1))
+		db.SetMaxIdleConns(max(conns, 1))
+		if cfg.Failover {
+			db.SetConnMaxLifetime(failoverConnLifetime)
+		}
+		endpoints = append(endpoints, Endpoint{Name: name, DB: db, Reader: reader})
+		return nil
+	}
+	fail := func(err error) ([]Endpoint, error) {
+		closeEndpoints(endpoints)
+		return nil, err
+	}
+
+	// Each pool fits the workers of its endpoint. The lock wait sampler holds
+	// a connection of its own on the first writer; browse readers, and the
+	// replica lag probe, on the readers, or the first writer if there are
+	// none.
+	dsns, readerDSNs := cfg.DSNs, cfg.ReaderDSNs
+	for i, dsn := range dsns {
+		conns := 0
+		for id := 1; id <= cfg.Concurrency; id++ {
+			if endpointIndex(id, len(dsns)) == i {
+				conns++
+			}
+		}
+		if i == 0 {
+			if cfg.LockSampleInterval > 0 {
+				conns++
+			}
+			if len(readerDSNs) == 0 {
+				conns += cfg.BrowseReaders
+			} else {
+				conns++ // the replica lag probe reads the primary
+			}
+		}
+		if err := open(dsn, i, conns, false); err != nil {
+			return fail(err)
+		}
+	}
+	for i, dsn := range readerDSNs {
+		conns := 0
+		for id := 1; id <= cfg.BrowseReaders; id++ {
+			if endpointIndex(id, len(readerDSNs)) == i {
+				conns++
+			}
+		}
+		if i == 0 {
+			conns++
+		}
+		if err := open(dsn, i, conns, true); err != nil {
+			return fail(err)
+		}
+	}
+
+	if len(endpoints) > 1 {
+		names := make([]string, len(endpoints))
+		for i, e := range endpoints {
+			names[i] = e.Name
+			if e.Reader {
+				names[i] += " (reader)"
+			}
+		}
+		slog.Info("Spreading load over endpoints", "endpoints", strings.Join(names, ", "))
+	}
+	return endpoints, nil
+}
+
+// closeEndpoints closes the pools of endpoints.
+func closeEndpoints(endpoints []Endpoint) {
+	for _, e := range endpoints {
+		if e.DB != nil {
+			e.DB.Close()
+		}
+	}
+}
+
+// splitEndpoints separates the writers, which take the purchases, from the
+// readers.
+func splitEndpoints(endpoints []Endpoint) (writers, readers []Endpoint) {
+	for _, e := range endpoints {
+		if e.Reader {
+			readers = append(readers, e)
+		} else {
+			writers = append(writers, e)
+		}
+	}
+	return writers, readers
+}
+
+// endpointIndex returns the endpoint that a worker sends its purchases to.
+func endpointIndex(workerID, numEndpoints int) int {
+	return (workerID - 1) % numEndpoints
+}
+
+// endpointStats counts the purchases sent to a single endpoint.
+type endpointStats struct {
+	attempts     atomic.Int64
+	succeeded    atomic.Int64
+	failed       atomic.Int64
+	latencyTotal atomic.Int64 // nanoseconds
+}
+
+// EndpointResult summarizes the purchases sent to one endpoint.
+type EndpointResult struct {
+	Name       string
+	Workers    int
+	Attempts   int64
+	Succeeded  int64
+	Failed     int64
+	Throughput float64 // successful purchases per second
+	AvgLatency time.Duration
+}
+
+// endpointResults summarizes every endpoint of a run that took elapsed.
+func (s *runStats) endpointResults(endpoints []Endpoint, elapsed time.Duration) []EndpointResult {
+	results := make([]EndpointResult, len(endpoints))
+	for i := range results {
+		e := &s.endpoints[i]
+		r := EndpointResult{
+			Name:      endpoints[i].Name,
+			Attempts:  e.attempts.Load(),
+			Succeeded: e.succeeded.Load(),
+			Failed:    e.failed.Load(),
+		}
+		if elapsed > 0 {
+			r.Throughput = float64(r.Succeeded) / elapsed.Seconds()
+		}
+		if r.Attempts > 0 {
+			r.AvgLatency = time.Duration(e.latencyTotal.Load() / r.Attempts)
+		}
+		results[i] = r
+	}
+	for id := 1; id <= len(s.workers); id++ {
+		results[endpointIndex(id, len(results))].Workers++
+	}
+	return results
+}
+
+// printEndpoints prints a table of the load each endpoint took.
+func printEndpoints(endpoints []EndpointResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENDPOINT\tWORKERS\tATTEMPTS\tOK\tFAILED\tTPS\tAVG LATENCY")
+	for _, e := range endpoints {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.1f\t%v\n", e.Name, e.Workers, e.Attempts, e.Succeeded, e.Failed, e.Throughput, e.AvgLatency.Round(time.Microsecond))
+	}
+	w.Flush()
+}
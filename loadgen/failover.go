@@ -0,0 +1,191 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+const (
+	// failoverConnLifetime caps how long -failover keeps a pooled connection,
+	// so that the pools let go of a demoted primary soon after a failover
+	// and dial the endpoint, and usually its DNS name, afresh.
+	failoverConnLifetime = time.Second
+
+	// failoverMergeWindow joins outages that are interrupted by a stray
+	// success, such as one worker reconnecting shortly before the others.
+	failoverMergeWindow = time.Second
+
+	// Workers wait between reconnect attempts for a jittered backoff between
+	// failoverBackoffBase and failoverBackoffMax.
+	failoverBackoffBase = 10 * time.Millisecond
+	failoverBackoffMax  = time.Second
+)
+
+// Outage is a stretch of a -failover run in which purchases failed because
+// the database was unreachable or read-only.
+type Outage struct {
+	Start    time.Time // the last success before the first error
+	End      time.Time // the first success after the last error, zero if none
+	Errors   int64
+	Downtime time.Duration // from Start to End, or to the end of the run
+
+	// ErrorSpike is how long the errors lasted, from the first to the last.
+	ErrorSpike time.Duration
+}
+
+// FailoverSummary describes how purchases fared through the outages of a
+// -failover run. Purchases that failed during an outage may still have
+// committed, so the units they asked for are ambiguous: the stock is
+// consistent if it reflects every confirmed unit and no more than the
+// confirmed and ambiguous ones together.
+type FailoverSummary struct {
+	Outages        []Outage
+	Downtime       time.Duration // summed over the outages
+	ErrorSpike     time.Duration
+	ConfirmedUnits int64
+	AmbiguousUnits int64
+
+	// LostUnits were confirmed to a buyer but are back in the stock, as when
+	// a failover promotes a replica that missed the latest commits.
+	LostUnits int64
+	// DoubleSoldUnits are gone from the stock beyond every unit that was
+	// confirmed or ambiguous, as when a retried purchase applied twice.
+	DoubleSoldUnits int64
+}
+
+// isFailoverError reports whether err is how a purchase fails while the
+// primary is down or being replaced.
+func isFailoverError(err error) bool {
+	switch strategy.ErrorClass(err) {
+	case "connection", "timeout", "read_only":
+		return true
+	}
+	return false
+}
+
+// failoverTracker follows the outages of a -failover run and the units sold
+// across them.
+type failoverTracker struct {
+	timeout time.Duration
+
+	confirmed   atomic.Int64
+	ambiguous   atomic.Int64
+	lastSuccess atomic.Int64 // unix nanoseconds
+	down        atomic.Bool
+
+	mu      sync.Mutex
+	outages []outage
+	current *outage
+}
+
+// outage is an Outage while it is being tracked.
+type outage struct {
+	Outage
+	firstErr time.Time
+}
+
+func newFailoverTracker(cfg Config, start time.Time) *failoverTracker {
+	t := &failoverTracker{timeout: cfg.FailoverTimeout}
+	t.lastSuccess.Store(start.UnixNano())
+	return t
+}
+
+// observe records the outcome of a purchase of order that ended at now.
+func (t *failoverTracker) observe(order strategy.Order, err error, now time.Time) {
+	switch {
+	case err == nil:
+		t.confirmed.Add(order.Quantity)
+		t.lastSuccess.Store(now.UnixNano())
+		if t.down.Load() {
+			t.mu.Lock()
+			if t.current != nil {
+				t.current.End = now
+				t.outages = append(t.outages, *t.current)
+				t.current = nil
+			}
+			t.down.Store(false)
+			t.mu.Unlock()
+		}
+	case isFailoverError(err):
+		t.ambiguous.Add(order.Quantity)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.current == nil {
+			if n := len(t.outages); n > 0 && now.Sub(t.outages[n-1].End) < failoverMergeWindow {
+				o := t.outages[n-1]
+				t.outages = t.outages[:n-1]
+				o.End = time.Time{}
+				t.current = &o
+			} else {
+				t.current = &outage{Outage: Outage{Start: time.Unix(0, t.lastSuccess.Load())}, firstErr: now}
+			}
+			t.down.Store(true)
+		}
+		t.current.Errors++
+		t.current.ErrorSpike = now.Sub(t.current.firstErr)
+	}
+}
+
+// reconnect decides whether a worker whose purchase failed with err should
+// wait and try again rather than move on, as it does until an outage has
+// lasted longer than -failover-timeout. attempt counts the worker's
+// consecutive failed attempts.
+func (t *failoverTracker) reconnect(ctx context.Context, err error, attempt *int) bool {
+	if !isFailoverError(err) {
+		*attempt = 0
+		return false
+	}
+	if since := time.Since(time.Unix(0, t.lastSuccess.Load())); t.timeout > 0 && since > t.timeout {
+		return false
+	}
+	*attempt++
+	return strategy.SleepContext(ctx, strategy.JitteredBackoff(ctx, failoverBackoffBase, failoverBackoffMax, *attempt)) == nil
+}
+
+// summary closes a running outage at end and compares the units sold with
+// what left the stock.
+func (t *failoverTracker) summary(end time.Time, initialStock, actualStock int64) *FailoverSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tracked := t.outages
+	if t.current != nil {
+		tracked = append(tracked, *t.current)
+	}
+	s := &FailoverSummary{
+		ConfirmedUnits: t.confirmed.Load(),
+		AmbiguousUnits: t.ambiguous.Load(),
+	}
+	for _, o := range tracked {
+		stop := o.End
+		if stop.IsZero() {
+			stop = end
+		}
+		o.Downtime = stop.Sub(o.Start)
+		s.Downtime += o.Downtime
+		s.ErrorSpike += o.ErrorSpike
+		s.Outages = append(s.Outages, o.Outage)
+	}
+
+	sold := initialStock - actualStock
+	s.LostUnits = max(s.ConfirmedUnits-sold, 0)
+	s.DoubleSoldUnits = max(sold-s.ConfirmedUnits-s.AmbiguousUnits, 0)
+	return s
+}
+
+// formatOutages renders each outage as "downtime (errors for spike, n errors)".
+func formatOutages(outages []Outage) string {
+	parts := make([]string, len(outages))
+	for i, o := range outages {
+		parts[i] = fmt.Sprintf("%v (errors for %v, %d errors)", o.Downtime.Round(time.Millisecond), o.ErrorSpike.Round(time.Millisecond), o.Errors)
+		if o.End.IsZero() {
+			parts[i] += " unresolved"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,126 @@
+package loadgen
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
+)
+
+// HdrHistogram range: microsecond values from 1µs to one hour with three
+// significant digits.
+const (
+	hdrLowest  = 1
+	hdrHighest = int64(time.Hour / time.Microsecond)
+	hdrDigits  = 3
+)
+
+// hdrRecorder keeps the run's latencies in HdrHistograms for -hgrm and
+// -hdr-log, which existing latency-analysis tooling can load without losing
+// tail fidelity.
+type hdrRecorder struct {
+	mu       sync.Mutex
+	total    *hdrhistogram.Histogram
+	interval *hdrhistogram.Histogram
+	start    time.Time
+
+	log     *hdrhistogram.HistogramLogWriter
+	logFile *os.File
+}
+
+// newHDRRecorder starts recording. If logPath is not empty, every tick
+// interval is appended to it as an HdrHistogram interval log.
+func newHDRRecorder(logPath string) (*hdrRecorder, error) {
+	r := &hdrRecorder{
+		total:    hdrhistogram.New(hdrLowest, hdrHighest, hdrDigits),
+		interval: hdrhistogram.New(hdrLowest, hdrHighest, hdrDigits),
+		start:    time.Now(),
+	}
+	r.interval.SetStartTimeMs(r.start.UnixMilli())
+	if logPath == "" {
+		return r, nil
+	}
+	f, err := os.Create(logPath)
+	if err != nil {
+		return nil, err
+	}
+	r.logFile = f
+	r.log = hdrhistogram.NewHistogramLogWriter(f)
+	r.log.SetBaseTime(r.start.UnixMilli())
+	for _, err := range []error{
+		r.log.OutputLogFormatVersion(),
+		r.log.OutputStartTime(r.start.UnixMilli()),
+		r.log.OutputComment("Purchase latency in microseconds"),
+		r.log.OutputLegend(),
+	} {
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *hdrRecorder) record(d time.Duration) {
+	us := min(max(int64(d/time.Microsecond), hdrLowest), hdrHighest)
+	r.mu.Lock()
+	r.total.RecordValue(us)
+	r.interval.RecordValue(us)
+	r.mu.Unlock()
+}
+
+// flushInterval writes the latencies since the previous call to the interval
+// log and starts a new interval.
+func (r *hdrRecorder) flushInterval(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.log == nil {
+		return nil
+	}
+	r.interval.SetEndTimeMs(now.UnixMilli())
+	err := r.log.OutputIntervalHistogram(r.interval)
+	r.interval.Reset()
+	r.interval.SetStartTimeMs(now.UnixMilli())
+	return err
+}
+
+// sample is the tick sink of the interval log.
+func (r *hdrRecorder) sample(s tickSample) {
+	if err := r.flushInterval(s.Time); err != nil {
+		slog.Error("Failed to write HdrHistogram interval", "err", err)
+	}
+}
+
+// Close writes the last interval and closes the interval log.
+func (r *hdrRecorder) Close() error {
+	if r.log == nil {
+		return nil
+	}
+	err := r.flushInterval(time.Now())
+	if cerr := r.logFile.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeHGRM writes the percentile distribution of the whole run to path in
+// the .hgrm format, with values in milliseconds.
+func (r *hdrRecorder) writeHGRM(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	_, err = r.total.PercentilesPrint(f, 5, 1000)
+	r.mu.Unlock()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
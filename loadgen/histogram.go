@@ -0,0 +1,147 @@
+package loadgen
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+const (
+	// histSubBuckets is the number of linear buckets per power of two; the
+	// recorded values keep a relative error of at most 1/histSubBuckets.
+	histSubBuckets = 64
+	histSubBits    = 6
+
+	// histBuckets covers microsecond values up to 2^63.
+	histBuckets = (64 - histSubBits + 1) * histSubBuckets
+)
+
+// Histogram is a log-linear latency histogram with microsecond resolution.
+// It is safe for concurrent use.
+type Histogram struct {
+	mu     sync.Mutex
+	counts [histBuckets]int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+// LatencySummary holds the percentiles reported for a histogram.
+type LatencySummary struct {
+	P50, P90, P95, P99, Max time.Duration
+}
+
+// histIndex returns the bucket of a value in microseconds.
+func histIndex(us uint64) int {
+	if us < histSubBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(us) - histSubBits - 1
+	return (exp+1)*histSubBuckets + int(us>>exp) - histSubBuckets
+}
+
+// histValue returns the upper bound, in microseconds, of bucket idx.
+func histValue(idx int) uint64 {
+	if idx < histSubBuckets {
+		return uint64(idx)
+	}
+	exp := idx/histSubBuckets - 1
+	sub := uint64(idx%histSubBuckets + histSubBuckets)
+	return (sub+1)<<exp - 1
+}
+
+// Record adds one observation.
+func (h *Histogram) Record(d time.Duration) {
+	h.RecordN(d, 1)
+}
+
+// RecordN adds n observations of the same value.
+func (h *Histogram) RecordN(d time.Duration, n int64) {
+	if n <= 0 {
+		return
+	}
+	us := uint64(max(d, 0) / time.Microsecond)
+	idx := histIndex(us)
+
+	h.mu.Lock()
+	h.counts[idx] += n
+	h.total += n
+	h.sum += d * time.Duration(n)
+	h.max = max(h.max, d)
+	h.mu.Unlock()
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Mean returns the average observation.
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// Percentile returns the value below which a fraction p (0 < p <= 1) of the
+// observations fall.
+func (h *Histogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.percentileLocked(p)
+}
+
+func (h *Histogram) percentileLocked(p float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(float64(h.total)*p + 0.5)
+	rank = max(1, min(rank, h.total))
+	var seen int64
+	for idx, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return min(time.Duration(histValue(idx))*time.Microsecond, h.max)
+		}
+	}
+	return h.max
+}
+
+// Summary returns the reported percentiles.
+func (h *Histogram) Summary() LatencySummary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return LatencySummary{
+		P50: h.percentileLocked(0.50),
+		P90: h.percentileLocked(0.90),
+		P95: h.percentileLocked(0.95),
+		P99: h.percentileLocked(0.99),
+		Max: h.max,
+	}
+}
+
+// Distribution counts the observations between consecutive bounds: element i
+// holds those below bounds[i] and at or above bounds[i-1], and the extra last
+// element those at or above the final bound.
+func (h *Histogram) Distribution(bounds []time.Duration) []int64 {
+	counts := make([]int64, len(bounds)+1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for idx, c := range h.counts {
+		if c == 0 {
+			continue
+		}
+		v := time.Duration(histValue(idx)) * time.Microsecond
+		for i < len(bounds) && v >= bounds[i] {
+			i++
+		}
+		counts[i] += c
+	}
+	return counts
+}
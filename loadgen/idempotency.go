@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"update_one_record/strategy"
+)
+
+// maxIdempotencyKeyLen is the length of the idempotency_key column, which a
+// UUID fills.
+const maxIdempotencyKeyLen = 36
+
+// IdempotencySummary describes the purchases of -idempotency whose outcome
+// an error left open.
+type IdempotencySummary struct {
+	Retries int64 // ambiguous failures retried with the same key
+
+	// DuplicatesPrevented were found applied by their key, after an error
+	// or when the orders table refused them, instead of selling twice.
+	DuplicatesPrevented int64
+}
+
+// isAmbiguousError reports whether a purchase that failed with err may have
+// committed all the same, as when the connection drops during COMMIT.
+func isAmbiguousError(err error) bool {
+	switch strategy.ErrorClass(err) {
+	case "connection", "timeout", "stmt_timeout":
+		return true
+	}
+	return false
+}
+
+// idempotentPurchaser gives every purchase a client-side idempotency key,
+// which the strategy stores with its order under a unique key, and retries
+// the purchases that failed ambiguously with the same key, up to maxRetries
+// times. Before each retry it looks the key up: a purchase whose order is
+// there was applied and succeeds without buying again, and a retry racing
+// an earlier attempt that still commits is refused by the unique key. That
+// makes an at-least-once client sell exactly once.
+type idempotentPurchaser struct {
+	strategy.Strategy
+	cfg Config
+
+	retries    atomic.Int64
+	duplicates atomic.Int64
+}
+
+func (p *idempotentPurchaser) Purchase(ctx context.Context, db *sql.DB, order strategy.Order) error {
+	if order.Key == "" {
+		order.Key = uuid.NewString()
+	}
+	for attempt := 0; ; attempt++ {
+		err := p.Strategy.Purchase(ctx, db, order)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, strategy.ErrAlreadyPurchased):
+			// The key's own order, or with -users the user's, refused it.
+		case !isAmbiguousError(err):
+			return err
+		}
+		// The lookup must run even if ctx was canceled mid-purchase.
+		applied, lookupErr := orderApplied(context.WithoutCancel(ctx), db, order.Key)
+		if lookupErr != nil {
+			return fmt.Errorf("%w (looking up its idempotency key failed: %v)", err, lookupErr)
+		}
+		if applied {
+			p.duplicates.Add(1)
+			return nil
+		}
+		if errors.Is(err, strategy.ErrAlreadyPurchased) {
+			return err
+		}
+		if attempt == p.cfg.MaxRetries {
+			return fmt.Errorf("%w: %w", strategy.ErrTooManyRetries, err)
+		}
+		p.retries.Add(1)
+		strategy.NoteRetry(ctx)
+		if err := strategy.SleepContext(ctx, strategy.JitteredBackoff(ctx, p.cfg.BackoffBase, p.cfg.BackoffMax, attempt+1)); err != nil {
+			return err
+		}
+	}
+}
+
+// summary returns what the retries came to.
+func (p *idempotentPurchaser) summary() *IdempotencySummary {
+	return &IdempotencySummary{Retries: p.retries.Load(), DuplicatesPrevented: p.duplicates.Load()}
+}
+
+// orderApplied reports whether the orders table holds the order of key.
+func orderApplied(ctx context.Context, db *sql.DB, key string) (bool, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE idempotency_key = ?", key).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
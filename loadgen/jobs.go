@@ -0,0 +1,103 @@
+package loadgen
+
+import (
+	"context"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// job is one operation the producer of a run hands to its worker pool: a
+// purchase, or with -read-ratio possibly a read. at is when it arrived in an
+// open-loop run, and zero otherwise.
+type job struct {
+	at time.Time
+}
+
+// jobQueue is the bounded queue through which a run's producer feeds its
+// worker pool. The producer decides how many jobs there are and when they
+// are issued, for a batch, a -duration, a -target-qps or scenario pace, or
+// the arrivals of -arrival-rate; the workers know only how to carry a job
+// out, so that any number of them can serve the same queue.
+type jobQueue struct {
+	ch       chan job
+	total    int64     // jobs to issue, 0 to issue until deadline
+	deadline time.Time // zero without -duration
+	pace     func(context.Context) error
+	arrivals *arrivalProcess
+}
+
+// newJobQueue returns the queue of a run of workers. A closed loop holds a
+// job ahead for each worker; a paced one holds none, so that workers which
+// fell behind cannot take a burst of jobs at once; an open loop holds up to
+// arrivalBacklog arrivals.
+func newJobQueue(workers int, total int64, deadline time.Time, pace func(context.Context) error, arrivals *arrivalProcess) *jobQueue {
+	size := workers
+	switch {
+	case arrivals != nil:
+		size = arrivalBacklog
+	case pace != nil:
+		size = 0
+	}
+	return &jobQueue{ch: make(chan job, size), total: total, deadline: deadline, pace: pace, arrivals: arrivals}
+}
+
+// produce issues the jobs from start until the run's total or deadline, or
+// until ctx is done, and then closes the queue. Arrivals are scheduled on a
+// fixed timeline, so one that is sent late is still timed from its
+// schedule.
+func (q *jobQueue) produce(ctx context.Context, start time.Time) {
+	defer close(q.ch)
+	if strategy.SleepContext(ctx, time.Until(start)) != nil {
+		return
+	}
+	at := start
+	for n := int64(0); q.total == 0 || n < q.total; n++ {
+		var j job
+		switch {
+		case q.arrivals != nil:
+			at = q.arrivals.after(at)
+			if !q.deadline.IsZero() && at.After(q.deadline) {
+				return
+			}
+			if strategy.SleepContext(ctx, time.Until(at)) != nil {
+				return
+			}
+			j.at = at
+		case q.pace != nil:
+			if q.pace(ctx) != nil {
+				return
+			}
+		}
+		if q.arrivals == nil && q.expired() {
+			return
+		}
+		select {
+		case q.ch <- j:
+		case <-ctx.Done():
+			return
+		}
+		if q.arrivals != nil {
+			q.arrivals.issued(len(q.ch))
+		}
+	}
+}
+
+// take returns the next job for a worker, or false once there are no more
+// or ctx is done. A closed loop's jobs left in the queue at its deadline
+// are dropped; arrivals are served however late.
+func (q *jobQueue) take(ctx context.Context) (job, bool) {
+	select {
+	case j, ok := <-q.ch:
+		if !ok || ctx.Err() != nil || q.arrivals == nil && q.expired() {
+			return job{}, false
+		}
+		return j, true
+	case <-ctx.Done():
+		return job{}, false
+	}
+}
+
+func (q *jobQueue) expired() bool {
+	return !q.deadline.IsZero() && !time.Now().Before(q.deadline)
+}
@@ -0,0 +1,141 @@
+// Package loadgen is the benchmark engine: it drives concurrent workers
+// buying through a strategy, measures them and verifies the stock they
+// leave. Run and Compare let other programs and tests embed it.
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"update_one_record/report"
+)
+
+// Run runs the benchmark cfg describes: it initializes the schema, buys
+// through cfg.Strategy from every worker and verifies the stock left. The
+// summary is written as cfg.Output selects, and the run recorded with
+// cfg.SaveResults. A run that breaks cfg.Thresholds returns its report
+// together with ErrThresholdViolated, or ErrInconsistent if it left
+// inconsistent stock.
+func Run(ctx context.Context, cfg Config) (*report.Report, error) {
+	if cfg.Compare {
+		return nil, errors.New("a comparison runs every strategy; use Compare")
+	}
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	// An interrupted run is still recorded and reported.
+	defer s.close(context.WithoutCancel(ctx))
+
+	result, err := run(ctx, s.endpoints, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return s.finish(context.WithoutCancel(ctx), cfg, result)
+}
+
+// finish records result in the results table, writes its summary and checks
+// it against cfg.Thresholds, for Run and Coordinate.
+func (s *session) finish(ctx context.Context, cfg Config, result *Result) (*report.Report, error) {
+	if s.results != nil {
+		if err := s.results.save(ctx, cfg, result); err != nil {
+			slog.Error("Failed to save results", "err", err)
+		}
+	}
+	rep := newReport(cfg, result, nil)
+	switch cfg.Output {
+	case "json":
+		if err := writeJSON(cfg.OutputFile, rep); err != nil {
+			return &rep, fmt.Errorf("write report: %w", err)
+		}
+	case "text":
+		printSummary(cfg, result)
+	}
+	if !checkThresholds(cfg, result) {
+		return &rep, thresholdError(result)
+	}
+	return &rep, nil
+}
+
+// Compare runs every registered strategy in turn with cfg, see
+// runComparison, and returns their reports.
+func Compare(ctx context.Context, cfg Config) ([]report.Report, error) {
+	cfg.Compare = true
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close(context.WithoutCancel(ctx))
+	return runComparison(ctx, s.endpoints, cfg, s.results)
+}
+
+// checkThresholds logs every threshold r violates and reports whether it
+// passed them all.
+func checkThresholds(cfg Config, r *Result) bool {
+	violations := cfg.Thresholds.violations(r)
+	for _, v := range violations {
+		slog.Error("Threshold violated", "strategy", r.Strategy, "violation", v)
+	}
+	return len(violations) == 0
+}
+
+// session holds what the runs of Run and Compare share: the endpoints, the
+// tracer and the results table.
+type session struct {
+	endpoints []Endpoint
+	results   *resultStore
+	resultsDB *sql.DB // nil unless opened for ResultsDSN
+	shutdown  func(context.Context) error
+}
+
+// openSession resolves cfg and opens what its runs need.
+func openSession(ctx context.Context, cfg *Config) (_ *session, err error) {
+	if err := cfg.resolve(); err != nil {
+		return nil, err
+	}
+	s := &session{}
+	defer func() {
+		if err != nil {
+			s.close(ctx)
+		}
+	}()
+	if cfg.Driver == "none" {
+		s.endpoints = []Endpoint{{Name: "none"}}
+	} else if s.endpoints, err = openEndpoints(*cfg); err != nil {
+		return nil, err
+	}
+	if cfg.OTLPEndpoint != "" {
+		if s.shutdown, err = setupTracing(ctx, cfg.OTLPEndpoint, cfg.TraceSampleRatio); err != nil {
+			return nil, fmt.Errorf("set up tracing: %w", err)
+		}
+	}
+	if cfg.SaveResults {
+		resultsDB := s.endpoints[0].DB
+		d := cfg.Dialect()
+		if cfg.ResultsDSN != "" {
+			if s.resultsDB, err = sql.Open(d.DriverName(), cfg.ResultsDSN); err != nil {
+				return nil, fmt.Errorf("open results db: %w", err)
+			}
+			resultsDB = s.resultsDB
+		}
+		if s.results, err = newResultStore(ctx, resultsDB, d); err != nil {
+			return nil, fmt.Errorf("prepare results table: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *session) close(ctx context.Context) {
+	if s.shutdown != nil {
+		if err := s.shutdown(ctx); err != nil {
+			slog.Error("Failed to flush traces", "err", err)
+		}
+	}
+	if s.resultsDB != nil {
+		s.resultsDB.Close()
+	}
+	closeEndpoints(s.endpoints)
+}
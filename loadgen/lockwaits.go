@@ -0,0 +1,111 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// Queries returning the number of transactions currently waiting for a row
+// lock, their combined and their longest wait in microseconds.
+const (
+	innodbLockWaitsSQL = `SELECT COUNT(*),
+	COALESCE(SUM(TIMESTAMPDIFF(MICROSECOND, trx_wait_started, NOW(6))), 0),
+	COALESCE(MAX(TIMESTAMPDIFF(MICROSECOND, trx_wait_started, NOW(6))), 0)
+FROM information_schema.innodb_trx WHERE trx_state = 'LOCK WAIT'`
+
+	tidbLockWaitsSQL = `SELECT COUNT(*),
+	COALESCE(SUM(TIMESTAMPDIFF(MICROSECOND, WAITING_START_TIME, NOW(6))), 0),
+	COALESCE(MAX(TIMESTAMPDIFF(MICROSECOND, WAITING_START_TIME, NOW(6))), 0)
+FROM information_schema.CLUSTER_TIDB_TRX WHERE STATE = 'LockWaiting'`
+)
+
+// LockWaitSummary aggregates the server's lock queue as sampled during a run.
+// TotalWait integrates the number of waiting transactions over time, so it
+// approximates the lock wait spent by all transactions together.
+type LockWaitSummary struct {
+	Samples    int64
+	MaxWaiting int64
+	AvgWaiting float64
+	MaxWait    time.Duration
+	TotalWait  time.Duration
+}
+
+// lockWaitSampler polls the server's transaction views for lock waits.
+type lockWaitSampler struct {
+	query string
+
+	mu         sync.Mutex
+	samples    int64
+	waiting    int64 // summed over all samples
+	maxWaiting int64
+	maxWait    time.Duration
+	totalWait  time.Duration
+}
+
+// newLockWaitSampler picks the lock view of the server behind db: TiDB's
+// CLUSTER_TIDB_TRX or MySQL's innodb_trx.
+func newLockWaitSampler(ctx context.Context, db *sql.DB) (*lockWaitSampler, error) {
+	tidb, err := schema.IsTiDB(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	s := &lockWaitSampler{query: innodbLockWaitsSQL}
+	if tidb {
+		s.query = tidbLockWaitsSQL
+	}
+	return s, nil
+}
+
+// loop samples every interval on a dedicated connection until ctx is done.
+func (s *lockWaitSampler) loop(ctx context.Context, db *sql.DB, interval time.Duration) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		slog.Error("Failed to open lock wait sampling connection", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var waiting, sumUs, maxUs int64
+			if err := conn.QueryRowContext(ctx, s.query).Scan(&waiting, &sumUs, &maxUs); err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("Failed to sample lock waits", "err", err)
+				}
+				continue
+			}
+			s.mu.Lock()
+			s.samples++
+			s.waiting += waiting
+			s.maxWaiting = max(s.maxWaiting, waiting)
+			s.maxWait = max(s.maxWait, time.Duration(maxUs)*time.Microsecond)
+			s.totalWait += time.Duration(waiting) * interval
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *lockWaitSampler) summary() *LockWaitSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sum := &LockWaitSummary{
+		Samples:    s.samples,
+		MaxWaiting: s.maxWaiting,
+		MaxWait:    s.maxWait,
+		TotalWait:  s.totalWait,
+	}
+	if s.samples > 0 {
+		sum.AvgWaiting = float64(s.waiting) / float64(s.samples)
+	}
+	return sum
+}
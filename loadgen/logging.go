@@ -0,0 +1,60 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logOutput is where log records are written; the -tui dashboard swaps it
+// for its log pane while it is shown.
+var logOutput = &switchWriter{w: os.Stderr}
+
+// switchWriter is an io.Writer whose destination can be changed while it is
+// in use.
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+func (s *switchWriter) set(w io.Writer) {
+	s.mu.Lock()
+	s.w = w
+	s.mu.Unlock()
+}
+
+// SetupLogging installs the default slog logger for -log-level and
+// -log-format.
+func SetupLogging(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (want debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(logOutput, opts)
+	case "json":
+		h = slog.NewJSONHandler(logOutput, opts)
+	default:
+		return fmt.Errorf("invalid log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// round1 rounds f to one decimal for log attributes.
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
@@ -0,0 +1,40 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"update_one_record/strategy"
+)
+
+// OrdersSummary describes the orders that -orders recorded during a run.
+type OrdersSummary struct {
+	Orders     int64
+	Units      int64
+	StockTaken int64 // units the stock went down by, net of restocks
+}
+
+// Consistent reports whether the orders account for every unit taken from
+// the stock.
+func (s *OrdersSummary) Consistent() bool {
+	return s.Units == s.StockTaken
+}
+
+// checkRecordsOrders returns an error if cfg asks for -orders but strat
+// cannot record them in its purchase transaction.
+func checkRecordsOrders(cfg Config, strat strategy.Strategy) error {
+	if _, ok := strat.(strategy.OrderRecorder); cfg.RecordOrders && !ok {
+		return fmt.Errorf("strategy %s cannot record orders in its purchase transaction; -orders needs one of the strategies that can", cfg.Strategy)
+	}
+	return nil
+}
+
+// countOrders returns the rows of the orders table and the units they hold.
+func countOrders(ctx context.Context, db *sql.DB) (orders, units int64, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(SUM(quantity), 0) FROM orders").Scan(&orders, &units)
+	if err != nil {
+		return 0, 0, fmt.Errorf("count orders: %w", err)
+	}
+	return orders, units, nil
+}
@@ -0,0 +1,119 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"update_one_record/strategy"
+)
+
+// maxListedOversold bounds the oversold products the summary lists.
+const maxListedOversold = 10
+
+// OversoldProduct is a product left with less stock than it accounts for.
+type OversoldProduct struct {
+	ID       int
+	Expected int64 // its initial stock less what was sold of it, or 0 where that is not known
+	Actual   int64
+}
+
+// productSales counts the units sold of every product over a run,
+// including the warm-up and net of refunds, so that the stock of each one
+// can be checked on its own: the total stock alone lets a product sold
+// below zero hide behind another that lost an update.
+type productSales struct {
+	initial []int64 // by product ID - 1
+	units   []atomic.Int64
+}
+
+// newProductSales returns the sales of a run of strat on db, or nil when
+// what is left of each product cannot be compared with what it sold: the
+// strategy keeps its stock outside products.count, or takes other than the
+// ordered quantity, or a failover leaves some purchases in doubt. A run
+// that reuses the stock starts from the counts it finds.
+func newProductSales(ctx context.Context, db *sql.DB, cfg Config, strat strategy.Strategy) (*productSales, error) {
+	_, counter := strat.(strategy.StockCounter)
+	_, sold := strat.(strategy.SoldCounter)
+	if db == nil || counter || sold || cfg.Failover {
+		return nil, nil
+	}
+	s := &productSales{initial: make([]int64, cfg.NumProducts), units: make([]atomic.Int64, cfg.NumProducts)}
+	if !cfg.SkipInit {
+		for i := range s.initial {
+			s.initial[i] = cfg.Stock
+		}
+		return s, nil
+	}
+	err := scanProducts(ctx, db, cfg.NumProducts, func(id int, count int64) {
+		s.initial[id-1] = count
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query initial stock: %w", err)
+	}
+	return s, nil
+}
+
+// sell records units sold of product id, or returned to it when negative.
+func (s *productSales) sell(id int, units int64) {
+	s.units[id-1].Add(units)
+}
+
+// expected returns the stock product id should have left once restocked
+// units were added to every product.
+func (s *productSales) expected(id int, restocked int64) int64 {
+	return s.initial[id-1] - s.units[id-1].Load() + restocked
+}
+
+// oversoldProducts returns the products of db whose stock is negative or,
+// unless sales is nil, lower than sales expects, in ID order.
+func oversoldProducts(ctx context.Context, db *sql.DB, numProducts int, sales *productSales, restocked int64) ([]OversoldProduct, error) {
+	var oversold []OversoldProduct
+	err := scanProducts(ctx, db, numProducts, func(id int, count int64) {
+		var expected int64
+		if sales != nil {
+			expected = sales.expected(id, restocked)
+		}
+		if count < 0 || count < expected {
+			oversold = append(oversold, OversoldProduct{ID: id, Expected: expected, Actual: count})
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query stock by product: %w", err)
+	}
+	return oversold, nil
+}
+
+// scanProducts calls f with the stock of every product of the run, those
+// with IDs 1 to numProducts.
+func scanProducts(ctx context.Context, db *sql.DB, numProducts int, f func(id int, count int64)) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, count FROM products WHERE id BETWEEN ? AND ? ORDER BY id", 1, numProducts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		f(id, count)
+	}
+	return rows.Err()
+}
+
+// formatOversold lists the first maxListedOversold of oversold products.
+func formatOversold(oversold []OversoldProduct) string {
+	parts := make([]string, 0, maxListedOversold+1)
+	for i, p := range oversold {
+		if i == maxListedOversold {
+			parts = append(parts, fmt.Sprintf("and %d more", len(oversold)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%d (%d, expected %d)", p.ID, p.Actual, p.Expected))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,75 @@
+package loadgen
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// phaseOrder is the order in which the transaction phases are reported;
+// phases not listed follow in name order.
+var phaseOrder = map[string]int{"begin": 0, "select": 1, "update": 2, "order": 3, "commit": 4}
+
+// phaseStats keeps a latency histogram per transaction phase. Strategies
+// measure their phases with strategy.StartPhase.
+type phaseStats struct {
+	mu     sync.Mutex
+	phases map[string]*Histogram
+}
+
+func (p *phaseStats) RecordPhase(phase string, d time.Duration) {
+	p.mu.Lock()
+	h, ok := p.phases[phase]
+	if !ok {
+		if p.phases == nil {
+			p.phases = make(map[string]*Histogram)
+		}
+		h = new(Histogram)
+		p.phases[phase] = h
+	}
+	p.mu.Unlock()
+	h.Record(d)
+}
+
+// PhaseLatency summarizes the latency of one transaction phase.
+type PhaseLatency struct {
+	Name    string
+	Count   int64
+	Mean    time.Duration
+	Latency LatencySummary
+}
+
+// results returns the measured phases in transaction order.
+func (p *phaseStats) results() []PhaseLatency {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make([]PhaseLatency, 0, len(p.phases))
+	for name, h := range p.phases {
+		results = append(results, PhaseLatency{Name: name, Count: h.Count(), Mean: h.Mean(), Latency: h.Summary()})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		oi, iok := phaseOrder[results[i].Name]
+		oj, jok := phaseOrder[results[j].Name]
+		switch {
+		case iok && jok:
+			return oi < oj
+		case iok != jok:
+			return iok
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// printPhases prints a table of the phase latencies.
+func printPhases(phases []PhaseLatency) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tCOUNT\tMEAN\tP50\tP90\tP99\tMAX")
+	for _, p := range phases {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\t%v\n", p.Name, p.Count, p.Mean.Round(time.Microsecond), p.Latency.P50, p.Latency.P90, p.Latency.P99, p.Latency.Max)
+	}
+	w.Flush()
+}
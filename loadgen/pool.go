@@ -0,0 +1,102 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// poolSampleInterval is how often the connection pool statistics are sampled.
+const poolSampleInterval = time.Second
+
+// PoolSummary describes how the workers fared with the sql.DB pool. The wait
+// percentiles are over the waits for a connection, each approximated by the
+// mean wait of the sampling interval it fell in.
+type PoolSummary struct {
+	WaitCount    int64
+	WaitDuration time.Duration
+	Wait         LatencySummary
+	MaxInUse     int
+	AvgInUse     float64
+	AvgIdle      float64
+}
+
+// poolSampler samples DBStats, summed over the pools of every endpoint, to
+// tell connection-pool starvation apart from database contention.
+type poolSampler struct {
+	dbs []*sql.DB
+
+	waits Histogram
+
+	mu       sync.Mutex
+	first    sql.DBStats
+	last     sql.DBStats
+	samples  int64
+	inUse    int64 // summed over all samples
+	idle     int64
+	maxInUse int
+}
+
+func newPoolSampler(dbs ...*sql.DB) *poolSampler {
+	s := &poolSampler{dbs: dbs}
+	s.first = s.stats()
+	s.last = s.first
+	return s
+}
+
+// loop samples every poolSampleInterval until ctx is done.
+func (s *poolSampler) loop(ctx context.Context) {
+	ticker := time.NewTicker(poolSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+// stats returns the statistics of all pools together.
+func (s *poolSampler) stats() sql.DBStats {
+	var sum sql.DBStats
+	for _, db := range s.dbs {
+		st := db.Stats()
+		sum.InUse += st.InUse
+		sum.Idle += st.Idle
+		sum.WaitCount += st.WaitCount
+		sum.WaitDuration += st.WaitDuration
+	}
+	return sum
+}
+
+func (s *poolSampler) sample() {
+	st := s.stats()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := st.WaitCount - s.last.WaitCount; n > 0 {
+		s.waits.RecordN((st.WaitDuration-s.last.WaitDuration)/time.Duration(n), n)
+	}
+	s.samples++
+	s.inUse += int64(st.InUse)
+	s.idle += int64(st.Idle)
+	s.maxInUse = max(s.maxInUse, st.InUse)
+	s.last = st
+}
+
+// summary takes a final sample and summarizes the run.
+func (s *poolSampler) summary() PoolSummary {
+	s.sample()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return PoolSummary{
+		WaitCount:    s.last.WaitCount - s.first.WaitCount,
+		WaitDuration: s.last.WaitDuration - s.first.WaitDuration,
+		Wait:         s.waits.Summary(),
+		MaxInUse:     s.maxInUse,
+		AvgInUse:     float64(s.inUse) / float64(s.samples),
+		AvgIdle:      float64(s.idle) / float64(s.samples),
+	}
+}
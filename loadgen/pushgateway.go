@@ -0,0 +1,128 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const metricsNamespace = "hot_product"
+
+var (
+	attemptsDesc = prometheus.NewDesc(metricsNamespace+"_purchase_attempts_total", "Purchases attempted.", nil, nil)
+	outcomeDesc  = prometheus.NewDesc(metricsNamespace+"_purchases_total", "Purchases by outcome.", []string{"outcome"}, nil)
+	failuresDesc = prometheus.NewDesc(metricsNamespace+"_purchase_failures_total", "Failed purchases by error class.", []string{"class"}, nil)
+	unitsDesc    = prometheus.NewDesc(metricsNamespace+"_units_sold_total", "Units sold by successful purchases.", nil, nil)
+	latencyDesc  = prometheus.NewDesc(metricsNamespace+"_purchase_latency_seconds", "Purchase latency percentiles.", []string{"quantile"}, nil)
+	elapsedDesc  = prometheus.NewDesc(metricsNamespace+"_run_elapsed_seconds", "Time since the workers started.", nil, nil)
+	stockDesc    = prometheus.NewDesc(metricsNamespace+"_stock", "Total stock at the end of the run.", []string{"kind"}, nil)
+	finishedDesc = prometheus.NewDesc(metricsNamespace+"_run_finished", "1 once the run has finished.", nil, nil)
+	consistDesc  = prometheus.NewDesc(metricsNamespace+"_run_consistent", "1 if the final stock matched the expected stock.", nil, nil)
+)
+
+// pushGateway pushes the metrics of a run to a Prometheus Pushgateway, while
+// the run progresses and once its result is known.
+type pushGateway struct {
+	pusher *push.Pusher
+	stats  *runStats
+	start  time.Time
+
+	mu     sync.Mutex
+	result *Result
+}
+
+// newPushGateway groups the run's metrics by job, strategy, a run ID and any
+// -push-labels.
+func newPushGateway(cfg Config, stats *runStats) (*pushGateway, error) {
+	g := &pushGateway{stats: stats, start: time.Now()}
+	g.pusher = push.New(cfg.PushGateway, cfg.PushJob).
+		Collector(g).
+		Grouping("strategy", cfg.Strategy).
+		Grouping("run_id", strconv.FormatInt(g.start.Unix(), 10))
+	if cfg.PushLabels != "" {
+		for _, pair := range strings.Split(cfg.PushLabels, ",") {
+			name, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid push label %q, want name=value", pair)
+			}
+			g.pusher.Grouping(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+	return g, nil
+}
+
+// loop pushes the current metrics every interval until ctx is done.
+func (g *pushGateway) loop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.pusher.PushContext(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to push metrics", "err", err)
+			}
+		}
+	}
+}
+
+// finish pushes the final metrics, including the consistency check of r.
+func (g *pushGateway) finish(ctx context.Context, r *Result) {
+	g.mu.Lock()
+	g.result = r
+	g.mu.Unlock()
+	if err := g.pusher.PushContext(ctx); err != nil {
+		slog.Error("Failed to push final metrics", "err", err)
+	}
+}
+
+func (g *pushGateway) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(g, ch)
+}
+
+func (g *pushGateway) Collect(ch chan<- prometheus.Metric) {
+	s := g.stats
+	ch <- prometheus.MustNewConstMetric(attemptsDesc, prometheus.CounterValue, float64(s.attempts.Load()))
+	ch <- prometheus.MustNewConstMetric(outcomeDesc, prometheus.CounterValue, float64(s.succeeded.Load()), "ok")
+	ch <- prometheus.MustNewConstMetric(outcomeDesc, prometheus.CounterValue, float64(s.soldOut.Load()), "sold_out")
+	ch <- prometheus.MustNewConstMetric(outcomeDesc, prometheus.CounterValue, float64(s.failed.Load()), "failed")
+	for class, n := range s.errorCounts() {
+		ch <- prometheus.MustNewConstMetric(failuresDesc, prometheus.CounterValue, float64(n), class)
+	}
+	ch <- prometheus.MustNewConstMetric(unitsDesc, prometheus.CounterValue, float64(s.unitsSold.Load()))
+
+	latency := s.latency.Summary()
+	for _, q := range []struct {
+		name string
+		d    time.Duration
+	}{{"0.5", latency.P50}, {"0.9", latency.P90}, {"0.95", latency.P95}, {"0.99", latency.P99}, {"1", latency.Max}} {
+		ch <- prometheus.MustNewConstMetric(latencyDesc, prometheus.GaugeValue, q.d.Seconds(), q.name)
+	}
+
+	g.mu.Lock()
+	r := g.result
+	g.mu.Unlock()
+	if r == nil {
+		ch <- prometheus.MustNewConstMetric(elapsedDesc, prometheus.GaugeValue, time.Since(g.start).Seconds())
+		ch <- prometheus.MustNewConstMetric(finishedDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(elapsedDesc, prometheus.GaugeValue, r.Elapsed.Seconds())
+	ch <- prometheus.MustNewConstMetric(finishedDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(stockDesc, prometheus.GaugeValue, float64(r.InitialStock), "initial")
+	ch <- prometheus.MustNewConstMetric(stockDesc, prometheus.GaugeValue, float64(r.ExpectedStock), "expected")
+	ch <- prometheus.MustNewConstMetric(stockDesc, prometheus.GaugeValue, float64(r.ActualStock), "actual")
+	consistent := 0.0
+	if r.Consistent() {
+		consistent = 1
+	}
+	ch <- prometheus.MustNewConstMetric(consistDesc, prometheus.GaugeValue, consistent)
+}
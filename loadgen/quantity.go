@@ -0,0 +1,59 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// QuantityRange is the -quantity flag: either a fixed quantity ("3") or an
+// inclusive range ("1-5") that every purchase draws from uniformly.
+type QuantityRange struct {
+	Min, Max int64
+}
+
+func (q *QuantityRange) String() string {
+	if q.Min == q.Max {
+		return strconv.FormatInt(q.Min, 10)
+	}
+	return fmt.Sprintf("%d-%d", q.Min, q.Max)
+}
+
+func (q *QuantityRange) Set(s string) error {
+	lo, hi, isRange := strings.Cut(s, "-")
+	if !isRange {
+		hi = lo
+	}
+	min, err := strconv.ParseInt(strings.TrimSpace(lo), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid quantity %q", s)
+	}
+	max, err := strconv.ParseInt(strings.TrimSpace(hi), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid quantity %q", s)
+	}
+	if min < 1 || max < min {
+		return fmt.Errorf("invalid quantity range %q", s)
+	}
+	q.Min, q.Max = min, max
+	return nil
+}
+
+// MarshalText encodes the range the way it is written on the command line.
+func (q QuantityRange) MarshalText() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+// UnmarshalText decodes a range written by MarshalText.
+func (q *QuantityRange) UnmarshalText(text []byte) error {
+	return q.Set(string(text))
+}
+
+// Pick returns the quantity of the next purchase.
+func (q QuantityRange) Pick(rng *rand.Rand) int64 {
+	if q.Max == q.Min {
+		return q.Min
+	}
+	return q.Min + rng.Int63n(q.Max-q.Min+1)
+}
@@ -0,0 +1,77 @@
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rampStep holds a load level for a while.
+type rampStep struct {
+	Level int
+	Hold  time.Duration
+}
+
+// rampSchedule is the -ramp flag: load levels held one after the other, as
+// in "100@30s,500@60s,1000@120s". The levels are target QPS with
+// -target-qps and active workers otherwise, so a single run steps through
+// the load until throughput stops growing with it. It runs as a Scenario.
+type rampSchedule []rampStep
+
+func (r *rampSchedule) String() string {
+	parts := make([]string, len(*r))
+	for i, s := range *r {
+		parts[i] = fmt.Sprintf("%d@%v", s.Level, s.Hold)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *rampSchedule) Set(s string) error {
+	var steps rampSchedule
+	for _, part := range strings.Split(s, ",") {
+		level, hold, ok := strings.Cut(strings.TrimSpace(part), "@")
+		if !ok {
+			return fmt.Errorf("invalid ramp step %q (want level@duration)", part)
+		}
+		n, err := strconv.Atoi(level)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid ramp level %q", level)
+		}
+		d, err := time.ParseDuration(hold)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid ramp duration %q", hold)
+		}
+		steps = append(steps, rampStep{Level: n, Hold: d})
+	}
+	*r = steps
+	return nil
+}
+
+// MarshalText encodes the schedule the way it is written on the command line.
+func (r rampSchedule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a schedule written by MarshalText.
+func (r *rampSchedule) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*r = nil
+		return nil
+	}
+	return r.Set(string(text))
+}
+
+// scenario returns the schedule as a scenario of target QPS phases when qps
+// is set and of active worker phases otherwise.
+func (r rampSchedule) scenario(qps bool) *Scenario {
+	s := &Scenario{}
+	for i, step := range r {
+		p := ScenarioPhase{Name: fmt.Sprintf("step %d", i+1), Concurrency: step.Level, Duration: step.Hold}
+		if qps {
+			p.Concurrency, p.TargetQPS = 0, float64(step.Level)
+		}
+		s.Phases = append(s.Phases, p)
+	}
+	return s
+}
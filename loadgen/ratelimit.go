@@ -0,0 +1,54 @@
+package loadgen
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// rateLimiter is a token bucket shared by all workers that paces the
+// purchases of -target-qps. It holds a single token, so purchases are spread
+// evenly rather than let through in bursts, and a purchase that finds the
+// bucket empty reserves the next free slot and waits for it.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	tokens float64 // negative while slots are reserved ahead
+	last   time.Time
+}
+
+func newRateLimiter(qps float64) *rateLimiter {
+	return &rateLimiter{rate: qps, tokens: 1, last: time.Now()}
+}
+
+// refill adds the tokens accrued since the last call. l.mu must be held.
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, 1)
+	l.last = now
+}
+
+// SetRate changes the rate from now on, as scenario phases do.
+func (l *rateLimiter) SetRate(qps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = qps
+}
+
+// Wait blocks until the caller may make its purchase or ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.refill(time.Now())
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait == 0 {
+		return ctx.Err()
+	}
+	return strategy.SleepContext(ctx, wait)
+}
@@ -0,0 +1,67 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// ReadSummary describes the stock reads that -read-ratio mixes into the
+// workers' purchases. Unlike the browse readers, they share the workers and
+// their connections, so each read takes the place of a purchase.
+type ReadSummary struct {
+	Ratio   float64
+	Reads   int64
+	Failed  int64
+	Latency LatencySummary
+}
+
+// readMix turns a fraction of the workers' operations into plain reads of a
+// product's stock, outside any transaction.
+type readMix struct {
+	ratio float64
+
+	reads   atomic.Int64
+	failed  atomic.Int64
+	latency Histogram
+}
+
+// isRead reports whether the next operation is a read.
+func (m *readMix) isRead(rng *rand.Rand) bool {
+	return rng.Float64() < m.ratio
+}
+
+// read reads the stock of productID, recording the read unless it happened
+// during the warm-up.
+func (m *readMix) read(ctx context.Context, db *sql.DB, productID int, record bool) {
+	var count int64
+	begin := time.Now()
+	err := db.QueryRowContext(ctx, "SELECT count FROM products WHERE id = ?", productID).Scan(&count)
+	d := time.Since(begin)
+	if err != nil {
+		slog.Debug("Read failed", "err", err, "class", strategy.ErrorClass(err), "product", productID)
+	}
+	if !record {
+		return
+	}
+	if err != nil {
+		m.failed.Add(1)
+		return
+	}
+	m.reads.Add(1)
+	m.latency.Record(d)
+}
+
+func (m *readMix) summary() *ReadSummary {
+	return &ReadSummary{
+		Ratio:   m.ratio,
+		Reads:   m.reads.Load(),
+		Failed:  m.failed.Load(),
+		Latency: m.latency.Summary(),
+	}
+}
@@ -0,0 +1,129 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// refundWorkers is how many connections apply the refunds of -cancel-ratio.
+const refundWorkers = 4
+
+// RefundSummary describes the cancellations of -cancel-ratio.
+type RefundSummary struct {
+	Ratio         float64
+	After         time.Duration
+	Refunds       int64
+	RefundedUnits int64
+	Failed        int64
+	Latency       LatencySummary
+}
+
+// pendingRefund is a successful purchase due to be cancelled.
+type pendingRefund struct {
+	order strategy.Order
+	due   time.Time
+}
+
+// refunder cancels a fraction of the successful purchases some time after
+// they were made, putting their units back on the same hot rows in a
+// transaction of its own. With -users the cancelled order is deleted too, so
+// the user may buy again.
+type refunder struct {
+	ratio float64
+	after time.Duration
+	users bool
+	sales *productSales // nil unless products are checked one by one
+
+	ch chan pendingRefund
+	wg sync.WaitGroup
+
+	refunds atomic.Int64
+	units   atomic.Int64
+	failed  atomic.Int64
+	latency Histogram
+}
+
+func newRefunder(cfg Config, sales *productSales) *refunder {
+	return &refunder{ratio: cfg.CancelRatio, after: cfg.CancelAfter, users: cfg.Users > 0, sales: sales, ch: make(chan pendingRefund, 10000)}
+}
+
+// start runs the refund workers on db until stop.
+func (r *refunder) start(ctx context.Context, db *sql.DB) {
+	for range refundWorkers {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for p := range r.ch {
+				if strategy.SleepContext(ctx, time.Until(p.due)) != nil {
+					continue
+				}
+				r.refund(ctx, db, p.order)
+			}
+		}()
+	}
+}
+
+// maybeCancel schedules a refund of order, a successful purchase, with the
+// configured chance.
+func (r *refunder) maybeCancel(rng *rand.Rand, order strategy.Order) {
+	if rng.Float64() >= r.ratio {
+		return
+	}
+	r.ch <- pendingRefund{order: order, due: time.Now().Add(r.after)}
+}
+
+func (r *refunder) refund(ctx context.Context, db *sql.DB, order strategy.Order) {
+	begin := time.Now()
+	err := r.apply(ctx, db, order)
+	r.latency.Record(time.Since(begin))
+	if err != nil {
+		r.failed.Add(1)
+		slog.Debug("Refund failed", "err", err, "class", strategy.ErrorClass(err), "product", order.ProductID, "quantity", order.Quantity)
+		return
+	}
+	r.refunds.Add(1)
+	r.units.Add(order.Quantity)
+	if r.sales != nil {
+		r.sales.sell(order.ProductID, -order.Quantity)
+	}
+}
+
+func (r *refunder) apply(ctx context.Context, db *sql.DB, order strategy.Order) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count + ?, version = version + 1 WHERE id = ?", order.Quantity, order.ProductID); err != nil {
+		return fmt.Errorf("restore stock: %w", err)
+	}
+	if r.users {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM orders WHERE user_id = ? AND product_id = ?", order.UserID, order.ProductID); err != nil {
+			return fmt.Errorf("delete order: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// stop waits for the refunds still pending, which are applied when they are
+// due, and returns what was refunded.
+func (r *refunder) stop() *RefundSummary {
+	close(r.ch)
+	r.wg.Wait()
+	return &RefundSummary{
+		Ratio:         r.ratio,
+		After:         r.after,
+		Refunds:       r.refunds.Load(),
+		RefundedUnits: r.units.Load(),
+		Failed:        r.failed.Load(),
+		Latency:       r.latency.Summary(),
+	}
+}
@@ -0,0 +1,135 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// replicaLagInterval is how often the replica lag probe compares the hot row
+// on a replica with the primary.
+const replicaLagInterval = 100 * time.Millisecond
+
+// hotRowQuery reads the stock of the hot row, product 1.
+const hotRowQuery = "SELECT count FROM products WHERE id = 1"
+
+// ReplicaLagSummary describes how far the first reader endpoint trailed the
+// primary on the hot row. UnitsBehind is how much more stock the replica
+// showed than the primary; Lag is how long ago the primary last held the
+// value the replica showed, within replicaLagInterval.
+type ReplicaLagSummary struct {
+	Endpoint       string
+	Samples        int64
+	Stale          int64 // samples in which the replica was behind
+	MaxUnitsBehind int64
+	AvgUnitsBehind float64
+	Lag            LatencySummary
+}
+
+// primarySample is the hot row stock the primary held at a point in time.
+type primarySample struct {
+	at    time.Time
+	count int64
+}
+
+// replicaLagProbe polls the hot row on the primary and a replica. Stock only
+// goes down, so the replica's value dates from just before the primary first
+// fell below it.
+type replicaLagProbe struct {
+	endpoint string
+
+	mu          sync.Mutex
+	history     []primarySample
+	samples     int64
+	stale       int64
+	unitsBehind int64 // summed over all samples
+	maxBehind   int64
+	lag         Histogram
+}
+
+// loop samples every replicaLagInterval on dedicated connections until ctx is
+// done.
+func (p *replicaLagProbe) loop(ctx context.Context, primary, replica *sql.DB) {
+	pconn, err := primary.Conn(ctx)
+	if err != nil {
+		slog.Error("Failed to open replica lag connection", "endpoint", "primary", "err", err)
+		return
+	}
+	defer pconn.Close()
+	rconn, err := replica.Conn(ctx)
+	if err != nil {
+		slog.Error("Failed to open replica lag connection", "endpoint", p.endpoint, "err", err)
+		return
+	}
+	defer rconn.Close()
+
+	ticker := time.NewTicker(replicaLagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var primaryCount, replicaCount int64
+			err := pconn.QueryRowContext(ctx, hotRowQuery).Scan(&primaryCount)
+			now := time.Now()
+			if err == nil {
+				err = rconn.QueryRowContext(ctx, hotRowQuery).Scan(&replicaCount)
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("Failed to sample replica lag", "err", err)
+				}
+				continue
+			}
+			p.record(now, primaryCount, replicaCount)
+		}
+	}
+}
+
+// record adds a sample in which the primary held primaryCount at now and the
+// replica, read right after, held replicaCount.
+func (p *replicaLagProbe) record(now time.Time, primaryCount, replicaCount int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.history = append(p.history, primarySample{at: now, count: primaryCount})
+	p.samples++
+
+	behind := replicaCount - primaryCount
+	if behind <= 0 {
+		p.history = p.history[len(p.history)-1:]
+		p.lag.Record(0)
+		return
+	}
+	p.stale++
+	p.unitsBehind += behind
+	p.maxBehind = max(p.maxBehind, behind)
+
+	// The first sample below the replica's value bounds when the replica's
+	// value was overwritten. Older samples cannot matter again, as the
+	// replica never goes back to a higher value.
+	i := 0
+	for i < len(p.history)-1 && p.history[i].count >= replicaCount {
+		i++
+	}
+	p.history = p.history[i:]
+	p.lag.Record(now.Sub(p.history[0].at))
+}
+
+func (p *replicaLagProbe) summary() *ReplicaLagSummary {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &ReplicaLagSummary{
+		Endpoint:       p.endpoint,
+		Samples:        p.samples,
+		Stale:          p.stale,
+		MaxUnitsBehind: p.maxBehind,
+		Lag:            p.lag.Summary(),
+	}
+	if p.samples > 0 {
+		s.AvgUnitsBehind = float64(p.unitsBehind) / float64(p.samples)
+	}
+	return s
+}
@@ -0,0 +1,242 @@
+package loadgen
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"update_one_record/report"
+)
+
+func newLatencyReport(s LatencySummary) report.Latency {
+	return report.Latency{
+		P50: millis(s.P50),
+		P90: millis(s.P90),
+		P95: millis(s.P95),
+		P99: millis(s.P99),
+		Max: millis(s.Max),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newReport builds the report of a run of cfg. A run that failed before
+// producing a result is reported with its error.
+func newReport(cfg Config, r *Result, err error) report.Report {
+	rep := report.Report{Config: cfg, Strategy: cfg.Strategy}
+	if err != nil {
+		rep.Error = err.Error()
+		return rep
+	}
+	rep.Interrupted = r.Interrupted
+	rep.StartedAt = r.StartedAt
+	rep.Elapsed = r.Elapsed.Seconds()
+	rep.Attempts = r.Attempts
+	rep.Succeeded = r.Succeeded
+	rep.SoldOut = r.SoldOut
+	rep.Failed = r.Failed
+	rep.Throughput = r.Throughput()
+	rep.ErrorRate = r.ErrorRate()
+	rep.Latency = newLatencyReport(r.Latency)
+	for _, p := range r.Phases {
+		rep.Phases = append(rep.Phases, report.Phase{Name: p.Name, Count: p.Count, MeanMs: millis(p.Mean), Latency: newLatencyReport(p.Latency)})
+	}
+	rep.Errors = r.Errors
+	rep.Deadlock = r.DeadlockReport
+	rep.Pool = report.Pool{
+		WaitCount:   r.Pool.WaitCount,
+		WaitTotalMs: millis(r.Pool.WaitDuration),
+		Wait:        newLatencyReport(r.Pool.Wait),
+		MaxInUse:    r.Pool.MaxInUse,
+		AvgInUse:    r.Pool.AvgInUse,
+		AvgIdle:     r.Pool.AvgIdle,
+	}
+	if l := r.LockWaits; l != nil {
+		rep.LockWaits = &report.LockWait{
+			Samples:     l.Samples,
+			MaxWaiting:  l.MaxWaiting,
+			AvgWaiting:  l.AvgWaiting,
+			MaxWaitMs:   millis(l.MaxWait),
+			TotalWaitMs: millis(l.TotalWait),
+		}
+	}
+	if s := r.Sale; s != nil {
+		rep.Sale = &report.Sale{
+			Open:      s.Open,
+			JitterMs:  millis(s.Jitter),
+			SpreadMs:  millis(s.Spread),
+			Attempts:  s.Attempts,
+			Succeeded: s.Succeeded,
+			SoldOut:   s.SoldOut,
+			Failed:    s.Failed,
+			Latency:   newLatencyReport(s.Latency),
+		}
+	}
+	if o := r.OpenLoop; o != nil {
+		rep.OpenLoop = &report.OpenLoop{Rate: o.Rate, Arrivals: o.Arrivals, MaxBacklog: o.MaxBacklog, QueueWait: newLatencyReport(o.QueueWait)}
+	}
+	if u := r.Users; u != nil {
+		rep.Users = &report.Users{Users: u.Users, Buyers: u.Buyers, Orders: u.Orders, OrderedUnits: u.OrderedUnits, Rejected: u.Rejected}
+	}
+	if o := r.Orders; o != nil {
+		rep.Orders = &report.Orders{Orders: o.Orders, Units: o.Units, StockTaken: o.StockTaken}
+	}
+	if i := r.Idempotency; i != nil {
+		rep.Idempotency = &report.Idempotency{Retries: i.Retries, DuplicatesPrevented: i.DuplicatesPrevented}
+	}
+	if s := r.SlowTrace; s != nil {
+		rep.SlowTrace = &report.SlowTrace{ThresholdMs: millis(s.Threshold), Slow: s.Slow, Logged: s.Logged}
+	}
+	if s := r.Restocks; s != nil {
+		rep.Restocks = &report.Restocks{Applied: []report.Restock{}, Skipped: s.Skipped, Units: s.Units}
+		for _, e := range s.Applied {
+			rep.Restocks.Applied = append(rep.Restocks.Applied, report.Restock{Units: e.Units, AtMs: millis(e.At), AppliedAtMs: millis(e.AppliedAt), TookMs: millis(e.Took)})
+		}
+	}
+	if f := r.Refunds; f != nil {
+		rep.Refunds = &report.Refunds{
+			Ratio:         f.Ratio,
+			AfterMs:       millis(f.After),
+			Refunds:       f.Refunds,
+			RefundedUnits: f.RefundedUnits,
+			Failed:        f.Failed,
+			Latency:       newLatencyReport(f.Latency),
+		}
+	}
+	if m := r.Reads; m != nil {
+		rep.Reads = &report.Reads{Ratio: m.Ratio, Reads: m.Reads, Failed: m.Failed, Latency: newLatencyReport(m.Latency)}
+	}
+	for _, p := range r.Scenario {
+		rep.Scenario = append(rep.Scenario, report.ScenarioPhase{
+			Name:         p.Name,
+			Concurrency:  p.Concurrency,
+			TargetQPS:    p.TargetQPS,
+			Distribution: p.Distribution,
+			DurationMs:   millis(p.Duration),
+			Attempts:     p.Attempts,
+			Succeeded:    p.Succeeded,
+			Failed:       p.Failed,
+			Throughput:   p.Throughput,
+			Latency:      newLatencyReport(p.Latency),
+		})
+	}
+	if len(r.Endpoints) > 1 {
+		for _, e := range r.Endpoints {
+			rep.Endpoints = append(rep.Endpoints, report.Endpoint{
+				Name:         e.Name,
+				Workers:      e.Workers,
+				Attempts:     e.Attempts,
+				Succeeded:    e.Succeeded,
+				Failed:       e.Failed,
+				Throughput:   e.Throughput,
+				AvgLatencyMs: millis(e.AvgLatency),
+			})
+		}
+	}
+	if b := r.Browse; b != nil {
+		rep.Browse = &report.Browse{
+			Mode:       b.Mode,
+			Readers:    b.Readers,
+			Reads:      b.Reads,
+			Failed:     b.Failed,
+			Throughput: b.Throughput,
+			Latency:    newLatencyReport(b.Latency),
+		}
+	}
+	if f := r.Failover; f != nil {
+		rep.Failover = &report.Failover{
+			Outages:         []report.Outage{},
+			DowntimeMs:      millis(f.Downtime),
+			ErrorSpikeMs:    millis(f.ErrorSpike),
+			ConfirmedUnits:  f.ConfirmedUnits,
+			AmbiguousUnits:  f.AmbiguousUnits,
+			LostUnits:       f.LostUnits,
+			DoubleSoldUnits: f.DoubleSoldUnits,
+		}
+		for _, o := range f.Outages {
+			out := report.Outage{Start: o.Start, Errors: o.Errors, DowntimeMs: millis(o.Downtime), ErrorSpikeMs: millis(o.ErrorSpike)}
+			if !o.End.IsZero() {
+				out.End = &o.End
+			}
+			rep.Failover.Outages = append(rep.Failover.Outages, out)
+		}
+	}
+	if l := r.ReplicaLag; l != nil {
+		rep.ReplicaLag = &report.ReplicaLag{
+			Endpoint:       l.Endpoint,
+			Samples:        l.Samples,
+			Stale:          l.Stale,
+			MaxUnitsBehind: l.MaxUnitsBehind,
+			AvgUnitsBehind: l.AvgUnitsBehind,
+			Lag:            newLatencyReport(l.Lag),
+		}
+	}
+	for _, p := range r.hottest(cfg.TopProducts) {
+		rep.HotProducts = append(rep.HotProducts, report.Product{
+			ID:           p.ID,
+			Attempts:     p.Attempts,
+			Succeeded:    p.Succeeded,
+			SoldOut:      p.SoldOut,
+			Share:        p.Share,
+			AvgLatencyMs: millis(p.AvgLatency),
+		})
+	}
+	rep.Retries = report.Retries{
+		Total:      r.Retries.Total,
+		Retried:    r.Retries.Retried,
+		Abandoned:  r.Retries.Abandoned,
+		PerSuccess: make(map[string]int64),
+	}
+	for n, c := range r.Retries.PerSuccess {
+		if c > 0 {
+			rep.Retries.PerSuccess[retryBucketName(n)] = c
+		}
+	}
+	rep.Workers = report.Workers{
+		MinTPS:     r.Workers.MinTPS,
+		AvgTPS:     r.Workers.AvgTPS,
+		MaxTPS:     r.Workers.MaxTPS,
+		MinFailed:  r.Workers.MinFailed,
+		AvgFailed:  r.Workers.AvgFailed,
+		MaxFailed:  r.Workers.MaxFailed,
+		Stragglers: []report.Worker{},
+	}
+	for _, w := range r.Workers.Stragglers {
+		rep.Workers.Stragglers = append(rep.Workers.Stragglers, report.Worker{
+			ID:         w.ID,
+			Attempts:   w.Attempts,
+			Succeeded:  w.Succeeded,
+			Failed:     w.Failed,
+			Throughput: w.Throughput,
+		})
+	}
+	rep.Consistency = report.Consistency{
+		InitialStock:  r.InitialStock,
+		ExpectedStock: r.ExpectedStock,
+		ActualStock:   r.ActualStock,
+		Consistent:    r.Consistent(),
+	}
+	for _, p := range r.Oversold {
+		rep.Consistency.Oversold = append(rep.Consistency.Oversold, report.OversoldProduct{ID: p.ID, Expected: p.Expected, Actual: p.Actual})
+	}
+	return rep
+}
+
+// writeJSON writes v as indented JSON to path, or to stdout if path is empty.
+func writeJSON(path string, v any) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,151 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// restockEvent adds Units to every product At after the run starts.
+type restockEvent struct {
+	Units int64
+	At    time.Duration
+}
+
+// restockSchedule is the -restock flag: stock added to every product while
+// the sale runs, as in "+5000@60s,+5000@120s", to model drip-release sales.
+type restockSchedule []restockEvent
+
+func (r *restockSchedule) String() string {
+	parts := make([]string, len(*r))
+	for i, e := range *r {
+		parts[i] = fmt.Sprintf("+%d@%v", e.Units, e.At)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (r *restockSchedule) Set(s string) error {
+	var events restockSchedule
+	for _, part := range strings.Split(s, ",") {
+		units, at, ok := strings.Cut(strings.TrimSpace(part), "@")
+		if !ok {
+			return fmt.Errorf("invalid restock %q (want +units@duration)", part)
+		}
+		n, err := strconv.ParseInt(strings.TrimPrefix(units, "+"), 10, 64)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid restock units %q", units)
+		}
+		d, err := time.ParseDuration(at)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid restock time %q", at)
+		}
+		if len(events) > 0 && d < events[len(events)-1].At {
+			return fmt.Errorf("restocks must be in time order, %q is not", part)
+		}
+		events = append(events, restockEvent{Units: n, At: d})
+	}
+	*r = events
+	return nil
+}
+
+// MarshalText encodes the schedule the way it is written on the command line.
+func (r restockSchedule) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText decodes a schedule written by MarshalText.
+func (r *restockSchedule) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*r = nil
+		return nil
+	}
+	return r.Set(string(text))
+}
+
+// RestockSummary describes the restocks of -restock that were applied
+// before the workers finished; the rest were skipped.
+type RestockSummary struct {
+	Applied []RestockResult
+	Skipped int
+	Units   int64 // added over all products
+}
+
+// RestockResult is one applied restock.
+type RestockResult struct {
+	Units     int64 // per product
+	At        time.Duration
+	AppliedAt time.Duration // since the run started
+	Took      time.Duration
+}
+
+// restocker applies a restock schedule to the products table, logging the
+// units of each restock in the restocks table too when log is set.
+type restocker struct {
+	schedule    restockSchedule
+	numProducts int
+	log         bool
+	done        chan struct{}
+	summary     RestockSummary
+}
+
+func newRestocker(cfg Config) *restocker {
+	return &restocker{schedule: cfg.Restock, numProducts: cfg.NumProducts, log: cfg.Users > 0 || cfg.RecordOrders, done: make(chan struct{})}
+}
+
+// loop applies every restock at its time after start until ctx is done. A
+// restock that has begun is not canceled, so that it is known whether it
+// was applied.
+func (r *restocker) loop(ctx context.Context, db *sql.DB, start time.Time) {
+	defer close(r.done)
+	for i, e := range r.schedule {
+		if strategy.SleepContext(ctx, time.Until(start.Add(e.At))) != nil {
+			r.summary.Skipped += len(r.schedule) - i
+			return
+		}
+		begin := time.Now()
+		if err := r.restock(context.WithoutCancel(ctx), db, e.Units); err != nil {
+			slog.Error("Failed to restock", "err", err, "units", e.Units, "at", e.At)
+			r.summary.Skipped++
+			continue
+		}
+		slog.Info("Restocked", "units_per_product", e.Units, "at", e.At)
+		r.summary.Applied = append(r.summary.Applied, RestockResult{Units: e.Units, At: e.At, AppliedAt: begin.Sub(start), Took: time.Since(begin)})
+		r.summary.Units += e.Units * int64(r.numProducts)
+	}
+}
+
+// restock adds units to every product in one transaction, along with the
+// row of the restocks table that logs them.
+func (r *restocker) restock(ctx context.Context, db *sql.DB, units int64) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE products SET count = count + ?, version = version + 1", units)
+	if err != nil {
+		return err
+	}
+	if r.log {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO restocks (units, created_at) VALUES (?, ?)", units*n, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// wait waits for loop to return and returns what it applied.
+func (r *restocker) wait() *RestockSummary {
+	<-r.done
+	return &r.summary
+}
@@ -0,0 +1,90 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+
+	"update_one_record/schema"
+)
+
+// benchmarkRunsSQL returns the statements that create the benchmark_runs
+// table in dialect d if it does not exist yet.
+func benchmarkRunsSQL(d schema.Dialect) []string {
+	columns := `id ` + d.Serial() + `,
+	started_at ` + d.Timestamp() + ` NOT NULL,
+	strategy VARCHAR(64) NOT NULL,
+	config JSON NOT NULL,
+	throughput_tps DOUBLE PRECISION NOT NULL,
+	p99_ms DOUBLE PRECISION NOT NULL,
+	error_rate DOUBLE PRECISION NOT NULL,
+	consistent BOOLEAN NOT NULL,
+	git_sha VARCHAR(64) NOT NULL,
+	report JSON NOT NULL`
+	// MySQL has no CREATE INDEX IF NOT EXISTS, and the others no inline KEY.
+	if d.DriverName() == "mysql" {
+		return []string{"CREATE TABLE IF NOT EXISTS benchmark_runs (\n\t" + columns + ",\n\tKEY idx_strategy_started (strategy, started_at)\n)"}
+	}
+	return []string{
+		"CREATE TABLE IF NOT EXISTS benchmark_runs (\n\t" + columns + "\n)",
+		"CREATE INDEX IF NOT EXISTS idx_strategy_started ON benchmark_runs (strategy, started_at)",
+	}
+}
+
+// resultStore records every run in the benchmark_runs table, building a
+// queryable history of experiments.
+type resultStore struct {
+	db     *sql.DB
+	gitSHA string
+}
+
+// newResultStore creates the benchmark_runs table of dialect d in db if
+// needed.
+func newResultStore(ctx context.Context, db *sql.DB, d schema.Dialect) (*resultStore, error) {
+	for _, stmt := range benchmarkRunsSQL(d) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("create benchmark_runs: %w", err)
+		}
+	}
+	return &resultStore{db: db, gitSHA: gitSHA()}, nil
+}
+
+// save inserts the result of a run of cfg.
+func (s *resultStore) save(ctx context.Context, cfg Config, r *Result) error {
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	report, err := json.Marshal(newReport(cfg, r, nil))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		"INSERT INTO benchmark_runs (started_at, strategy, config, throughput_tps, p99_ms, error_rate, consistent, git_sha, report) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		r.StartedAt.UTC(), r.Strategy, string(config), r.Throughput(), millis(r.Latency.P99), r.ErrorRate(), r.Consistent(), s.gitSHA, string(report))
+	if err != nil {
+		return fmt.Errorf("insert into benchmark_runs: %w", err)
+	}
+	return nil
+}
+
+// gitSHA returns the commit the binary was built from, falling back to the
+// checkout in the working directory for `go run`.
+func gitSHA() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(out))
+}
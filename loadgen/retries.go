@@ -0,0 +1,42 @@
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxRetryBucket is the last bucket of the retries-per-success distribution;
+// it also counts purchases that needed more retries.
+const maxRetryBucket = 10
+
+// RetrySummary reports how much retrying the purchases needed. PerSuccess[n]
+// counts the successful purchases that took n retries, the last element
+// those that took maxRetryBucket or more. Retried counts the purchases
+// retried at least once, however they ended; abandoned ones failed with
+// strategy.ErrTooManyRetries.
+type RetrySummary struct {
+	Total      int64
+	Retried    int64
+	Abandoned  int64
+	PerSuccess []int64
+}
+
+// retryBucketName returns the label of bucket n of RetrySummary.PerSuccess.
+func retryBucketName(n int) string {
+	if n == maxRetryBucket {
+		return strconv.Itoa(n) + "+"
+	}
+	return strconv.Itoa(n)
+}
+
+// formatRetryDistribution renders the non-empty buckets as "retries:purchases".
+func formatRetryDistribution(perSuccess []int64) string {
+	var parts []string
+	for n, c := range perSuccess {
+		if c > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%d", retryBucketName(n), c))
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,841 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// Result summarizes one run of a strategy.
+type Result struct {
+	Strategy    string
+	Interrupted bool // ctx was done before the workers finished
+	StartedAt   time.Time
+	Elapsed     time.Duration
+
+	Attempts    int64
+	Succeeded   int64
+	SoldOut     int64
+	Failed      int64
+	Latency     LatencySummary
+	Errors      map[string]int64 // failures by ErrorClass
+	Products    []ProductResult  // hottest first
+	Endpoints   []EndpointResult // in DB_DSN order
+	Workers     WorkerSummary
+	Retries     RetrySummary
+	Phases      []PhaseLatency        // in transaction order, if the strategy measures them
+	LockWaits   *LockWaitSummary      // nil unless -lock-sample is set
+	Browse      *BrowseSummary        // nil unless -browse-readers is set
+	ReplicaLag  *ReplicaLagSummary    // nil unless DB_READER_DSN is set
+	Failover    *FailoverSummary      // nil unless -failover is set
+	Scenario    []ScenarioPhaseResult // in order, with -scenario or -ramp
+	Reads       *ReadSummary          // nil unless -read-ratio is set
+	Sale        *SaleSummary          // nil unless -sale-open is set
+	OpenLoop    *OpenLoopSummary      // nil unless -arrival-rate is set
+	Users       *UsersSummary         // nil unless -users is set
+	Orders      *OrdersSummary        // nil unless -orders is set
+	Idempotency *IdempotencySummary   // nil unless -idempotency is set
+	SlowTrace   *SlowTraceSummary     // nil unless -trace-slow is set
+	Refunds     *RefundSummary        // nil unless -cancel-ratio is set
+	Restocks    *RestockSummary       // nil unless -restock is set
+	Pool        PoolSummary
+
+	// DeadlockReport is the server's report of the latest deadlock, captured
+	// the first time a purchase failed with one.
+	DeadlockReport string
+
+	InitialStock  int64
+	ExpectedStock int64
+	ActualStock   int64
+	Oversold      []OversoldProduct // in ID order
+}
+
+// Consistent reports whether the stock left matches what was sold and no
+// product was left with less than it accounts for. Across a failover the
+// total only has to lie within what the ambiguous purchases allow.
+func (r *Result) Consistent() bool {
+	if len(r.Oversold) > 0 {
+		return false
+	}
+	if f := r.Failover; f != nil {
+		return f.LostUnits == 0 && f.DoubleSoldUnits == 0
+	}
+	return r.ActualStock == r.ExpectedStock && (r.Orders == nil || r.Orders.Consistent())
+}
+
+// Throughput returns the successful purchases per second.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Succeeded) / r.Elapsed.Seconds()
+}
+
+// ErrorRate returns the fraction of attempts that failed with an error other
+// than strategy.ErrSoldOut.
+func (r *Result) ErrorRate() float64 {
+	if r.Attempts == 0 {
+		return 0
+	}
+	return float64(r.Failed) / float64(r.Attempts)
+}
+
+// run initializes a fresh schema, unless cfg.SkipInit, runs cfg.Strategy
+// with cfg.Concurrency workers spread over the writer endpoints and verifies
+// the remaining stock. Reader endpoints only serve the browse readers. Once
+// ctx is done the workers stop after the purchases they have under way, and
+// the run is verified and summarized as far as it got.
+func run(ctx context.Context, endpoints []Endpoint, cfg Config) (*Result, error) {
+	endpoints, readers := splitEndpoints(endpoints)
+	db := endpoints[0].DB
+	strat, err := strategy.New(cfg.Strategy, &cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := strat.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	// --- Schema Initialization ---
+	if _, standalone := strat.(strategy.Seeder); db == nil && !standalone {
+		return nil, fmt.Errorf("strategy %s needs a SQL database, it cannot run with -driver none", cfg.Strategy)
+	}
+	if err := checkRecordsOrders(cfg, strat); err != nil {
+		return nil, err
+	}
+	// Refunds and restocks add units to products.count, which has to be
+	// where the strategy keeps the stock it sells.
+	_, counter := strat.(strategy.StockCounter)
+	_, sold := strat.(strategy.SoldCounter)
+	_, mirror := strat.(strategy.StockMirror)
+	if (cfg.CancelRatio > 0 || len(cfg.Restock) > 0) && (counter || sold) {
+		return nil, fmt.Errorf("strategy %s does not keep its stock in products.count, so -cancel-ratio and -restock cannot add to it", cfg.Strategy)
+	}
+	if (cfg.CancelRatio > 0 || len(cfg.Restock) > 0) && mirror {
+		return nil, fmt.Errorf("strategy %s keeps products.count in step with stock of its own, so -cancel-ratio and -restock cannot add to products.count alone", cfg.Strategy)
+	}
+	if !cfg.SkipInit {
+		if err := initStock(ctx, db, cfg, strat, cfg.Users > 0 || cfg.RecordOrders); err != nil {
+			return nil, err
+		}
+	}
+	if s, ok := strat.(strategy.Starter); ok {
+		if err := s.Start(ctx, db); err != nil {
+			return nil, fmt.Errorf("start strategy %s: %w", cfg.Strategy, err)
+		}
+	}
+	initialTotalStock := cfg.Stock * int64(cfg.NumProducts)
+	if cfg.SkipInit {
+		// The stock left by earlier runs is where this one starts.
+		if initialTotalStock, err = totalStock(ctx, db, strat); err != nil {
+			return nil, fmt.Errorf("query initial total stock: %w", err)
+		}
+		slog.Info("Reusing stock", "products", cfg.NumProducts, "total_stock", initialTotalStock)
+	}
+	// With -orders the orders the run adds must account for the stock it
+	// takes, whatever the table held before.
+	var ordersBefore, orderedUnitsBefore int64
+	if cfg.RecordOrders {
+		if ordersBefore, orderedUnitsBefore, err = countOrders(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	sales, err := newProductSales(ctx, db, cfg, strat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Purchases go through purchaser; the optional Starter, Stopper and
+	// StockCounter hooks stay on strat.
+	purchaser := strategy.Strategy(strat)
+	retrier := newRetrier(cfg, strat)
+	if retrier != nil {
+		purchaser = retrier
+	}
+	var idempotent *idempotentPurchaser
+	if cfg.Idempotency {
+		idempotent = &idempotentPurchaser{Strategy: purchaser, cfg: cfg}
+		purchaser = idempotent
+	}
+	// The user's order is claimed once, outside any retries.
+	var users *userLimiter
+	if cfg.Users > 0 {
+		users = &userLimiter{Strategy: purchaser, users: cfg.Users, recorded: cfg.RecordOrders}
+		purchaser = users
+	}
+
+	// --- Simulation ---
+	perWorker := any(cfg.BatchSize)
+	if cfg.Duration > 0 {
+		perWorker = "for " + cfg.Duration.String()
+	}
+	slog.Info("Starting", "seed", cfg.Seed, "workers", cfg.Concurrency, "purchases_per_worker", perWorker, "quantity", cfg.Quantity.String(), "products", cfg.NumProducts, "distribution", cfg.Distribution.String(), "affinity", cfg.Affinity, "strategy", cfg.Strategy)
+
+	var (
+		deadlocks = &deadlockCapture{db: db}
+		wg        sync.WaitGroup
+		stats     = newRunStats(cfg.NumProducts, cfg.Concurrency, len(endpoints), int64(cfg.Concurrency)*int64(cfg.BatchSize))
+		unitsSold atomic.Int64 // by the successful purchases, including the warm-up
+	)
+
+	if cfg.StatsdAddr != "" {
+		emitter, err := newStatsdEmitter(cfg.StatsdAddr, cfg.StatsdPrefix, cfg.Strategy)
+		if err != nil {
+			return nil, fmt.Errorf("create statsd client: %w", err)
+		}
+		defer emitter.Close()
+		stats.statsd = emitter
+	}
+
+	var locks *lockWaitSampler
+	if cfg.LockSampleInterval > 0 {
+		var err error
+		if locks, err = newLockWaitSampler(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	var gateway *pushGateway
+	if cfg.PushGateway != "" {
+		var err error
+		if gateway, err = newPushGateway(cfg, stats); err != nil {
+			return nil, err
+		}
+	}
+
+	var browse *browser
+	if cfg.BrowseReaders > 0 {
+		var err error
+		if browse, err = newBrowser(cfg); err != nil {
+			return nil, err
+		}
+	}
+	var lag *replicaLagProbe
+	if len(readers) > 0 {
+		lag = &replicaLagProbe{endpoint: readers[0].Name}
+	}
+
+	var sinks []func(tickSample)
+	if cfg.CSVFile != "" {
+		csv, err := newCSVSampler(cfg.CSVFile)
+		if err != nil {
+			return nil, fmt.Errorf("create csv: %w", err)
+		}
+		defer csv.Close()
+		sinks = append(sinks, csv.write)
+	}
+	if cfg.HGRMFile != "" || cfg.HDRLogFile != "" {
+		hdr, err := newHDRRecorder(cfg.HDRLogFile)
+		if err != nil {
+			return nil, fmt.Errorf("create hdr log: %w", err)
+		}
+		defer func() {
+			if err := hdr.Close(); err != nil {
+				slog.Error("Failed to write HdrHistogram log", "err", err)
+			}
+		}()
+		stats.hdr = hdr
+		if cfg.HDRLogFile != "" {
+			sinks = append(sinks, hdr.sample)
+		}
+	}
+	stopDashboard := func() {}
+	if cfg.TUI {
+		var sink func(tickSample)
+		sink, stopDashboard = startDashboard(cfg, stats)
+		sinks = append(sinks, sink)
+	} else if cfg.TickInterval > 0 {
+		sinks = append(sinks, logSample)
+	}
+	if cfg.progress != nil {
+		sinks = append(sinks, cfg.progress)
+	}
+	if cfg.WebAddr != "" {
+		// The feed ends once the run has been verified.
+		sink, stopWeb, err := startWebDashboard(cfg, stats, initialTotalStock)
+		if err != nil {
+			return nil, err
+		}
+		defer stopWeb()
+		sinks = append(sinks, sink)
+	}
+	tickCtx, stopTicker := context.WithCancel(ctx)
+	if len(sinks) > 0 {
+		interval := cfg.TickInterval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		go stats.tick(tickCtx, interval, sinks...)
+	}
+	if gateway != nil {
+		go gateway.loop(tickCtx, cfg.PushInterval)
+	}
+	if locks != nil {
+		go locks.loop(tickCtx, db, cfg.LockSampleInterval)
+	}
+	if lag != nil {
+		go lag.loop(tickCtx, db, readers[0].DB)
+	}
+	dbs := make([]*sql.DB, len(endpoints))
+	for i, e := range endpoints {
+		dbs[i] = e.DB
+	}
+	var pooled []*sql.DB
+	if db != nil {
+		pooled = dbs
+	}
+	pool := newPoolSampler(pooled...)
+	go pool.loop(tickCtx)
+	if browse != nil {
+		browseDBs := dbs[:1]
+		if len(readers) > 0 {
+			browseDBs = make([]*sql.DB, len(readers))
+			for i, e := range readers {
+				browseDBs[i] = e.DB
+			}
+		}
+		if err := browse.run(tickCtx, browseDBs); err != nil {
+			stopTicker()
+			return nil, err
+		}
+	}
+	// Purchases of the warm-up period count against the stock but not in the
+	// statistics, which start once it is over.
+	products := newProductPicker(cfg.Distribution, cfg.NumProducts)
+	start := time.Now()
+	var sale *saleBarrier
+	if !cfg.SaleOpen.isZero() {
+		// The run starts when the sale opens; the workers wait for it.
+		sale = newSaleBarrier(cfg)
+		start = sale.open
+		slog.Info("Waiting for the sale to open", "at", sale.open.Format(time.RFC3339Nano), "in", time.Until(sale.open).Round(time.Millisecond), "jitter", cfg.SaleJitter)
+	}
+	warmupEnd := start.Add(cfg.Warmup)
+	// A -duration run ends at its deadline rather than after BatchSize
+	// purchases per worker, so its progress goes by the clock.
+	deadline := warmupEnd.Add(cfg.Duration)
+	total, until := int64(cfg.Concurrency)*int64(cfg.BatchSize), time.Time{}
+	if cfg.Duration > 0 {
+		total, until = 0, deadline
+		stats.total, stats.duration = 0, cfg.Warmup+cfg.Duration
+	}
+	var pace func(context.Context) error
+	if cfg.TargetQPS > 0 {
+		pace = newRateLimiter(cfg.TargetQPS).Wait
+	}
+	var scenario *scenarioRunner
+	if cfg.Scenario != nil {
+		scenario = newScenarioRunner(cfg.Scenario, cfg.NumProducts)
+		go scenario.loop(tickCtx, warmupEnd)
+		pace = scenario.pace
+	}
+	var reads *readMix
+	if cfg.ReadRatio > 0 {
+		reads = &readMix{ratio: cfg.ReadRatio}
+		// Progress counts purchases only; expect as many as are not reads.
+		stats.total = int64(float64(stats.total) * (1 - cfg.ReadRatio))
+	}
+	var slow *slowTracer
+	if cfg.TraceSlow > 0 {
+		slow = newSlowTracer(cfg)
+	}
+	var failover *failoverTracker
+	if cfg.Failover {
+		failover = newFailoverTracker(cfg, start)
+	}
+	var refunds *refunder
+	if cfg.CancelRatio > 0 {
+		refunds = newRefunder(cfg, sales)
+		refunds.start(ctx, db)
+	}
+	restockCtx, stopRestock := context.WithCancel(ctx)
+	defer stopRestock()
+	var restocks *restocker
+	if len(cfg.Restock) > 0 {
+		restocks = newRestocker(cfg)
+		go restocks.loop(restockCtx, db, start)
+	}
+	var arrivals *arrivalProcess
+	if cfg.ArrivalRate > 0 {
+		// The workers serve the arrivals as they come; a batch run issues
+		// as many arrivals as a closed loop would purchases.
+		arrivals = newArrivalProcess(cfg.ArrivalRate, newStream(cfg.Seed, arrivalStream))
+	}
+	// A producer feeds the jobs of the run to a pool of workers through a
+	// bounded queue, and closes it once they are all issued or ctx is done.
+	jobs := newJobQueue(cfg.Concurrency, total, until, pace, arrivals)
+	produceCtx, stopProducer := context.WithCancel(ctx)
+	defer stopProducer()
+	go jobs.produce(produceCtx, start)
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(workerID int) {
+			defer wg.Done()
+			rng := newStream(cfg.Seed, workerID)
+			ctx := strategy.WithRand(strategy.WithWorkerID(ctx, workerID), rng)
+			db := dbs[endpointIndex(workerID, len(dbs))]
+			lo, hi := 1, cfg.NumProducts
+			if cfg.Affinity != "none" {
+				lo, hi = affinityRange(cfg.Affinity, workerID, cfg.Concurrency, cfg.NumProducts)
+			}
+			reconnects := 0
+			if sale != nil && !sale.wait(ctx, rng) {
+				return
+			}
+			var (
+				jb    job
+				retry bool
+			)
+			for j := 0; ctx.Err() == nil; j++ {
+				// A worker idling in the current scenario phase takes no
+				// job, which another one serves instead.
+				if scenario != nil && !scenario.waitActive(ctx, workerID, deadline) {
+					break
+				}
+				if !retry {
+					var ok bool
+					if jb, ok = jobs.take(ctx); !ok {
+						break
+					}
+				}
+				retry = false
+				if j > 0 && cfg.ThinkTime.Mean > 0 && strategy.SleepContext(ctx, cfg.ThinkTime.Pick(rng)) != nil {
+					break
+				}
+				pick := func() int { return products.Pick(rng) }
+				if cfg.Affinity != "none" {
+					pick = func() int { return lo + rng.Intn(hi-lo+1) }
+				} else if scenario != nil {
+					pick = func() int { return scenario.pick(rng) }
+				}
+				if reads != nil && reads.isRead(rng) {
+					reads.read(ctx, db, pick(), !time.Now().Before(warmupEnd))
+					continue
+				}
+				order := strategy.Order{ProductID: pick(), Quantity: cfg.Quantity.Pick(rng)}
+				if users != nil {
+					order.UserID = users.pick(rng)
+				}
+
+				begin := time.Now()
+				warmingUp := begin.Before(warmupEnd)
+				purchaseCtx := ctx
+				var phases strategy.PhaseRecorder
+				if !warmingUp {
+					phases = &stats.phases
+				}
+				var trace *purchaseTrace
+				if slow != nil {
+					// The trace passes the phases on to the statistics.
+					trace = &purchaseTrace{phases: phases}
+					phases = trace
+					purchaseCtx = schema.WithStatementRecorder(purchaseCtx, trace)
+				}
+				if phases != nil {
+					purchaseCtx = strategy.WithPhaseRecorder(purchaseCtx, phases)
+				}
+				spanCtx, span := startPurchaseSpan(purchaseCtx, cfg.Strategy, order)
+				spanCtx, retries := strategy.WithRetryCounter(spanCtx)
+				// A purchase under way is finished even if the run is
+				// interrupted, so that every one issued is accounted for.
+				err := purchaser.Purchase(context.WithoutCancel(spanCtx), db, order)
+				strategy.EndSpan(span, err)
+				d := time.Since(begin)
+				end := begin.Add(d)
+				var wait time.Duration
+				if arrivals != nil {
+					// Time the purchase from its arrival, so that waiting
+					// for a worker counts against its latency.
+					wait = begin.Sub(jb.at)
+					if !warmingUp {
+						arrivals.queueWait.Record(wait)
+					}
+					d += wait
+				}
+				if err == nil {
+					unitsSold.Add(order.Quantity)
+					if sales != nil {
+						sales.sell(order.ProductID, order.Quantity)
+					}
+					if refunds != nil {
+						refunds.maybeCancel(rng, order)
+					}
+				}
+				if sale != nil {
+					sale.record(begin, err, d)
+				}
+				if warmingUp {
+					stats.warmup.Add(1)
+				} else {
+					stats.record(workerID, order, err, d, retries.Load())
+					if scenario != nil {
+						scenario.record(err, d)
+					}
+				}
+				deadlocks.observe(ctx, err)
+				if trace != nil {
+					slow.observe(trace, workerID, order, begin, d, wait, retries.Load(), err)
+				}
+				if err != nil && !errors.Is(err, strategy.ErrSoldOut) && !errors.Is(err, strategy.ErrAlreadyPurchased) {
+					slog.Debug("Purchase failed", "err", err, "class", strategy.ErrorClass(err), "product", order.ProductID,
+						"quantity", order.Quantity, "worker", workerID, "attempt", j+1, "retries", retries.Load(), "latency", d)
+				}
+				if failover != nil {
+					// Jobs that fail for the outage are tried again rather
+					// than used up.
+					failover.observe(order, err, end)
+					retry = failover.reconnect(ctx, err, &reconnects)
+				}
+			}
+			stats.workerDone(workerID, time.Since(warmupEnd))
+		}(i + 1)
+	}
+	if sale != nil {
+		sale.release(ctx)
+	}
+	wg.Wait()
+	// The producer may still be waiting to queue a job past the deadline.
+	stopProducer()
+	interrupted := ctx.Err() != nil
+	if interrupted {
+		slog.Warn("Run interrupted; reporting the purchases completed so far")
+	}
+	// What follows reports and verifies the run even once ctx is done.
+	ctx = context.WithoutCancel(ctx)
+	// Restocks still due once the workers are done are skipped.
+	stopRestock()
+	var restockSummary *RestockSummary
+	if restocks != nil {
+		restockSummary = restocks.wait()
+	}
+	var refundSummary *RefundSummary
+	if refunds != nil {
+		refundSummary = refunds.stop()
+	}
+	elapsed := time.Since(warmupEnd)
+	if elapsed <= 0 {
+		slog.Warn("The run finished during its warm-up; no purchases were recorded", "warmup", cfg.Warmup)
+	}
+	stopTicker()
+	if browse != nil {
+		browse.wait()
+	}
+	poolStats := pool.summary()
+	if cfg.HGRMFile != "" {
+		if err := stats.hdr.writeHGRM(cfg.HGRMFile); err != nil {
+			slog.Error("Failed to write HdrHistogram percentiles", "err", err)
+		}
+	}
+	stopDashboard()
+	slog.Info("All workers finished", "elapsed", elapsed.Round(time.Millisecond))
+	if retrier != nil {
+		slog.Info("Conflict retries", "driver", cfg.Driver, "txn_mode", cfg.TxnMode, "retry_locks", cfg.RetryLocks, "retries", retrier.Retries.Load(), "abandoned", retrier.Abandoned.Load(), "max_retries", cfg.MaxRetries)
+	}
+
+	if s, ok := strat.(strategy.Stopper); ok {
+		if err := s.Stop(ctx); err != nil {
+			slog.Error("Failed to stop strategy", "strategy", cfg.Strategy, "err", err)
+		}
+	}
+
+	// --- Verification ---
+	finalTotalStock, err := totalStock(ctx, db, strat)
+	if err != nil {
+		return nil, fmt.Errorf("query final total stock: %w", err)
+	}
+
+	// Only the purchases that committed took stock: one that failed, even
+	// to begin its transaction, or found the product sold out left it as it
+	// was.
+	expectedTotalStock := initialTotalStock - unitsSold.Load()
+	if c, ok := strat.(strategy.SoldCounter); ok {
+		expectedTotalStock = initialTotalStock - c.UnitsSold()
+	}
+	if refundSummary != nil {
+		expectedTotalStock += refundSummary.RefundedUnits
+	}
+	if restockSummary != nil {
+		expectedTotalStock += restockSummary.Units
+	}
+	var failoverSummary *FailoverSummary
+	if failover != nil {
+		failoverSummary = failover.summary(time.Now(), initialTotalStock, finalTotalStock)
+		expectedTotalStock = initialTotalStock - failoverSummary.ConfirmedUnits
+	}
+	// The total alone can mask a product sold below what it had by another
+	// left above it, so every product is checked on its own as well.
+	var oversold []OversoldProduct
+	if _, counter := strat.(strategy.StockCounter); db != nil && !counter {
+		var restocked int64
+		if restockSummary != nil {
+			for _, e := range restockSummary.Applied {
+				restocked += e.Units
+			}
+		}
+		if oversold, err = oversoldProducts(ctx, db, cfg.NumProducts, sales, restocked); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{
+		Strategy:       cfg.Strategy,
+		Interrupted:    interrupted,
+		StartedAt:      warmupEnd,
+		Elapsed:        elapsed,
+		Attempts:       stats.attempts.Load(),
+		Succeeded:      stats.succeeded.Load(),
+		SoldOut:        stats.soldOut.Load(),
+		Failed:         stats.failed.Load(),
+		Latency:        stats.latency.Summary(),
+		Errors:         stats.errorCounts(),
+		Products:       stats.productResults(),
+		Endpoints:      stats.endpointResults(endpoints, elapsed),
+		Workers:        stats.workerSummary(),
+		Retries:        stats.retrySummary(),
+		Phases:         stats.phases.results(),
+		DeadlockReport: deadlocks.Report(),
+		Pool:           poolStats,
+		InitialStock:   initialTotalStock,
+		ExpectedStock:  expectedTotalStock,
+		ActualStock:    finalTotalStock,
+		Oversold:       oversold,
+	}
+	if locks != nil {
+		result.LockWaits = locks.summary()
+	}
+	if browse != nil {
+		result.Browse = browse.summary()
+	}
+	if lag != nil {
+		result.ReplicaLag = lag.summary()
+	}
+	result.Failover = failoverSummary
+	if scenario != nil {
+		result.Scenario = scenario.results()
+	}
+	if reads != nil {
+		result.Reads = reads.summary()
+	}
+	if sale != nil {
+		result.Sale = sale.summary()
+	}
+	if arrivals != nil {
+		result.OpenLoop = arrivals.summary()
+	}
+	result.Refunds = refundSummary
+	result.Restocks = restockSummary
+	if idempotent != nil {
+		result.Idempotency = idempotent.summary()
+	}
+	if slow != nil {
+		result.SlowTrace = slow.summary()
+	}
+	if cfg.RecordOrders {
+		orders, units, err := countOrders(ctx, db)
+		if err != nil {
+			return nil, err
+		}
+		result.Orders = &OrdersSummary{Orders: orders - ordersBefore, Units: units - orderedUnitsBefore, StockTaken: initialTotalStock - finalTotalStock}
+		if restockSummary != nil {
+			result.Orders.StockTaken += restockSummary.Units
+		}
+	}
+	if users != nil {
+		if result.Users, err = users.summary(ctx, db, stats.rejected.Load()); err != nil {
+			return nil, err
+		}
+	}
+	if gateway != nil {
+		gateway.finish(ctx, result)
+	}
+	return result, nil
+}
+
+// newRetrier returns the ConflictRetrier that retries the purchases of strat
+// failing with a conflict cfg's database expects, or nil if there is none.
+func newRetrier(cfg Config, strat strategy.Strategy) *strategy.ConflictRetrier {
+	switch {
+	case cfg.RetryLocks:
+		// Write conflicts are among the lock conflicts, whatever -txn-mode.
+		return &strategy.ConflictRetrier{Strategy: strat, MaxRetries: cfg.MaxRetries, IsConflict: schema.IsLockConflict, BackoffBase: cfg.BackoffBase, BackoffMax: cfg.BackoffMax}
+	case cfg.TxnMode != "":
+		return &strategy.ConflictRetrier{Strategy: strat, MaxRetries: cfg.MaxRetries, IsConflict: schema.IsTiDBWriteConflict}
+	case cfg.Driver == "cockroach" && cfg.Strategy != "crdb":
+		// The crdb strategy retries inside its transaction; everything else
+		// is retried as a whole.
+		return &strategy.ConflictRetrier{Strategy: strat, MaxRetries: cfg.MaxRetries, IsConflict: schema.IsSerializationFailure}
+	case cfg.Driver == "vitess":
+		return &strategy.ConflictRetrier{Strategy: strat, MaxRetries: cfg.MaxRetries, IsConflict: schema.IsVitessRetryable}
+	}
+	return nil
+}
+
+// hottest returns at most n of the most purchased products.
+func (r *Result) hottest(n int) []ProductResult {
+	n = max(n, 0)
+	if len(r.Products) > n {
+		return r.Products[:n]
+	}
+	return r.Products
+}
+
+// printHotProducts prints a table of per-product contention.
+func printHotProducts(products []ProductResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRODUCT\tATTEMPTS\tSHARE\tOK\tSOLD OUT\tAVG LATENCY")
+	for _, p := range products {
+		fmt.Fprintf(w, "%d\t%d\t%.1f%%\t%d\t%d\t%v\n", p.ID, p.Attempts, 100*p.Share, p.Succeeded, p.SoldOut, p.AvgLatency.Round(time.Microsecond))
+	}
+	w.Flush()
+}
+
+// printSummary prints the outcome of a single run.
+func printSummary(cfg Config, r *Result) {
+	fmt.Println("-----------------------------------------")
+	fmt.Printf("Products:             %d\n", cfg.NumProducts)
+	fmt.Printf("Initial Total Stock:  %d\n", r.InitialStock)
+	fmt.Printf("Expected Total Stock: %d\n", r.ExpectedStock)
+	fmt.Printf("Actual Total Stock:   %d\n", r.ActualStock)
+	if len(r.Oversold) > 0 {
+		fmt.Printf("Oversold products:    %s\n", formatOversold(r.Oversold))
+	}
+	fmt.Println("-----------------------------------------")
+	fmt.Printf("Elapsed:              %v\n", r.Elapsed.Round(time.Millisecond))
+	if r.Interrupted {
+		fmt.Println("Interrupted:          yes, the purchases completed so far")
+	}
+	fmt.Printf("Purchases:            %d ok, %d sold out, %d failed\n", r.Succeeded, r.SoldOut, r.Failed)
+	if len(r.Errors) > 0 {
+		fmt.Printf("Failures:             %s\n", formatErrors(r.Errors))
+	}
+	if r.Retries.Total > 0 || r.Retries.Abandoned > 0 {
+		fmt.Printf("Retries:              %d total, %d purchases retried, %d abandoned\n", r.Retries.Total, r.Retries.Retried, r.Retries.Abandoned)
+		fmt.Printf("Retries per success:  %s\n", formatRetryDistribution(r.Retries.PerSuccess))
+	}
+	fmt.Printf("Throughput:           %.1f purchases/s\n", r.Throughput())
+	if cfg.TargetQPS > 0 && r.Elapsed > 0 {
+		fmt.Printf("Offered load:         %.1f attempts/s (target %.1f)\n", float64(r.Attempts)/r.Elapsed.Seconds(), cfg.TargetQPS)
+	}
+	fmt.Printf("Worker throughput:    min %.1f, avg %.1f, max %.1f attempts/s\n", r.Workers.MinTPS, r.Workers.AvgTPS, r.Workers.MaxTPS)
+	fmt.Printf("Worker failures:      min %d, avg %.1f, max %d\n", r.Workers.MinFailed, r.Workers.AvgFailed, r.Workers.MaxFailed)
+	if len(r.Workers.Stragglers) > 0 {
+		fmt.Printf("Stragglers:           %s\n", formatStragglers(r.Workers.Stragglers))
+	}
+	fmt.Printf("Latency p50:          %v\n", r.Latency.P50)
+	fmt.Printf("Latency p90:          %v\n", r.Latency.P90)
+	fmt.Printf("Latency p95:          %v\n", r.Latency.P95)
+	fmt.Printf("Latency p99:          %v\n", r.Latency.P99)
+	fmt.Printf("Latency max:          %v\n", r.Latency.Max)
+	if o := r.OpenLoop; o != nil {
+		fmt.Printf("Arrivals:             %d at %.1f/s (Poisson), backlog up to %d\n", o.Arrivals, o.Rate, o.MaxBacklog)
+		fmt.Printf("Queue wait:           p50 %v, p99 %v, max %v\n", o.QueueWait.P50, o.QueueWait.P99, o.QueueWait.Max)
+	}
+	if u := r.Users; u != nil {
+		fmt.Printf("Users:                %d, %d bought (%d orders, %d units)\n", u.Users, u.Buyers, u.Orders, u.OrderedUnits)
+		fmt.Printf("Duplicates rejected:  %d\n", u.Rejected)
+	}
+	if o := r.Orders; o != nil {
+		fmt.Printf("Orders recorded:      %d (%d units, stock took %d)\n", o.Orders, o.Units, o.StockTaken)
+	}
+	if i := r.Idempotency; i != nil {
+		fmt.Printf("Idempotent retries:   %d ambiguous, %d duplicates prevented\n", i.Retries, i.DuplicatesPrevented)
+	}
+	if s := r.SlowTrace; s != nil {
+		fmt.Printf("Slow purchases:       %d over %v, %d logged\n", s.Slow, s.Threshold, s.Logged)
+	}
+	if s := r.Restocks; s != nil {
+		fmt.Printf("Restocks:             %d applied (%d units), %d skipped\n", len(s.Applied), s.Units, s.Skipped)
+		for _, e := range s.Applied {
+			fmt.Printf("  %-20s applied at %v, took %v\n", fmt.Sprintf("+%d@%v:", e.Units, e.At), e.AppliedAt.Round(time.Millisecond), e.Took.Round(time.Microsecond))
+		}
+	}
+	if f := r.Refunds; f != nil {
+		fmt.Printf("Cancellations:        %d refunded (%d units), %d failed, %.0f%% of purchases after %v\n", f.Refunds, f.RefundedUnits, f.Failed, f.Ratio*100, f.After)
+		fmt.Printf("Refund latency:       p50 %v, p99 %v, max %v\n", f.Latency.P50, f.Latency.P99, f.Latency.Max)
+	}
+	if s := r.Sale; s != nil {
+		fmt.Printf("Sale opened:          %s, workers started within %v (jitter %v)\n", s.Open.Format(time.RFC3339Nano), s.Spread.Round(time.Microsecond), s.Jitter)
+		fmt.Printf("First second:         %d ok, %d sold out, %d failed of %d attempts\n", s.Succeeded, s.SoldOut, s.Failed, s.Attempts)
+		fmt.Printf("First second latency: p50 %v, p99 %v, max %v\n", s.Latency.P50, s.Latency.P99, s.Latency.Max)
+	}
+	if m := r.Reads; m != nil {
+		fmt.Printf("Reads:                %d ok, %d failed (%.0f%% of operations)\n", m.Reads, m.Failed, m.Ratio*100)
+		fmt.Printf("Read latency:         p50 %v, p99 %v, max %v\n", m.Latency.P50, m.Latency.P99, m.Latency.Max)
+	}
+	fmt.Println("-----------------------------------------")
+	if len(r.Phases) > 0 {
+		printPhases(r.Phases)
+		fmt.Println("-----------------------------------------")
+	}
+	if cfg.Driver != "none" {
+		fmt.Printf("Pool waits:           %d waits, %v total, p50 %v, p99 %v, max %v\n", r.Pool.WaitCount, r.Pool.WaitDuration.Round(time.Millisecond), r.Pool.Wait.P50, r.Pool.Wait.P99, r.Pool.Wait.Max)
+		fmt.Printf("Pool connections:     max %d in use, avg %.1f in use, avg %.1f idle\n", r.Pool.MaxInUse, r.Pool.AvgInUse, r.Pool.AvgIdle)
+		fmt.Println("-----------------------------------------")
+	}
+	if l := r.LockWaits; l != nil {
+		fmt.Printf("Server lock waits:    max %d waiting, avg %.1f, longest wait %v (%d samples)\n", l.MaxWaiting, l.AvgWaiting, l.MaxWait, l.Samples)
+		fmt.Printf("Total lock wait:      ~%v\n", l.TotalWait)
+		fmt.Println("-----------------------------------------")
+	}
+	if len(r.Scenario) > 0 {
+		printScenario(r.Scenario)
+		fmt.Println("-----------------------------------------")
+	}
+	if len(r.Endpoints) > 1 {
+		printEndpoints(r.Endpoints)
+		fmt.Println("-----------------------------------------")
+	}
+	if b := r.Browse; b != nil {
+		fmt.Printf("Browse reads:         %d ok, %d failed, %.1f reads/s (%s, %d readers)\n", b.Reads, b.Failed, b.Throughput, b.Mode, b.Readers)
+		fmt.Printf("Browse latency:       p50 %v, p99 %v, max %v\n", b.Latency.P50, b.Latency.P99, b.Latency.Max)
+		fmt.Println("-----------------------------------------")
+	}
+	if f := r.Failover; f != nil {
+		fmt.Printf("Failover outages:     %d, %v down, errors for %v\n", len(f.Outages), f.Downtime.Round(time.Millisecond), f.ErrorSpike.Round(time.Millisecond))
+		if len(f.Outages) > 0 {
+			fmt.Printf("Outages:              %s\n", formatOutages(f.Outages))
+		}
+		fmt.Printf("Failover stock:       %d units confirmed, %d ambiguous, %d lost, %d double-sold\n", f.ConfirmedUnits, f.AmbiguousUnits, f.LostUnits, f.DoubleSoldUnits)
+		fmt.Println("-----------------------------------------")
+	}
+	if l := r.ReplicaLag; l != nil {
+		fmt.Printf("Replica lag:          %s behind in %d of %d samples, max %d units, avg %.1f units\n", l.Endpoint, l.Stale, l.Samples, l.MaxUnitsBehind, l.AvgUnitsBehind)
+		fmt.Printf("Replica staleness:    p50 %v, p99 %v, max %v\n", l.Lag.P50, l.Lag.P99, l.Lag.Max)
+		fmt.Println("-----------------------------------------")
+	}
+	if cfg.NumProducts > 1 && cfg.TopProducts > 0 {
+		printHotProducts(r.hottest(cfg.TopProducts))
+		fmt.Println("-----------------------------------------")
+	}
+
+	if r.DeadlockReport != "" {
+		fmt.Println("Latest deadlock:")
+		fmt.Println(r.DeadlockReport)
+		fmt.Println("-----------------------------------------")
+	}
+
+	if r.Consistent() {
+		slog.Info("✅ Test successful! Data is consistent.")
+	} else {
+		args := []any{"final_stock", r.ActualStock, "expected_stock", r.ExpectedStock}
+		if len(r.Oversold) > 0 {
+			args = append(args, "oversold_products", len(r.Oversold))
+		}
+		if o := r.Orders; o != nil {
+			args = append(args, "ordered_units", o.Units, "stock_taken", o.StockTaken)
+		}
+		slog.Error("❌ Test failed! Data is inconsistent.", args...)
+	}
+}
@@ -0,0 +1,158 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// saleOpen is the -sale-open flag: when a flash sale opens, either a delay
+// after the workers are ready ("10s") or an RFC 3339 instant, so that
+// several machines can open the same sale together.
+type saleOpen struct {
+	After time.Duration
+	At    time.Time
+}
+
+func (o *saleOpen) String() string {
+	if !o.At.IsZero() {
+		return o.At.Format(time.RFC3339Nano)
+	}
+	if o.After > 0 {
+		return o.After.String()
+	}
+	return ""
+}
+
+func (o *saleOpen) Set(s string) error {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		*o = saleOpen{After: d}
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("invalid sale opening %q (want a duration or an RFC 3339 time)", s)
+	}
+	*o = saleOpen{At: t}
+	return nil
+}
+
+// MarshalText encodes the opening the way it is written on the command line.
+func (o saleOpen) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an opening written by MarshalText.
+func (o *saleOpen) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*o = saleOpen{}
+		return nil
+	}
+	return o.Set(string(text))
+}
+
+func (o saleOpen) isZero() bool {
+	return o.After == 0 && o.At.IsZero()
+}
+
+// SaleSummary describes the thundering herd at the opening of -sale-open:
+// the purchases that started within its first second, and how far apart the
+// workers' first purchases started.
+type SaleSummary struct {
+	Open   time.Time
+	Jitter time.Duration
+	Spread time.Duration // from the opening to the last worker's first purchase
+
+	Attempts  int64
+	Succeeded int64
+	SoldOut   int64
+	Failed    int64
+	Latency   LatencySummary
+}
+
+// saleBarrier holds every worker until the sale opens, then lets them all go
+// at once, each after its own jitter.
+type saleBarrier struct {
+	open   time.Time
+	jitter time.Duration
+	gate   chan struct{}
+
+	attempts  atomic.Int64
+	succeeded atomic.Int64
+	soldOut   atomic.Int64
+	failed    atomic.Int64
+	latency   Histogram
+
+	mu     sync.Mutex
+	spread time.Duration
+}
+
+func newSaleBarrier(cfg Config) *saleBarrier {
+	open := cfg.SaleOpen.At
+	if open.IsZero() {
+		open = time.Now().Add(cfg.SaleOpen.After)
+	}
+	return &saleBarrier{open: open, jitter: cfg.SaleJitter, gate: make(chan struct{})}
+}
+
+// wait blocks a worker until the sale opens and its jitter, drawn from rng,
+// has passed, and reports whether ctx allowed it to.
+func (b *saleBarrier) wait(ctx context.Context, rng *rand.Rand) bool {
+	select {
+	case <-b.gate:
+	case <-ctx.Done():
+		return false
+	}
+	if b.jitter > 0 && strategy.SleepContext(ctx, time.Duration(rng.Int63n(int64(b.jitter)))) != nil {
+		return false
+	}
+	b.mu.Lock()
+	b.spread = max(b.spread, time.Since(b.open))
+	b.mu.Unlock()
+	return true
+}
+
+// release opens the sale at its time, once every worker is waiting.
+func (b *saleBarrier) release(ctx context.Context) {
+	strategy.SleepContext(ctx, time.Until(b.open))
+	close(b.gate)
+}
+
+// record accounts for a purchase that started at begin, if that was within
+// the first second of the sale.
+func (b *saleBarrier) record(begin time.Time, err error, d time.Duration) {
+	if begin.Sub(b.open) >= time.Second {
+		return
+	}
+	b.attempts.Add(1)
+	switch {
+	case err == nil:
+		b.succeeded.Add(1)
+	case errors.Is(err, strategy.ErrSoldOut):
+		b.soldOut.Add(1)
+	default:
+		b.failed.Add(1)
+	}
+	b.latency.Record(d)
+}
+
+func (b *saleBarrier) summary() *SaleSummary {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &SaleSummary{
+		Open:      b.open,
+		Jitter:    b.jitter,
+		Spread:    b.spread,
+		Attempts:  b.attempts.Load(),
+		Succeeded: b.succeeded.Load(),
+		SoldOut:   b.soldOut.Load(),
+		Failed:    b.failed.Load(),
+		Latency:   b.latency.Summary(),
+	}
+}
@@ -0,0 +1,260 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// Scenario is a sequence of phases, such as warm-up, spike, sustained load
+// and drain, that one run goes through against the same stock. It is read
+// from the JSON file of -scenario, and -ramp is a scenario as well:
+//
+//	{"phases": [
+//	  {"name": "warm-up", "concurrency": 10, "duration": "30s"},
+//	  {"name": "spike", "concurrency": 500, "distribution": "hotspot:0.9", "duration": "10s"},
+//	  {"name": "sustained", "concurrency": 100, "target_qps": 2000, "duration": "2m"},
+//	  {"name": "drain", "concurrency": 5, "duration": "30s"}
+//	]}
+type Scenario struct {
+	Phases []ScenarioPhase `json:"phases"`
+}
+
+// ScenarioPhase is one phase of a Scenario. Concurrency defaults to
+// -concurrency and Distribution to -distribution; without TargetQPS the
+// phase runs flat out.
+type ScenarioPhase struct {
+	Name         string               `json:"name"`
+	Concurrency  int                  `json:"concurrency,omitempty"`
+	TargetQPS    float64              `json:"target_qps,omitempty"`
+	Distribution *ProductDistribution `json:"distribution,omitempty"`
+	Duration     time.Duration        `json:"-"`
+}
+
+func (p ScenarioPhase) MarshalJSON() ([]byte, error) {
+	type plain ScenarioPhase // without this method
+	return json.Marshal(struct {
+		plain
+		Duration string `json:"duration"`
+	}{plain(p), p.Duration.String()})
+}
+
+func (p *ScenarioPhase) UnmarshalJSON(data []byte) error {
+	type plain ScenarioPhase
+	var v struct {
+		plain
+		Duration string `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(v.Duration)
+	if err != nil {
+		return fmt.Errorf("phase %q: invalid duration %q", v.Name, v.Duration)
+	}
+	*p = ScenarioPhase(v.plain)
+	p.Duration = d
+	return nil
+}
+
+// loadScenario reads the scenario file of -scenario.
+func loadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// resolve fills in the defaults of every phase from cfg and checks them.
+func (s *Scenario) resolve(cfg Config) error {
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("the scenario has no phases")
+	}
+	for i := range s.Phases {
+		p := &s.Phases[i]
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("phase %d", i+1)
+		}
+		if p.Concurrency == 0 {
+			p.Concurrency = cfg.Concurrency
+		}
+		if p.Distribution == nil {
+			d := cfg.Distribution
+			p.Distribution = &d
+		}
+		if p.Concurrency < 1 || p.TargetQPS < 0 || p.Duration <= 0 {
+			return fmt.Errorf("phase %q needs a positive concurrency and duration, and a target QPS of 0 or more", p.Name)
+		}
+	}
+	return nil
+}
+
+// duration returns how long the scenario runs.
+func (s *Scenario) duration() time.Duration {
+	var d time.Duration
+	for _, p := range s.Phases {
+		d += p.Duration
+	}
+	return d
+}
+
+// maxConcurrency returns the most workers any phase runs.
+func (s *Scenario) maxConcurrency() int {
+	var n int
+	for _, p := range s.Phases {
+		n = max(n, p.Concurrency)
+	}
+	return n
+}
+
+// ScenarioPhaseResult summarizes the purchases made during one phase.
+type ScenarioPhaseResult struct {
+	Name         string
+	Concurrency  int
+	TargetQPS    float64
+	Distribution string
+	Duration     time.Duration
+	Attempts     int64
+	Succeeded    int64
+	Failed       int64
+	Throughput   float64 // successful purchases per second
+	Latency      LatencySummary
+}
+
+// scenarioPhaseStats counts the purchases of one scenario phase.
+type scenarioPhaseStats struct {
+	attempts  atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	latency   Histogram
+}
+
+// scenarioRunner moves a run through the phases of its scenario, starting
+// once the warm-up is over; the warm-up runs as the first phase. Workers
+// beyond the concurrency of the current phase idle.
+type scenarioRunner struct {
+	phases  []ScenarioPhase
+	pickers []*productPicker
+	limiter *rateLimiter
+
+	current atomic.Int64
+	stats   []scenarioPhaseStats
+}
+
+func newScenarioRunner(s *Scenario, numProducts int) *scenarioRunner {
+	r := &scenarioRunner{
+		phases:  s.Phases,
+		pickers: make([]*productPicker, len(s.Phases)),
+		limiter: newRateLimiter(s.Phases[0].TargetQPS),
+		stats:   make([]scenarioPhaseStats, len(s.Phases)),
+	}
+	for i, p := range s.Phases {
+		r.pickers[i] = newProductPicker(*p.Distribution, numProducts)
+	}
+	return r
+}
+
+// loop enters every phase at its time from start until the scenario or ctx
+// is done.
+func (r *scenarioRunner) loop(ctx context.Context, start time.Time) {
+	at := start
+	for i, p := range r.phases {
+		if strategy.SleepContext(ctx, time.Until(at)) != nil {
+			return
+		}
+		if p.TargetQPS > 0 {
+			r.limiter.SetRate(p.TargetQPS)
+		}
+		r.current.Store(int64(i))
+		at = at.Add(p.Duration)
+	}
+}
+
+func (r *scenarioRunner) phase() *ScenarioPhase {
+	return &r.phases[r.current.Load()]
+}
+
+// waitActive blocks while the worker idles in the current phase, until ctx
+// is done or deadline passes, and reports whether it may go on.
+func (r *scenarioRunner) waitActive(ctx context.Context, workerID int, deadline time.Time) bool {
+	for workerID > r.phase().Concurrency {
+		if time.Now().After(deadline) || strategy.SleepContext(ctx, 10*time.Millisecond) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// pace waits for the current phase's target QPS, if it has one.
+func (r *scenarioRunner) pace(ctx context.Context) error {
+	if r.phase().TargetQPS == 0 {
+		return ctx.Err()
+	}
+	return r.limiter.Wait(ctx)
+}
+
+// pick returns the product of the next purchase in the current phase.
+func (r *scenarioRunner) pick(rng *rand.Rand) int {
+	return r.pickers[r.current.Load()].Pick(rng)
+}
+
+// record accounts for a purchase made after the warm-up.
+func (r *scenarioRunner) record(err error, d time.Duration) {
+	s := &r.stats[r.current.Load()]
+	s.attempts.Add(1)
+	switch {
+	case err == nil:
+		s.succeeded.Add(1)
+	case !errors.Is(err, strategy.ErrSoldOut):
+		s.failed.Add(1)
+	}
+	s.latency.Record(d)
+}
+
+func (r *scenarioRunner) results() []ScenarioPhaseResult {
+	results := make([]ScenarioPhaseResult, len(r.phases))
+	for i, p := range r.phases {
+		s := &r.stats[i]
+		results[i] = ScenarioPhaseResult{
+			Name:         p.Name,
+			Concurrency:  p.Concurrency,
+			TargetQPS:    p.TargetQPS,
+			Distribution: p.Distribution.String(),
+			Duration:     p.Duration,
+			Attempts:     s.attempts.Load(),
+			Succeeded:    s.succeeded.Load(),
+			Failed:       s.failed.Load(),
+			Throughput:   float64(s.succeeded.Load()) / p.Duration.Seconds(),
+			Latency:      s.latency.Summary(),
+		}
+	}
+	return results
+}
+
+// printScenario prints a table of how each phase fared.
+func printScenario(phases []ScenarioPhaseResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PHASE\tWORKERS\tTARGET QPS\tDISTRIBUTION\tDURATION\tATTEMPTS\tOK\tFAILED\tTPS\tP50\tP99")
+	for _, p := range phases {
+		qps := "-"
+		if p.TargetQPS > 0 {
+			qps = fmt.Sprintf("%.0f", p.TargetQPS)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%v\t%d\t%d\t%d\t%.1f\t%v\t%v\n", p.Name, p.Concurrency, qps, p.Distribution, p.Duration,
+			p.Attempts, p.Succeeded, p.Failed, p.Throughput, p.Latency.P50, p.Latency.P99)
+	}
+	w.Flush()
+}
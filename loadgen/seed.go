@@ -0,0 +1,23 @@
+package loadgen
+
+import (
+	"math/rand"
+)
+
+// Random streams of a run besides the workers', which use their worker IDs
+// 1 to -concurrency.
+const (
+	arrivalStream = 0
+	browseStream  = -1 // minus the browse reader index
+)
+
+// newStream returns the random number generator of one stream of a run with
+// the given -seed. Each worker draws its products, quantities, users, pauses
+// and jitter from a stream of its own, which its purchases carry for the
+// strategy to draw from too, so that it makes the same choices in every run
+// with the same seed however the workers interleave. The streams are not safe
+// for concurrent use.
+func newStream(seed int64, stream int) *rand.Rand {
+	// Spread neighbouring streams apart, as a splitmix64 step would.
+	return rand.New(rand.NewSource(seed ^ int64(uint64(stream)*0x9e3779b97f4a7c15)))
+}
@@ -0,0 +1,218 @@
+package loadgen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"update_one_record/inventory"
+	"update_one_record/strategy"
+)
+
+// serveShutdownTimeout bounds how long Serve waits for purchases in flight
+// once ctx is done.
+const serveShutdownTimeout = 10 * time.Second
+
+// Serve buys through cfg.Strategy over HTTP on cfg.ServeAddr until ctx is
+// done, so that the deduction logic can be load-tested end to end through
+// an API tier by tools such as wrk or k6. Every POST /buy/{productID} is one
+// purchase of the stock left by Init, of ?quantity= units (default 1) and,
+// with cfg.Users, for the user ?user=. It answers 200 for a purchase, 409
+// when the product is sold out or the user bought it already, and 503 when
+// it failed. With cfg.Idempotency, a client retrying a request with the
+// Idempotency-Key header of one that was applied gets 200 again without
+// buying twice. Purchases are spread over the writer endpoints in turn. With
+// cfg.GRPCAddr, the gRPC inventory.Server is served there too, buying from
+// the first writer; its purchases count only towards the final stock. The
+// control API of runController lets orchestration start, follow and abort
+// runs on the same address.
+func Serve(ctx context.Context, cfg Config) error {
+	runs := newRunController(ctx, cfg)
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer s.close(ctx)
+	endpoints, _ := splitEndpoints(s.endpoints)
+	db := endpoints[0].DB
+	strat, err := strategy.New(cfg.Strategy, &cfg.Config)
+	if err != nil {
+		return err
+	}
+	if c, ok := strat.(io.Closer); ok {
+		defer c.Close()
+	}
+	if _, standalone := strat.(strategy.Seeder); db == nil && !standalone {
+		return fmt.Errorf("strategy %s needs a SQL database, it cannot run with -driver none", cfg.Strategy)
+	}
+	if err := checkRecordsOrders(cfg, strat); err != nil {
+		return err
+	}
+	if st, ok := strat.(strategy.Starter); ok {
+		if err := st.Start(ctx, db); err != nil {
+			return fmt.Errorf("start strategy %s: %w", cfg.Strategy, err)
+		}
+	}
+	initialTotalStock, err := totalStock(ctx, db, strat)
+	if err != nil {
+		return fmt.Errorf("query initial total stock: %w", err)
+	}
+
+	h := &purchaseHandler{cfg: cfg, endpoints: endpoints, purchaser: strat}
+	if r := newRetrier(cfg, strat); r != nil {
+		h.purchaser = r
+	}
+	var idempotent *idempotentPurchaser
+	if cfg.Idempotency {
+		idempotent = &idempotentPurchaser{Strategy: h.purchaser, cfg: cfg}
+		h.purchaser = idempotent
+	}
+	if cfg.Users > 0 {
+		h.purchaser = &userLimiter{Strategy: h.purchaser, users: cfg.Users, recorded: cfg.RecordOrders}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /buy/{productID}", h)
+	runs.register(mux)
+	srv := &http.Server{Handler: mux}
+
+	errc := make(chan error, 2)
+	ln, err := net.Listen("tcp", cfg.ServeAddr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Serving purchases", "addr", ln.Addr().String(), "strategy", cfg.Strategy, "products", cfg.NumProducts, "total_stock", initialTotalStock)
+	go func() { errc <- srv.Serve(ln) }()
+	var gs *grpc.Server
+	if cfg.GRPCAddr != "" {
+		gln, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			srv.Close()
+			return err
+		}
+		gs = grpc.NewServer()
+		inventory.Register(gs, &inventory.Server{Strategy: strat, Purchaser: h.purchaser, DB: db, NumProducts: cfg.NumProducts})
+		slog.Info("Serving InventoryService", "addr", gln.Addr().String(), "service", inventory.ServiceName)
+		go func() { errc <- gs.Serve(gln) }()
+	}
+	select {
+	case err := <-errc:
+		srv.Close()
+		if gs != nil {
+			gs.Stop()
+		}
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), serveShutdownTimeout)
+	defer cancel()
+	if gs != nil {
+		gs.GracefulStop()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain purchases", "err", err)
+	}
+
+	runs.wait()
+
+	if st, ok := strat.(strategy.Stopper); ok {
+		if err := st.Stop(shutdownCtx); err != nil {
+			slog.Error("Failed to stop strategy", "strategy", cfg.Strategy, "err", err)
+		}
+	}
+	finalTotalStock, err := totalStock(shutdownCtx, db, strat)
+	if err != nil {
+		return fmt.Errorf("query final total stock: %w", err)
+	}
+	args := []any{"succeeded", h.succeeded.Load(), "sold_out", h.soldOut.Load(), "failed", h.failed.Load(), "units_sold", h.unitsSold.Load(), "initial_stock", initialTotalStock, "final_stock", finalTotalStock}
+	if idempotent != nil {
+		// Purchases found applied succeed again without taking stock.
+		s := idempotent.summary()
+		args = append(args, "ambiguous_retries", s.Retries, "duplicates_prevented", s.DuplicatesPrevented)
+	}
+	slog.Info("Stopped serving", args...)
+	return nil
+}
+
+// purchaseHandler serves POST /buy/{productID}.
+type purchaseHandler struct {
+	cfg       Config
+	endpoints []Endpoint
+	purchaser strategy.Strategy
+
+	next      atomic.Uint64 // endpoint of the next purchase
+	succeeded atomic.Int64
+	soldOut   atomic.Int64
+	failed    atomic.Int64
+	unitsSold atomic.Int64
+}
+
+// purchaseResponse is the JSON body of a purchase response.
+type purchaseResponse struct {
+	ProductID int    `json:"product_id"`
+	Quantity  int64  `json:"quantity"`
+	UserID    int    `json:"user_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (h *purchaseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	order, err := h.parseOrder(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	e := h.endpoints[(h.next.Add(1)-1)%uint64(len(h.endpoints))]
+	resp := purchaseResponse{ProductID: order.ProductID, Quantity: order.Quantity, UserID: order.UserID}
+	status := http.StatusOK
+	err = h.purchaser.Purchase(r.Context(), e.DB, order)
+	switch {
+	case err == nil:
+		h.succeeded.Add(1)
+		h.unitsSold.Add(order.Quantity)
+	case errors.Is(err, strategy.ErrSoldOut), errors.Is(err, strategy.ErrAlreadyPurchased):
+		h.soldOut.Add(1)
+		status, resp.Error = http.StatusConflict, err.Error()
+	default:
+		h.failed.Add(1)
+		slog.Debug("Purchase failed", "product", order.ProductID, "endpoint", e.Name, "err", err, "class", strategy.ErrorClass(err))
+		status, resp.Error = http.StatusServiceUnavailable, strategy.ErrorClass(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseOrder reads the order of a purchase request.
+func (h *purchaseHandler) parseOrder(r *http.Request) (strategy.Order, error) {
+	var order strategy.Order
+	id, err := strconv.Atoi(r.PathValue("productID"))
+	if err != nil || id < 1 || id > h.cfg.NumProducts {
+		return order, fmt.Errorf("product ID must be between 1 and %d", h.cfg.NumProducts)
+	}
+	order.ProductID, order.Quantity = id, 1
+	if q := r.URL.Query().Get("quantity"); q != "" {
+		if order.Quantity, err = strconv.ParseInt(q, 10, 64); err != nil || order.Quantity < 1 {
+			return order, errors.New("quantity must be a positive integer")
+		}
+	}
+	if h.cfg.Users > 0 {
+		if order.UserID, err = strconv.Atoi(r.URL.Query().Get("user")); err != nil || order.UserID < 1 || order.UserID > h.cfg.Users {
+			return order, fmt.Errorf("user must be between 1 and %d", h.cfg.Users)
+		}
+	}
+	if h.cfg.Idempotency {
+		if order.Key = r.Header.Get("Idempotency-Key"); len(order.Key) > maxIdempotencyKeyLen {
+			return order, fmt.Errorf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLen)
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,100 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// Init creates the tables of cfg and of its strategy with fresh stock, or
+// seeds the store of a strategy.Seeder, for runs with SkipInit to buy from.
+// The orders table that -users needs is created too.
+func Init(ctx context.Context, cfg Config) error {
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer s.close(ctx)
+	strat, err := strategy.New(cfg.Strategy, &cfg.Config)
+	if err != nil {
+		return err
+	}
+	if _, standalone := strat.(strategy.Seeder); cfg.Driver == "none" && !standalone {
+		return fmt.Errorf("strategy %s needs a SQL database, it cannot run with -driver none", cfg.Strategy)
+	}
+	return initStock(ctx, s.endpoints[0].DB, cfg, strat, true)
+}
+
+// Clean drops the products and orders tables and those that strategies
+// leave behind.
+func Clean(ctx context.Context, cfg Config) error {
+	if cfg.Driver == "none" {
+		return errors.New("clean drops SQL tables; it cannot run with -driver none")
+	}
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	defer s.close(ctx)
+	db := s.endpoints[0].DB
+	if err := schema.Drop(ctx, db); err != nil {
+		return err
+	}
+	for _, name := range strategy.Names() {
+		strat, err := strategy.New(name, &cfg.Config)
+		if err != nil {
+			return err
+		}
+		if c, ok := strat.(strategy.Cleaner); ok {
+			if err := c.Clean(ctx, db); err != nil {
+				return fmt.Errorf("clean strategy %s: %w", name, err)
+			}
+		}
+	}
+	slog.Info("Dropped the benchmark tables")
+	return nil
+}
+
+// initStock gives every product cfg.Stock units, in the products table or
+// the store of a strategy.Seeder, along with the tables of a
+// strategy.Initializer, and creates the orders table if orders is set.
+func initStock(ctx context.Context, db *sql.DB, cfg Config, strat strategy.Strategy, orders bool) error {
+	if seeder, ok := strat.(strategy.Seeder); ok {
+		slog.Info("Seeding stock", "products", cfg.NumProducts, "strategy", cfg.Strategy)
+		if err := seeder.Seed(ctx, cfg.NumProducts, cfg.Stock); err != nil {
+			return fmt.Errorf("seed strategy %s: %w", cfg.Strategy, err)
+		}
+		if db == nil || !orders {
+			return nil
+		}
+		return schema.CreateOrders(ctx, db, cfg.Dialect())
+	}
+	if err := schema.Init(ctx, db, cfg.Dialect(), cfg.Vitess.Vindex, cfg.NumProducts, cfg.Stock); err != nil {
+		return err
+	}
+	if i, ok := strat.(strategy.Initializer); ok {
+		if err := i.Init(ctx, db); err != nil {
+			return fmt.Errorf("init strategy %s: %w", cfg.Strategy, err)
+		}
+	}
+	if orders {
+		return schema.CreateOrders(ctx, db, cfg.Dialect())
+	}
+	return nil
+}
+
+// totalStock returns the stock left over all products, from the strategy if
+// it is a strategy.StockCounter.
+func totalStock(ctx context.Context, db *sql.DB, strat strategy.Strategy) (int64, error) {
+	if c, ok := strat.(strategy.StockCounter); ok {
+		return c.TotalStock(ctx, db)
+	}
+	var total int64
+	err := db.QueryRowContext(ctx, "SELECT SUM(count) FROM products").Scan(&total)
+	return total, err
+}
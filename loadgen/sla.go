@@ -0,0 +1,84 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrThresholdViolated is returned for a run that broke an -max-p99,
+// -min-tps or -max-error-rate threshold or left inconsistent stock.
+var ErrThresholdViolated = errors.New("threshold violated")
+
+// ErrInconsistent is the ErrThresholdViolated of a run or verify that found
+// inconsistent stock, lost updates or overselling, whatever other
+// thresholds it broke.
+var ErrInconsistent = fmt.Errorf("%w: inconsistent stock", ErrThresholdViolated)
+
+// thresholdError returns the error of r once it broke a threshold.
+func thresholdError(r *Result) error {
+	if !r.Consistent() {
+		return ErrInconsistent
+	}
+	return ErrThresholdViolated
+}
+
+// percentValue is a fraction flag accepting either "1%" or "0.01".
+type percentValue float64
+
+func (p *percentValue) String() string {
+	return strconv.FormatFloat(float64(*p)*100, 'f', -1, 64) + "%"
+}
+
+func (p *percentValue) Set(s string) error {
+	scale := 1.0
+	if v, ok := strings.CutSuffix(s, "%"); ok {
+		s, scale = v, 0.01
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %q", s)
+	}
+	*p = percentValue(f * scale)
+	return nil
+}
+
+func (p percentValue) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *percentValue) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// Thresholds are the SLA limits a run is checked against; zero values are
+// not checked.
+type Thresholds struct {
+	MaxP99       time.Duration `json:"max_p99"`
+	MinTPS       float64       `json:"min_tps"`
+	MaxErrorRate percentValue  `json:"max_error_rate"`
+}
+
+// violations returns a description of every threshold r breaks, including an
+// inconsistent final stock or an oversold product.
+func (t Thresholds) violations(r *Result) []string {
+	var v []string
+	if t.MaxP99 > 0 && r.Latency.P99 > t.MaxP99 {
+		v = append(v, fmt.Sprintf("p99 latency %v exceeds %v", r.Latency.P99, t.MaxP99))
+	}
+	if t.MinTPS > 0 && r.Throughput() < t.MinTPS {
+		v = append(v, fmt.Sprintf("throughput %.1f tps is below %.1f", r.Throughput(), t.MinTPS))
+	}
+	if t.MaxErrorRate > 0 && r.ErrorRate() > float64(t.MaxErrorRate) {
+		v = append(v, fmt.Sprintf("error rate %.2f%% exceeds %s", r.ErrorRate()*100, t.MaxErrorRate.String()))
+	}
+	switch {
+	case len(r.Oversold) > 0:
+		v = append(v, fmt.Sprintf("%d products oversold: %s", len(r.Oversold), formatOversold(r.Oversold)))
+	case !r.Consistent():
+		v = append(v, fmt.Sprintf("final stock %d does not match the expected %d", r.ActualStock, r.ExpectedStock))
+	}
+	return v
+}
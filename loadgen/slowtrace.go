@@ -0,0 +1,120 @@
+package loadgen
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// SlowTraceSummary counts the purchases of -trace-slow slower than its
+// threshold, and how many of them were logged.
+type SlowTraceSummary struct {
+	Threshold time.Duration
+	Slow      int64
+	Logged    int64
+}
+
+// slowTracer logs the purchases slower than -trace-slow with everything
+// they ran, so that a client-side outlier can be matched with what the
+// server logged around the same time. At most rate purchases are logged a
+// second; the rest are only counted, so that a stall does not flood the
+// log.
+type slowTracer struct {
+	threshold time.Duration
+	rate      int
+
+	mu     sync.Mutex
+	second time.Time // of the purchases logged in it
+	inSec  int
+
+	slow   atomic.Int64
+	logged atomic.Int64
+}
+
+func newSlowTracer(cfg Config) *slowTracer {
+	return &slowTracer{threshold: cfg.TraceSlow, rate: cfg.TraceSlowRate}
+}
+
+// allow reports whether another slow purchase may be logged at now.
+func (t *slowTracer) allow(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if sec := now.Truncate(time.Second); !sec.Equal(t.second) {
+		t.second, t.inSec = sec, 0
+	}
+	if t.inSec >= t.rate {
+		return false
+	}
+	t.inSec++
+	return true
+}
+
+// observe logs the purchase traced by pt if it took longer than the
+// threshold, d in all. wait is the part of d it spent queued for a worker.
+func (t *slowTracer) observe(pt *purchaseTrace, workerID int, order strategy.Order, begin time.Time, d, wait time.Duration, retries int64, err error) {
+	if d <= t.threshold {
+		return
+	}
+	t.slow.Add(1)
+	if !t.allow(time.Now()) {
+		return
+	}
+	t.logged.Add(1)
+	phases, statements := pt.format()
+	args := []any{"latency", d, "started_at", begin.UTC().Format(time.RFC3339Nano), "worker", workerID,
+		"product", order.ProductID, "quantity", order.Quantity, "retries", retries, "phases", phases, "sql", statements}
+	if wait > 0 {
+		args = append(args, "queue_wait", wait)
+	}
+	if err != nil {
+		args = append(args, "err", err, "class", strategy.ErrorClass(err))
+	}
+	slog.Warn("Slow purchase", args...)
+}
+
+func (t *slowTracer) summary() *SlowTraceSummary {
+	return &SlowTraceSummary{Threshold: t.threshold, Slow: t.slow.Load(), Logged: t.logged.Load()}
+}
+
+// purchaseTrace collects the phases and statements of one purchase, as its
+// strategy.PhaseRecorder and schema.StatementRecorder. It passes the phases
+// on to the run's recorder, nil during the warm-up.
+type purchaseTrace struct {
+	phases strategy.PhaseRecorder
+
+	mu         sync.Mutex
+	steps      []string
+	statements []string
+}
+
+func (pt *purchaseTrace) RecordPhase(phase string, d time.Duration) {
+	if pt.phases != nil {
+		pt.phases.RecordPhase(phase, d)
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.steps = append(pt.steps, fmt.Sprintf("%s=%v", phase, d))
+}
+
+func (pt *purchaseTrace) RecordStatement(stmt string, d time.Duration, err error) {
+	s := fmt.Sprintf("%s [%v]", stmt, d)
+	if err != nil {
+		s = fmt.Sprintf("%s [%v: %v]", stmt, d, err)
+	}
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	pt.statements = append(pt.statements, s)
+}
+
+// format returns the phases and the statements of the purchase, in the
+// order they ran.
+func (pt *purchaseTrace) format() (phases, statements string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return strings.Join(pt.steps, " "), strings.Join(pt.statements, "; ")
+}
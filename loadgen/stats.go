@@ -0,0 +1,266 @@
+package loadgen
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/strategy"
+)
+
+// runStats collects the outcome of every purchase of a run. It is shared by
+// all workers.
+type runStats struct {
+	total     int64         // purchases the run will attempt
+	duration  time.Duration // how long a -duration run lasts instead
+	warmup    atomic.Int64  // purchases made during -warmup, not recorded
+	attempts  atomic.Int64
+	succeeded atomic.Int64
+	soldOut   atomic.Int64
+	rejected  atomic.Int64 // ErrAlreadyPurchased
+	failed    atomic.Int64
+	unitsSold atomic.Int64 // quantity of the successful purchases
+
+	retries           atomic.Int64
+	retried           atomic.Int64 // purchases retried at least once
+	abandoned         atomic.Int64
+	retriesPerSuccess [maxRetryBucket + 1]atomic.Int64
+
+	latencyTotal atomic.Int64 // nanoseconds
+	latency      Histogram
+	window       atomic.Pointer[Histogram] // latencies since the last tick
+	hdr          *hdrRecorder              // nil unless -hgrm or -hdr-log is set
+	phases       phaseStats
+	statsd       *statsdEmitter // nil unless -statsd is set
+
+	products  []productStats  // indexed by product ID - 1
+	workers   []workerStats   // indexed by worker ID - 1
+	endpoints []endpointStats // indexed by endpointIndex
+
+	mu     sync.Mutex
+	errors map[string]int64 // failures by ErrorClass
+}
+
+// productStats counts the purchases of a single product.
+type productStats struct {
+	attempts     atomic.Int64
+	succeeded    atomic.Int64
+	soldOut      atomic.Int64
+	latencyTotal atomic.Int64 // nanoseconds
+}
+
+func newRunStats(numProducts, numWorkers, numEndpoints int, total int64) *runStats {
+	s := &runStats{
+		total:     total,
+		products:  make([]productStats, numProducts),
+		workers:   make([]workerStats, numWorkers),
+		endpoints: make([]endpointStats, numEndpoints),
+	}
+	s.window.Store(new(Histogram))
+	return s
+}
+
+// record accounts for one purchase of order by a worker that returned err
+// after d and the given number of retries.
+func (s *runStats) record(workerID int, order strategy.Order, err error, d time.Duration, retries int64) {
+	p := &s.products[order.ProductID-1]
+	w := &s.workers[workerID-1]
+	e := &s.endpoints[endpointIndex(workerID, len(s.endpoints))]
+	s.attempts.Add(1)
+	p.attempts.Add(1)
+	w.attempts.Add(1)
+	e.attempts.Add(1)
+	p.latencyTotal.Add(int64(d))
+	e.latencyTotal.Add(int64(d))
+	s.retries.Add(retries)
+	if retries > 0 {
+		s.retried.Add(1)
+	}
+	switch {
+	case err == nil:
+		s.succeeded.Add(1)
+		s.retriesPerSuccess[min(retries, maxRetryBucket)].Add(1)
+		s.unitsSold.Add(order.Quantity)
+		p.succeeded.Add(1)
+		w.succeeded.Add(1)
+		e.succeeded.Add(1)
+	case errors.Is(err, strategy.ErrSoldOut):
+		s.soldOut.Add(1)
+		p.soldOut.Add(1)
+	case errors.Is(err, strategy.ErrAlreadyPurchased):
+		s.rejected.Add(1)
+	default:
+		s.failed.Add(1)
+		w.failed.Add(1)
+		e.failed.Add(1)
+		if errors.Is(err, strategy.ErrTooManyRetries) {
+			s.abandoned.Add(1)
+		}
+		s.mu.Lock()
+		if s.errors == nil {
+			s.errors = make(map[string]int64)
+		}
+		s.errors[strategy.ErrorClass(err)]++
+		s.mu.Unlock()
+	}
+	s.latencyTotal.Add(int64(d))
+	s.latency.Record(d)
+	s.window.Load().Record(d)
+	if s.hdr != nil {
+		s.hdr.record(d)
+	}
+	if s.statsd != nil {
+		s.statsd.record(order, err, d)
+	}
+}
+
+// retrySummary returns the retry counts of the run.
+func (s *runStats) retrySummary() RetrySummary {
+	sum := RetrySummary{Total: s.retries.Load(), Retried: s.retried.Load(), Abandoned: s.abandoned.Load()}
+	sum.PerSuccess = make([]int64, len(s.retriesPerSuccess))
+	for i := range s.retriesPerSuccess {
+		sum.PerSuccess[i] = s.retriesPerSuccess[i].Load()
+	}
+	return sum
+}
+
+// workerDone records that a worker finished after elapsed.
+func (s *runStats) workerDone(workerID int, elapsed time.Duration) {
+	s.workers[workerID-1].elapsed.Store(int64(elapsed))
+}
+
+// errorCounts returns a copy of the failures by error class.
+func (s *runStats) errorCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int64, len(s.errors))
+	for k, v := range s.errors {
+		counts[k] = v
+	}
+	return counts
+}
+
+// ProductResult summarizes the purchases of one product.
+type ProductResult struct {
+	ID        int
+	Attempts  int64
+	Succeeded int64
+	SoldOut   int64
+	Share     float64 // of all attempts
+	// AvgLatency is the mean purchase latency, which on a contended row is
+	// dominated by waiting for its lock.
+	AvgLatency time.Duration
+}
+
+// productResults returns the products that saw any purchase, hottest first.
+func (s *runStats) productResults() []ProductResult {
+	var results []ProductResult
+	total := s.attempts.Load()
+	for i := range s.products {
+		p := &s.products[i]
+		attempts := p.attempts.Load()
+		if attempts == 0 {
+			continue
+		}
+		results = append(results, ProductResult{
+			ID:         i + 1,
+			Attempts:   attempts,
+			Succeeded:  p.succeeded.Load(),
+			SoldOut:    p.soldOut.Load(),
+			Share:      float64(attempts) / float64(total),
+			AvgLatency: time.Duration(p.latencyTotal.Load() / attempts),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Attempts != results[j].Attempts {
+			return results[i].Attempts > results[j].Attempts
+		}
+		return results[i].ID < results[j].ID
+	})
+	return results
+}
+
+// tickSample is what the ticker observed over one interval.
+type tickSample struct {
+	Time       time.Time
+	Uptime     time.Duration
+	TPS        float64
+	OKRate     float64 // percent of attempts that succeeded
+	Errors     int64
+	AvgLatency time.Duration
+	P99        time.Duration
+
+	// Completed of Total purchases are done; ETA extrapolates the average
+	// rate so far to the rest. A -duration run has no Total but a Duration,
+	// and its ETA is the time left.
+	Completed, Total int64
+	Duration         time.Duration
+	ETA              time.Duration
+}
+
+// Progress returns the completed fraction of the run.
+func (s tickSample) Progress() float64 {
+	if s.Duration > 0 {
+		return min(float64(s.Uptime)/float64(s.Duration), 1)
+	}
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Completed) / float64(s.Total)
+}
+
+// tick hands a sample of the last interval to every sink until ctx is done.
+func (s *runStats) tick(ctx context.Context, interval time.Duration, sinks ...func(tickSample)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var lastCompleted, lastAttempts, lastSucceeded, lastFailed, lastLatency int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			attempts, succeeded, failed, latency := s.attempts.Load(), s.succeeded.Load(), s.failed.Load(), s.latencyTotal.Load()
+			completed := attempts + s.warmup.Load()
+			window := s.window.Swap(new(Histogram))
+
+			n := attempts - lastAttempts
+			sample := tickSample{
+				Time:   now,
+				Uptime: now.Sub(start),
+				TPS:    float64(completed-lastCompleted) / interval.Seconds(),
+				Errors: failed - lastFailed,
+				P99:    window.Percentile(0.99),
+
+				Completed: completed,
+				Total:     s.total,
+				Duration:  s.duration,
+			}
+			if s.duration > 0 {
+				sample.ETA = max(s.duration-sample.Uptime, 0).Round(time.Second)
+			} else if completed > 0 {
+				sample.ETA = time.Duration(float64(sample.Uptime) * float64(s.total-completed) / float64(completed)).Round(time.Second)
+			}
+			if n > 0 {
+				sample.OKRate = float64(succeeded-lastSucceeded) / float64(n) * 100
+				sample.AvgLatency = time.Duration((latency - lastLatency) / n)
+			}
+			for _, sink := range sinks {
+				sink(sample)
+			}
+			lastCompleted, lastAttempts, lastSucceeded, lastFailed, lastLatency = completed, attempts, succeeded, failed, latency
+		}
+	}
+}
+
+// logSample is the tick sink behind -tick.
+func logSample(s tickSample) {
+	slog.Info("Progress", "elapsed", s.Uptime.Round(time.Second), "tps", round1(s.TPS), "ok_pct", round1(s.OKRate),
+		"avg_latency", s.AvgLatency.Round(time.Microsecond), "p99", s.P99,
+		"progress_pct", round1(s.Progress()*100), "completed", s.Completed, "total", s.Total, "eta", s.ETA)
+}
@@ -0,0 +1,45 @@
+package loadgen
+
+import (
+	"errors"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"update_one_record/strategy"
+)
+
+// statsdEmitter sends every purchase to a StatsD/DogStatsD agent: its latency
+// as a timing and its outcome as a counter, tagged with the strategy and, for
+// failures, the error class.
+type statsdEmitter struct {
+	client *statsd.Client
+	tags   []string
+}
+
+func newStatsdEmitter(addr, prefix, strategy string) (*statsdEmitter, error) {
+	client, err := statsd.New(addr, statsd.WithNamespace(prefix))
+	if err != nil {
+		return nil, err
+	}
+	return &statsdEmitter{client: client, tags: []string{"strategy:" + strategy}}, nil
+}
+
+func (e *statsdEmitter) record(order strategy.Order, err error, d time.Duration) {
+	// The client buffers and sends asynchronously; drops are not worth
+	// failing a purchase over.
+	e.client.Timing("purchase.latency", d, e.tags, 1)
+	switch {
+	case err == nil:
+		e.client.Incr("purchase.ok", e.tags, 1)
+		e.client.Count("units.sold", order.Quantity, e.tags, 1)
+	case errors.Is(err, strategy.ErrSoldOut):
+		e.client.Incr("purchase.sold_out", e.tags, 1)
+	default:
+		e.client.Incr("purchase.failed", append(e.tags[:len(e.tags):len(e.tags)], "class:"+strategy.ErrorClass(err)), 1)
+	}
+}
+
+// Close flushes the buffered metrics.
+func (e *statsdEmitter) Close() error {
+	return e.client.Close()
+}
@@ -0,0 +1,52 @@
+package loadgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// thinkTime is the -think-time flag: how long a buyer pauses between
+// purchases, either a fixed duration ("200ms") or exponentially distributed
+// around a mean ("exp:200ms"), as independent buyers arrive.
+type thinkTime struct {
+	Mean        time.Duration
+	Exponential bool
+}
+
+func (t *thinkTime) String() string {
+	if t.Exponential {
+		return "exp:" + t.Mean.String()
+	}
+	return t.Mean.String()
+}
+
+func (t *thinkTime) Set(s string) error {
+	rest, exp := strings.CutPrefix(strings.TrimSpace(s), "exp:")
+	d, err := time.ParseDuration(rest)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid think time %q (want a duration or exp:duration)", s)
+	}
+	*t = thinkTime{Mean: d, Exponential: exp}
+	return nil
+}
+
+// MarshalText encodes the think time the way it is written on the command
+// line.
+func (t thinkTime) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText decodes a think time written by MarshalText.
+func (t *thinkTime) UnmarshalText(text []byte) error {
+	return t.Set(string(text))
+}
+
+// Pick returns the pause before the next purchase.
+func (t thinkTime) Pick(rng *rand.Rand) time.Duration {
+	if t.Exponential {
+		return time.Duration(rng.ExpFloat64() * float64(t.Mean))
+	}
+	return t.Mean
+}
@@ -0,0 +1,47 @@
+package loadgen
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"update_one_record/strategy"
+)
+
+// tracer creates the purchase spans. It is a no-op until setupTracing
+// installs an exporting provider.
+var tracer = otel.Tracer("update_one_record")
+
+// setupTracing exports spans over OTLP/gRPC to endpoint, sampling the given
+// fraction of purchases. The standard OTEL_EXPORTER_OTLP_* variables still
+// apply. The returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, endpoint string, sampleRatio float64) (func(context.Context) error, error) {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("create otlp exporter: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("sell-single-hot-product"))),
+	)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer("update_one_record")
+	return provider.Shutdown, nil
+}
+
+// startPurchaseSpan starts the root span of one purchase.
+func startPurchaseSpan(ctx context.Context, name string, order strategy.Order) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "purchase", trace.WithAttributes(
+		attribute.String("strategy", name),
+		attribute.Int("product.id", order.ProductID),
+		attribute.Int64("order.quantity", order.Quantity),
+		attribute.Int("worker.id", strategy.WorkerID(ctx)),
+	))
+}
@@ -0,0 +1,219 @@
+package loadgen
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// dashboardHistory is the number of samples in the throughput sparkline.
+	dashboardHistory = 60
+	// dashboardLogLines is the number of log lines kept below the panels.
+	dashboardLogLines = 6
+	dashboardBarWidth = 40
+)
+
+// dashboardLatencyBounds are the bucket bounds of the latency histogram panel.
+var dashboardLatencyBounds = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second,
+}
+
+var (
+	titleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	labelStyle = lipgloss.NewStyle().Bold(true)
+	panelStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	faintStyle = lipgloss.NewStyle().Faint(true)
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+type (
+	sampleMsg tickSample
+	logMsg    string
+)
+
+// dashboard is the bubbletea model behind -tui. Throughput comes from the tick
+// samples; everything else is read from the live run stats on every redraw.
+type dashboard struct {
+	cfg          Config
+	stats        *runStats
+	initialStock int64
+
+	last tickSample
+	tps  []float64
+	logs []string
+}
+
+func (d *dashboard) Init() tea.Cmd { return nil }
+
+func (d *dashboard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case sampleMsg:
+		d.last = tickSample(msg)
+		d.tps = append(d.tps, msg.TPS)
+		if len(d.tps) > dashboardHistory {
+			d.tps = d.tps[len(d.tps)-dashboardHistory:]
+		}
+	case logMsg:
+		d.logs = append(d.logs, string(msg))
+		if len(d.logs) > dashboardLogLines {
+			d.logs = d.logs[len(d.logs)-dashboardLogLines:]
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return d, tea.Quit
+		}
+	}
+	return d, nil
+}
+
+func (d *dashboard) View() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s  %s, %d workers, %d products  %s\n",
+		titleStyle.Render("sell-single-hot-product"), d.cfg.Strategy, d.cfg.Concurrency, d.cfg.NumProducts,
+		faintStyle.Render(fmt.Sprintf("[%s]  q to close", d.last.Uptime.Round(time.Second))))
+
+	throughput := fmt.Sprintf("%s %8.1f tps  %6.2f%% ok  avg %v  p99 %v\n%s",
+		labelStyle.Render("Throughput"), d.last.TPS, d.last.OKRate,
+		d.last.AvgLatency.Round(time.Microsecond), d.last.P99.Round(time.Microsecond), sparkline(d.tps))
+	b.WriteString(panelStyle.Render(throughput) + "\n")
+
+	latency := lipgloss.JoinVertical(lipgloss.Left, labelStyle.Render("Latency"), d.latencyHistogram())
+	errs := lipgloss.JoinVertical(lipgloss.Left, labelStyle.Render("Purchases"), d.counters())
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, panelStyle.Render(latency), panelStyle.Render(errs)) + "\n")
+
+	b.WriteString(panelStyle.Render(labelStyle.Render("Stock")+"\n"+d.stockGauge()) + "\n")
+	b.WriteString(panelStyle.Render(labelStyle.Render("Progress")+"\n"+d.progressBar()) + "\n")
+
+	for _, line := range d.logs {
+		b.WriteString(faintStyle.Render(line) + "\n")
+	}
+	return b.String()
+}
+
+// latencyHistogram renders the run's latency distribution as horizontal bars.
+func (d *dashboard) latencyHistogram() string {
+	counts := d.stats.latency.Distribution(dashboardLatencyBounds)
+	var peak int64
+	for _, c := range counts {
+		peak = max(peak, c)
+	}
+	var b strings.Builder
+	for i, c := range counts {
+		label := "≥" + dashboardLatencyBounds[len(dashboardLatencyBounds)-1].String()
+		if i < len(dashboardLatencyBounds) {
+			label = "<" + dashboardLatencyBounds[i].String()
+		}
+		width := 0
+		if peak > 0 {
+			width = int(c * dashboardBarWidth / peak)
+		}
+		fmt.Fprintf(&b, "%6s %-*s %d\n", label, dashboardBarWidth, strings.Repeat("█", width), c)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// counters renders the outcome totals and the failures by error class.
+func (d *dashboard) counters() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "ok        %d\n", d.stats.succeeded.Load())
+	fmt.Fprintf(&b, "sold out  %d\n", d.stats.soldOut.Load())
+	fmt.Fprintf(&b, "failed    %s", errorStyle.Render(fmt.Sprint(d.stats.failed.Load())))
+	if errs := d.stats.errorCounts(); len(errs) > 0 {
+		for _, part := range strings.Split(formatErrors(errs), ", ") {
+			b.WriteString("\n  " + errorStyle.Render(part))
+		}
+	}
+	return b.String()
+}
+
+// stockGauge renders the remaining stock as a share of the initial stock.
+func (d *dashboard) stockGauge() string {
+	remaining := max(d.initialStock-d.stats.unitsSold.Load(), 0)
+	var frac float64
+	if d.initialStock > 0 {
+		frac = float64(remaining) / float64(d.initialStock)
+	}
+	filled := int(frac * dashboardBarWidth)
+	return fmt.Sprintf("%s%s %d / %d (%.1f%%)",
+		strings.Repeat("█", filled), faintStyle.Render(strings.Repeat("░", dashboardBarWidth-filled)),
+		remaining, d.initialStock, frac*100)
+}
+
+// progressBar renders the completed purchases and the estimated time left.
+func (d *dashboard) progressBar() string {
+	frac := d.last.Progress()
+	filled := int(frac * dashboardBarWidth)
+	if d.last.Duration > 0 {
+		return fmt.Sprintf("%s%s %d purchases (%.1f%%), %v left",
+			strings.Repeat("█", filled), faintStyle.Render(strings.Repeat("░", dashboardBarWidth-filled)),
+			d.last.Completed, frac*100, d.last.ETA)
+	}
+	return fmt.Sprintf("%s%s %d / %d (%.1f%%), ETA %v",
+		strings.Repeat("█", filled), faintStyle.Render(strings.Repeat("░", dashboardBarWidth-filled)),
+		d.last.Completed, d.last.Total, frac*100, d.last.ETA)
+}
+
+// sparkline renders values scaled to their maximum.
+func sparkline(values []float64) string {
+	const levels = "▁▂▃▄▅▆▇█"
+	ticks := []rune(levels)
+	var peak float64
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if peak > 0 {
+			i = int(v / peak * float64(len(ticks)-1))
+		}
+		b.WriteRune(ticks[i])
+	}
+	return b.String()
+}
+
+// dashboardLog forwards log output to the dashboard's log lines.
+type dashboardLog struct {
+	p *tea.Program
+}
+
+func (w dashboardLog) Write(b []byte) (int, error) {
+	w.p.Send(logMsg(strings.TrimRight(string(b), "\n")))
+	return len(b), nil
+}
+
+// startDashboard takes over the terminal with the -tui dashboard for the
+// duration of a run. It returns the tick sink feeding the dashboard and a
+// function that closes it; log output goes to the dashboard until it is
+// closed, either by that function or by the user.
+func startDashboard(cfg Config, stats *runStats) (sink func(tickSample), stop func()) {
+	model := &dashboard{cfg: cfg, stats: stats, initialStock: cfg.Stock * int64(cfg.NumProducts)}
+	p := tea.NewProgram(model, tea.WithAltScreen())
+	logOutput.set(dashboardLog{p: p})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := p.Run()
+		logOutput.set(os.Stderr)
+		if err != nil {
+			slog.Error("Dashboard failed", "err", err)
+		}
+	}()
+	sink = func(s tickSample) { p.Send(sampleMsg(s)) }
+	stop = func() {
+		p.Quit()
+		<-done
+	}
+	return sink, stop
+}
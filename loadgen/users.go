@@ -0,0 +1,72 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"update_one_record/schema"
+	"update_one_record/strategy"
+)
+
+// UsersSummary describes the buyers of -users.
+type UsersSummary struct {
+	Users        int
+	Buyers       int64 // users with at least one order
+	Orders       int64
+	OrderedUnits int64
+	Rejected     int64 // purchases refused with ErrAlreadyPurchased
+}
+
+// userLimiter lets each of a population of users buy a product only once. A
+// purchase first claims the user's order row, which the primary key of the
+// orders table refuses a second time, and then buys through the Strategy;
+// the claim is withdrawn if the purchase fails. Claims are never lost, so a
+// user may be refused after a failure whose withdrawal failed too, but is
+// never sold a product twice. With recorded set the strategy records the
+// orders itself, and the same key refuses a second one inside the purchase
+// transaction, so there is nothing to claim.
+type userLimiter struct {
+	strategy.Strategy
+	users    int
+	recorded bool
+}
+
+// pick returns the user that makes the next purchase.
+func (l *userLimiter) pick(rng *rand.Rand) int {
+	return rng.Intn(l.users) + 1
+}
+
+func (l *userLimiter) Purchase(ctx context.Context, db *sql.DB, order strategy.Order) error {
+	if l.recorded {
+		return l.Strategy.Purchase(ctx, db, order)
+	}
+	_, err := db.ExecContext(ctx, "INSERT INTO orders (product_id, user_id, quantity, created_at) VALUES (?, ?, ?, ?)", order.ProductID, order.UserID, order.Quantity, time.Now().UTC())
+	if schema.IsUniqueViolation(err) {
+		return strategy.ErrAlreadyPurchased
+	}
+	if err != nil {
+		return fmt.Errorf("claim order: %w", err)
+	}
+	if err := l.Strategy.Purchase(ctx, db, order); err != nil {
+		// The withdrawal must run even if ctx was canceled mid-purchase.
+		if _, delErr := db.ExecContext(context.WithoutCancel(ctx), "DELETE FROM orders WHERE user_id = ? AND product_id = ?", order.UserID, order.ProductID); delErr != nil {
+			return fmt.Errorf("%w (withdrawing the order failed: %v)", err, delErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// summary reads the orders placed and combines them with the rejections
+// counted by the run.
+func (l *userLimiter) summary(ctx context.Context, db *sql.DB, rejected int64) (*UsersSummary, error) {
+	s := &UsersSummary{Users: l.users, Rejected: rejected}
+	err := db.QueryRowContext(ctx, "SELECT COUNT(DISTINCT user_id), COUNT(*), COALESCE(SUM(quantity), 0) FROM orders").Scan(&s.Buyers, &s.Orders, &s.OrderedUnits)
+	if err != nil {
+		return nil, fmt.Errorf("count orders: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,131 @@
+package loadgen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// StockCheck is what Verify found in the products table.
+type StockCheck struct {
+	Products     int   // rows of the products table
+	Missing      int   // of the cfg.NumProducts products
+	Oversold     []int // products whose count went below zero
+	InitialStock int64 // cfg.Stock of each of cfg.NumProducts products
+	ActualStock  int64
+	Orders       int64 // rows of the orders table
+	OrderedUnits int64
+	Restocked    int64 // units the restocks table logs
+}
+
+// Sold returns the units sold from the initial stock, net of any restocks
+// and refunds.
+func (c *StockCheck) Sold() int64 {
+	return c.InitialStock - c.ActualStock
+}
+
+// Consistent reports whether every product is there and none was oversold,
+// and whether the orders, when purchases recorded any, account for every
+// unit sold, restocked units included.
+func (c *StockCheck) Consistent() bool {
+	return c.Missing == 0 && len(c.Oversold) == 0 && (c.Orders == 0 || c.OrderedUnits == c.Sold()+c.Restocked)
+}
+
+// Verify checks the products table left by earlier runs against the
+// initial stock of cfg, independently of any run, and prints what it found.
+// The orders table is checked as well if it holds orders, which it does
+// when every purchase was made with -users or -orders. Strategies that keep
+// their stock elsewhere are not covered. Inconsistent stock returns the
+// check together with ErrInconsistent.
+func Verify(ctx context.Context, cfg Config) (*StockCheck, error) {
+	if cfg.Driver == "none" {
+		return nil, errors.New("verify reads the products table; it cannot run with -driver none")
+	}
+	s, err := openSession(ctx, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer s.close(ctx)
+	c, err := checkStock(ctx, s.endpoints[0].DB, cfg)
+	if err != nil {
+		return nil, err
+	}
+	printStockCheck(c)
+	if !c.Consistent() {
+		return c, ErrInconsistent
+	}
+	return c, nil
+}
+
+func checkStock(ctx context.Context, db *sql.DB, cfg Config) (*StockCheck, error) {
+	c := &StockCheck{InitialStock: cfg.Stock * int64(cfg.NumProducts)}
+	rows, err := db.QueryContext(ctx, "SELECT id, count FROM products ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("query products: %w", err)
+	}
+	defer rows.Close()
+	found := 0
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		c.Products++
+		c.ActualStock += count
+		if id >= 1 && id <= cfg.NumProducts {
+			found++
+		}
+		if count < 0 {
+			c.Oversold = append(c.Oversold, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query products: %w", err)
+	}
+	c.Missing = cfg.NumProducts - found
+
+	// Only runs with -users or -orders create the orders table.
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(SUM(quantity), 0) FROM orders").Scan(&c.Orders, &c.OrderedUnits)
+	if err != nil {
+		slog.Debug("No orders to check", "err", err)
+		c.Orders, c.OrderedUnits = 0, 0
+	}
+	// The restocks table comes with the orders table.
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(SUM(units), 0) FROM restocks").Scan(&c.Restocked); err != nil {
+		slog.Debug("No restocks to check", "err", err)
+		c.Restocked = 0
+	}
+	return c, nil
+}
+
+func printStockCheck(c *StockCheck) {
+	fmt.Println("-----------------------------------------")
+	fmt.Printf("Products:             %d (%d missing)\n", c.Products, c.Missing)
+	fmt.Printf("Initial Total Stock:  %d\n", c.InitialStock)
+	fmt.Printf("Actual Total Stock:   %d\n", c.ActualStock)
+	fmt.Printf("Sold:                 %d units\n", c.Sold())
+	if c.Restocked > 0 {
+		fmt.Printf("Restocked:            %d units\n", c.Restocked)
+	}
+	if c.Orders > 0 {
+		fmt.Printf("Orders:               %d (%d units)\n", c.Orders, c.OrderedUnits)
+	}
+	if len(c.Oversold) > 0 {
+		ids := make([]string, len(c.Oversold))
+		for i, id := range c.Oversold {
+			ids[i] = strconv.Itoa(id)
+		}
+		fmt.Printf("Oversold products:    %s\n", strings.Join(ids, ", "))
+	}
+	fmt.Println("-----------------------------------------")
+	if c.Consistent() {
+		slog.Info("✅ Verified! Data is consistent.")
+	} else {
+		slog.Error("❌ Verification failed! Data is inconsistent.", "missing", c.Missing, "oversold", len(c.Oversold), "sold", c.Sold(), "ordered_units", c.OrderedUnits)
+	}
+}
@@ -0,0 +1,184 @@
+package loadgen
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// webShutdownTimeout bounds how long the -web dashboard waits for its
+// clients to take the end of the feed when the run finishes.
+const webShutdownTimeout = 2 * time.Second
+
+// webSample is a tick sample as the -web dashboard charts it.
+type webSample struct {
+	Uptime   float64 `json:"uptime"` // seconds
+	TPS      float64 `json:"tps"`
+	OKPct    float64 `json:"ok_pct"`
+	Errors   int64   `json:"errors"`
+	AvgMs    float64 `json:"avg_ms"`
+	P99Ms    float64 `json:"p99_ms"`
+	Stock    int64   `json:"stock"` // initial stock less the units sold
+	Progress float64 `json:"progress"`
+}
+
+// webRun describes the run at the top of the dashboard.
+type webRun struct {
+	Strategy     string `json:"strategy"`
+	Workers      int    `json:"workers"`
+	Products     int    `json:"products"`
+	InitialStock int64  `json:"initial_stock"`
+}
+
+// webDashboard serves the -web dashboard: its page, the samples of the run
+// so far as JSON at /api/samples, for a page opened late, and every new one
+// as a server-sent event at /api/feed, which ends with a done event.
+type webDashboard struct {
+	run          webRun
+	stats        *runStats
+	initialStock int64
+
+	mu      sync.Mutex
+	samples []webSample
+	subs    map[chan webSample]struct{}
+	done    bool
+}
+
+// startWebDashboard serves the -web dashboard on cfg.WebAddr for the
+// duration of a run. It returns the tick sink feeding it and a function that
+// ends the feed and stops serving.
+func startWebDashboard(cfg Config, stats *runStats, initialStock int64) (sink func(tickSample), stop func(), err error) {
+	d := &webDashboard{
+		run:          webRun{Strategy: cfg.Strategy, Workers: cfg.Concurrency, Products: cfg.NumProducts, InitialStock: initialStock},
+		stats:        stats,
+		initialStock: initialStock,
+		subs:         map[chan webSample]struct{}{},
+	}
+	static, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		return nil, nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /", http.FileServerFS(static))
+	mux.HandleFunc("GET /api/samples", d.serveSamples)
+	mux.HandleFunc("GET /api/feed", d.serveFeed)
+	srv := &http.Server{Handler: mux}
+
+	ln, err := net.Listen("tcp", cfg.WebAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("web dashboard: %w", err)
+	}
+	slog.Info("Serving web dashboard", "url", "http://"+ln.Addr().String()+"/")
+	go func() {
+		if err := srv.Serve(ln); err != http.ErrServerClosed {
+			slog.Error("Failed to serve web dashboard", "err", err)
+		}
+	}()
+	stop = func() {
+		d.finish()
+		ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+		}
+	}
+	return d.add, stop, nil
+}
+
+// add is the tick sink of the dashboard.
+func (d *webDashboard) add(s tickSample) {
+	ws := webSample{
+		Uptime:   s.Uptime.Seconds(),
+		TPS:      s.TPS,
+		OKPct:    s.OKRate,
+		Errors:   s.Errors,
+		AvgMs:    millis(s.AvgLatency),
+		P99Ms:    millis(s.P99),
+		Stock:    max(d.initialStock-d.stats.unitsSold.Load(), 0),
+		Progress: s.Progress(),
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.samples = append(d.samples, ws)
+	for ch := range d.subs {
+		select {
+		case ch <- ws:
+		default:
+			// A client too slow for the feed misses samples rather than
+			// holding up the ticker.
+		}
+	}
+}
+
+// finish ends the feed of every client.
+func (d *webDashboard) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.done = true
+	for ch := range d.subs {
+		close(ch)
+		delete(d.subs, ch)
+	}
+}
+
+func (d *webDashboard) serveSamples(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	body := struct {
+		Run     webRun      `json:"run"`
+		Samples []webSample `json:"samples"`
+		Done    bool        `json:"done"`
+	}{d.run, append([]webSample{}, d.samples...), d.done}
+	d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func (d *webDashboard) serveFeed(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan webSample, 16)
+	d.mu.Lock()
+	if d.done {
+		close(ch)
+	} else {
+		d.subs[ch] = struct{}{}
+	}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.subs, ch)
+		d.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+	for {
+		select {
+		case s, ok := <-ch:
+			if !ok {
+				fmt.Fprint(w, "event: done\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			data, _ := json.Marshal(s)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
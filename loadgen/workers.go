@@ -0,0 +1,100 @@
+package loadgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// stragglerRatio flags workers whose throughput is below this fraction of the
+// average worker throughput.
+const stragglerRatio = 0.5
+
+// workerStats counts the purchases issued by a single worker.
+type workerStats struct {
+	attempts  atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	elapsed   atomic.Int64 // nanoseconds until the worker finished
+}
+
+// WorkerResult summarizes the purchases of one worker.
+type WorkerResult struct {
+	ID         int
+	Attempts   int64
+	Succeeded  int64
+	Failed     int64
+	Elapsed    time.Duration
+	Throughput float64 // purchases of any outcome completed per second
+}
+
+// WorkerSummary spreads the per-worker results. Stragglers are the workers
+// with less than stragglerRatio of the average throughput, slowest first.
+type WorkerSummary struct {
+	MinTPS, AvgTPS, MaxTPS float64
+	MinFailed, MaxFailed   int64
+	AvgFailed              float64
+	Stragglers             []WorkerResult
+}
+
+// workerSummary summarizes the workers that issued any purchase.
+func (s *runStats) workerSummary() WorkerSummary {
+	var results []WorkerResult
+	for i := range s.workers {
+		w := &s.workers[i]
+		r := WorkerResult{
+			ID:        i + 1,
+			Attempts:  w.attempts.Load(),
+			Succeeded: w.succeeded.Load(),
+			Failed:    w.failed.Load(),
+			Elapsed:   time.Duration(w.elapsed.Load()),
+		}
+		if r.Attempts == 0 {
+			continue
+		}
+		if r.Elapsed > 0 {
+			// Sold-out purchases count: a worker that only drew sold-out
+			// products is not starved.
+			r.Throughput = float64(r.Attempts) / r.Elapsed.Seconds()
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return WorkerSummary{}
+	}
+
+	sum := WorkerSummary{MinTPS: results[0].Throughput, MinFailed: results[0].Failed}
+	var totalTPS float64
+	var totalFailed int64
+	for _, r := range results {
+		sum.MinTPS = min(sum.MinTPS, r.Throughput)
+		sum.MaxTPS = max(sum.MaxTPS, r.Throughput)
+		sum.MinFailed = min(sum.MinFailed, r.Failed)
+		sum.MaxFailed = max(sum.MaxFailed, r.Failed)
+		totalTPS += r.Throughput
+		totalFailed += r.Failed
+	}
+	sum.AvgTPS = totalTPS / float64(len(results))
+	sum.AvgFailed = float64(totalFailed) / float64(len(results))
+
+	for _, r := range results {
+		if r.Throughput < sum.AvgTPS*stragglerRatio {
+			sum.Stragglers = append(sum.Stragglers, r)
+		}
+	}
+	sort.Slice(sum.Stragglers, func(i, j int) bool {
+		return sum.Stragglers[i].Throughput < sum.Stragglers[j].Throughput
+	})
+	return sum
+}
+
+// formatStragglers renders stragglers as "worker N (x tps, y failed)" items.
+func formatStragglers(stragglers []WorkerResult) string {
+	parts := make([]string, len(stragglers))
+	for i, r := range stragglers {
+		parts[i] = fmt.Sprintf("worker %d (%.1f tps, %d failed)", r.ID, r.Throughput, r.Failed)
+	}
+	return strings.Join(parts, ", ")
+}
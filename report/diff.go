@@ -0,0 +1,84 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// Decode decodes a single report or an array of them.
+func Decode(data []byte) ([]Report, error) {
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var reports []Report
+		if err := json.Unmarshal(data, &reports); err != nil {
+			return nil, err
+		}
+		return reports, nil
+	}
+	var r Report
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, err
+	}
+	return []Report{r}, nil
+}
+
+// PrintDiff prints a table of metric deltas between two reports.
+func PrintDiff(base, next Report, threshold float64) {
+	type metric struct {
+		name           string
+		base, next     float64
+		unit           string
+		higherIsBetter bool
+	}
+	metrics := []metric{
+		{"throughput", base.Throughput, next.Throughput, "tps", true},
+		{"p50", base.Latency.P50, next.Latency.P50, "ms", false},
+		{"p90", base.Latency.P90, next.Latency.P90, "ms", false},
+		{"p95", base.Latency.P95, next.Latency.P95, "ms", false},
+		{"p99", base.Latency.P99, next.Latency.P99, "ms", false},
+		{"max", base.Latency.Max, next.Latency.Max, "ms", false},
+		{"error rate", base.ErrorRate * 100, next.ErrorRate * 100, "%", false},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tBASE\tNEW\tDELTA\t")
+	var regressions int
+	for _, m := range metrics {
+		delta := "n/a"
+		var verdict string
+		switch {
+		case m.base == 0 && m.next != 0:
+			// No baseline to take a percentage of; any move the wrong way
+			// counts.
+			delta = "new"
+			if !m.higherIsBetter {
+				verdict = "REGRESSION"
+				regressions++
+			}
+		case m.base != 0:
+			change := (m.next - m.base) / m.base * 100
+			delta = fmt.Sprintf("%+.1f%%", change)
+			if !m.higherIsBetter {
+				change = -change
+			}
+			if change < -threshold {
+				verdict = "REGRESSION"
+				regressions++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%.3f %s\t%.3f %s\t%s\t%s\n", m.name, m.base, m.unit, m.next, m.unit, delta, verdict)
+	}
+	w.Flush()
+
+	if base.Consistency.Consistent && !next.Consistency.Consistent {
+		fmt.Println("REGRESSION: the new run left inconsistent stock")
+		regressions++
+	}
+	if regressions == 0 {
+		fmt.Printf("No regressions beyond %.1f%%.\n", threshold)
+	} else {
+		fmt.Printf("%d regressions beyond %.1f%%.\n", regressions, threshold)
+	}
+}
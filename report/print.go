@@ -0,0 +1,45 @@
+package report
+
+import (
+	"fmt"
+	"time"
+)
+
+// Print prints a summary of a saved report, the main figures of the
+// summary the run itself printed.
+func Print(r Report) {
+	fmt.Println("-----------------------------------------")
+	fmt.Printf("Strategy:             %s\n", r.Strategy)
+	fmt.Printf("Started:              %s\n", r.StartedAt.Format(time.RFC3339))
+	fmt.Printf("Initial Total Stock:  %d\n", r.Consistency.InitialStock)
+	fmt.Printf("Expected Total Stock: %d\n", r.Consistency.ExpectedStock)
+	fmt.Printf("Actual Total Stock:   %d\n", r.Consistency.ActualStock)
+	if n := len(r.Consistency.Oversold); n > 0 {
+		fmt.Printf("Oversold products:    %d\n", n)
+	}
+	fmt.Println("-----------------------------------------")
+	fmt.Printf("Elapsed:              %v\n", time.Duration(r.Elapsed*float64(time.Second)).Round(time.Millisecond))
+	if r.Interrupted {
+		fmt.Println("Interrupted:          yes, the purchases completed so far")
+	}
+	fmt.Printf("Purchases:            %d ok, %d sold out, %d failed\n", r.Succeeded, r.SoldOut, r.Failed)
+	if r.Retries.Total > 0 || r.Retries.Abandoned > 0 {
+		fmt.Printf("Retries:              %d total, %d purchases retried, %d abandoned\n", r.Retries.Total, r.Retries.Retried, r.Retries.Abandoned)
+	}
+	fmt.Printf("Throughput:           %.1f purchases/s\n", r.Throughput)
+	fmt.Printf("Error rate:           %.2f%%\n", r.ErrorRate*100)
+	fmt.Printf("Latency p50:          %.3fms\n", r.Latency.P50)
+	fmt.Printf("Latency p90:          %.3fms\n", r.Latency.P90)
+	fmt.Printf("Latency p95:          %.3fms\n", r.Latency.P95)
+	fmt.Printf("Latency p99:          %.3fms\n", r.Latency.P99)
+	fmt.Printf("Latency max:          %.3fms\n", r.Latency.Max)
+	if r.Error != "" {
+		fmt.Printf("Error:                %s\n", r.Error)
+	}
+	fmt.Println("-----------------------------------------")
+	if r.Consistency.Consistent {
+		fmt.Println("Consistent:           yes")
+	} else {
+		fmt.Println("Consistent:           no")
+	}
+}
@@ -0,0 +1,259 @@
+// Package report defines the machine-readable report of a run, prints it and
+// compares reports with each other.
+package report
+
+import (
+	"time"
+)
+
+// Report is the machine-readable form of a run written by -output json.
+type Report struct {
+	Config      any              `json:"config"` // the run's Config
+	Strategy    string           `json:"strategy"`
+	Interrupted bool             `json:"interrupted,omitempty"`
+	StartedAt   time.Time        `json:"started_at"`
+	Elapsed     float64          `json:"elapsed_seconds"`
+	Attempts    int64            `json:"attempts"`
+	Succeeded   int64            `json:"succeeded"`
+	SoldOut     int64            `json:"sold_out"`
+	Failed      int64            `json:"failed"`
+	Throughput  float64          `json:"throughput_tps"`
+	ErrorRate   float64          `json:"error_rate"`
+	Latency     Latency          `json:"latency_ms"`
+	Phases      []Phase          `json:"phases,omitempty"`
+	Errors      map[string]int64 `json:"errors"`
+	LockWaits   *LockWait        `json:"server_lock_waits,omitempty"`
+	Browse      *Browse          `json:"browse,omitempty"`
+	ReplicaLag  *ReplicaLag      `json:"replica_lag,omitempty"`
+	Failover    *Failover        `json:"failover,omitempty"`
+	Pool        Pool             `json:"pool"`
+	Deadlock    string           `json:"deadlock_report,omitempty"`
+	HotProducts []Product        `json:"hot_products,omitempty"`
+	Endpoints   []Endpoint       `json:"endpoints,omitempty"`
+	Scenario    []ScenarioPhase  `json:"scenario,omitempty"`
+	Reads       *Reads           `json:"reads,omitempty"`
+	Sale        *Sale            `json:"sale,omitempty"`
+	OpenLoop    *OpenLoop        `json:"open_loop,omitempty"`
+	Users       *Users           `json:"users,omitempty"`
+	Orders      *Orders          `json:"orders,omitempty"`
+	Idempotency *Idempotency     `json:"idempotency,omitempty"`
+	SlowTrace   *SlowTrace       `json:"slow_trace,omitempty"`
+	Refunds     *Refunds         `json:"refunds,omitempty"`
+	Restocks    *Restocks        `json:"restocks,omitempty"`
+	Workers     Workers          `json:"workers"`
+	Retries     Retries          `json:"retries"`
+	Consistency Consistency      `json:"consistency"`
+	Error       string           `json:"error,omitempty"`
+}
+
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+type Phase struct {
+	Name    string  `json:"name"`
+	Count   int64   `json:"count"`
+	MeanMs  float64 `json:"mean_ms"`
+	Latency Latency `json:"latency_ms"`
+}
+
+type Pool struct {
+	WaitCount   int64   `json:"wait_count"`
+	WaitTotalMs float64 `json:"wait_total_ms"`
+	Wait        Latency `json:"wait_ms"`
+	MaxInUse    int     `json:"max_in_use"`
+	AvgInUse    float64 `json:"avg_in_use"`
+	AvgIdle     float64 `json:"avg_idle"`
+}
+
+type Endpoint struct {
+	Name         string  `json:"name"`
+	Workers      int     `json:"workers"`
+	Attempts     int64   `json:"attempts"`
+	Succeeded    int64   `json:"succeeded"`
+	Failed       int64   `json:"failed"`
+	Throughput   float64 `json:"throughput_tps"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+type Sale struct {
+	Open      time.Time `json:"open"`
+	JitterMs  float64   `json:"jitter_ms"`
+	SpreadMs  float64   `json:"spread_ms"`
+	Attempts  int64     `json:"first_second_attempts"`
+	Succeeded int64     `json:"first_second_succeeded"`
+	SoldOut   int64     `json:"first_second_sold_out"`
+	Failed    int64     `json:"first_second_failed"`
+	Latency   Latency   `json:"first_second_latency_ms"`
+}
+
+type OpenLoop struct {
+	Rate       float64 `json:"arrival_rate"`
+	Arrivals   int64   `json:"arrivals"`
+	MaxBacklog int     `json:"max_backlog"`
+	QueueWait  Latency `json:"queue_wait_ms"`
+}
+
+type Users struct {
+	Users        int   `json:"users"`
+	Buyers       int64 `json:"buyers"`
+	Orders       int64 `json:"orders"`
+	OrderedUnits int64 `json:"ordered_units"`
+	Rejected     int64 `json:"duplicates_rejected"`
+}
+
+type Orders struct {
+	Orders     int64 `json:"orders"`
+	Units      int64 `json:"units"`
+	StockTaken int64 `json:"stock_taken"`
+}
+
+type Idempotency struct {
+	Retries             int64 `json:"retries"`
+	DuplicatesPrevented int64 `json:"duplicates_prevented"`
+}
+
+type SlowTrace struct {
+	ThresholdMs float64 `json:"threshold_ms"`
+	Slow        int64   `json:"slow"`
+	Logged      int64   `json:"logged"`
+}
+
+type Restocks struct {
+	Applied []Restock `json:"applied"`
+	Skipped int       `json:"skipped"`
+	Units   int64     `json:"units"`
+}
+
+type Restock struct {
+	Units       int64   `json:"units_per_product"`
+	AtMs        float64 `json:"at_ms"`
+	AppliedAtMs float64 `json:"applied_at_ms"`
+	TookMs      float64 `json:"took_ms"`
+}
+
+type Refunds struct {
+	Ratio         float64 `json:"ratio"`
+	AfterMs       float64 `json:"after_ms"`
+	Refunds       int64   `json:"refunds"`
+	RefundedUnits int64   `json:"refunded_units"`
+	Failed        int64   `json:"failed"`
+	Latency       Latency `json:"latency_ms"`
+}
+
+type Reads struct {
+	Ratio   float64 `json:"ratio"`
+	Reads   int64   `json:"reads"`
+	Failed  int64   `json:"failed"`
+	Latency Latency `json:"latency_ms"`
+}
+
+type ScenarioPhase struct {
+	Name         string  `json:"name"`
+	Concurrency  int     `json:"concurrency"`
+	TargetQPS    float64 `json:"target_qps,omitempty"`
+	Distribution string  `json:"distribution"`
+	DurationMs   float64 `json:"duration_ms"`
+	Attempts     int64   `json:"attempts"`
+	Succeeded    int64   `json:"succeeded"`
+	Failed       int64   `json:"failed"`
+	Throughput   float64 `json:"throughput_tps"`
+	Latency      Latency `json:"latency_ms"`
+}
+
+type Browse struct {
+	Mode       string  `json:"mode"`
+	Readers    int     `json:"readers"`
+	Reads      int64   `json:"reads"`
+	Failed     int64   `json:"failed"`
+	Throughput float64 `json:"throughput_rps"`
+	Latency    Latency `json:"latency_ms"`
+}
+
+type ReplicaLag struct {
+	Endpoint       string  `json:"endpoint"`
+	Samples        int64   `json:"samples"`
+	Stale          int64   `json:"stale_samples"`
+	MaxUnitsBehind int64   `json:"max_units_behind"`
+	AvgUnitsBehind float64 `json:"avg_units_behind"`
+	Lag            Latency `json:"lag_ms"`
+}
+
+type Outage struct {
+	Start        time.Time  `json:"start"`
+	End          *time.Time `json:"end,omitempty"`
+	Errors       int64      `json:"errors"`
+	DowntimeMs   float64    `json:"downtime_ms"`
+	ErrorSpikeMs float64    `json:"error_spike_ms"`
+}
+
+type Failover struct {
+	Outages         []Outage `json:"outages"`
+	DowntimeMs      float64  `json:"downtime_ms"`
+	ErrorSpikeMs    float64  `json:"error_spike_ms"`
+	ConfirmedUnits  int64    `json:"confirmed_units"`
+	AmbiguousUnits  int64    `json:"ambiguous_units"`
+	LostUnits       int64    `json:"lost_units"`
+	DoubleSoldUnits int64    `json:"double_sold_units"`
+}
+
+type LockWait struct {
+	Samples     int64   `json:"samples"`
+	MaxWaiting  int64   `json:"max_waiting"`
+	AvgWaiting  float64 `json:"avg_waiting"`
+	MaxWaitMs   float64 `json:"max_wait_ms"`
+	TotalWaitMs float64 `json:"total_wait_ms"`
+}
+
+type Product struct {
+	ID           int     `json:"id"`
+	Attempts     int64   `json:"attempts"`
+	Succeeded    int64   `json:"succeeded"`
+	SoldOut      int64   `json:"sold_out"`
+	Share        float64 `json:"share"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+type Retries struct {
+	Total      int64            `json:"total"`
+	Retried    int64            `json:"retried"`
+	Abandoned  int64            `json:"abandoned"`
+	PerSuccess map[string]int64 `json:"per_success"`
+}
+
+type Workers struct {
+	MinTPS     float64  `json:"min_tps"`
+	AvgTPS     float64  `json:"avg_tps"`
+	MaxTPS     float64  `json:"max_tps"`
+	MinFailed  int64    `json:"min_failed"`
+	AvgFailed  float64  `json:"avg_failed"`
+	MaxFailed  int64    `json:"max_failed"`
+	Stragglers []Worker `json:"stragglers"`
+}
+
+type Worker struct {
+	ID         int     `json:"id"`
+	Attempts   int64   `json:"attempts"`
+	Succeeded  int64   `json:"succeeded"`
+	Failed     int64   `json:"failed"`
+	Throughput float64 `json:"throughput_tps"`
+}
+
+type Consistency struct {
+	InitialStock  int64 `json:"initial_stock"`
+	ExpectedStock int64 `json:"expected_stock"`
+	ActualStock   int64 `json:"actual_stock"`
+	Consistent    bool  `json:"consistent"`
+
+	Oversold []OversoldProduct `json:"oversold_products,omitempty"`
+}
+
+type OversoldProduct struct {
+	ID       int   `json:"id"`
+	Expected int64 `json:"expected"`
+	Actual   int64 `json:"actual"`
+}
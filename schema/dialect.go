@@ -0,0 +1,179 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+)
+
+// Dialect is the SQL that differs between the databases behind -driver.
+// Strategies write their statements with ? placeholders and take anything
+// that is not portable from the dialect, so supporting another database means
+// adding a Dialect rather than editing every strategy.
+type Dialect interface {
+	// DriverName is the database/sql driver to open DB_DSN with.
+	DriverName() string
+
+	// Rebind rewrites the ? placeholders of query into the form the driver
+	// expects.
+	Rebind(query string) string
+
+	// CreateSchema returns the statements that create the products table.
+	CreateSchema() []string
+
+	// SelectForUpdate returns query, a SELECT on one table, reading its rows
+	// locked for the rest of the transaction.
+	SelectForUpdate(query string, lock RowLock) string
+
+	// ConditionalDecrement returns an UPDATE that takes ? units of the
+	// product with ID ? only if at least ? are left, so that it affects no
+	// row once the product is sold out.
+	ConditionalDecrement() string
+
+	// Serial is the column definition of an auto-incrementing BIGINT primary
+	// key.
+	Serial() string
+
+	// Timestamp is the column type of a timestamp with microseconds.
+	Timestamp() string
+
+	// InsertID runs query, an INSERT of one row into a table with a Serial
+	// id, and returns the id of the new row.
+	InsertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error)
+}
+
+// RowLock is how SelectForUpdate treats rows that another transaction has
+// already locked.
+type RowLock int
+
+const (
+	LockWait       RowLock = iota // queue behind the lock holder
+	LockNoWait                    // fail at once
+	LockSkipLocked                // leave them out of the result
+)
+
+// dialects maps -driver names to their dialect constructors, which take the
+// TiDB layout of the products table.
+var dialects = map[string]func(tidb TiDB) Dialect{
+	"mysql":     func(tidb TiDB) Dialect { return mysqlDialect{schema: tidb} },
+	"postgres":  func(TiDB) Dialect { return postgresDialect{} },
+	"cockroach": func(TiDB) Dialect { return postgresDialect{} },
+	"sqlite":    func(TiDB) Dialect { return sqliteDialect{} },
+	"vitess":    func(TiDB) Dialect { return vitessDialect{} },
+}
+
+// NewDialect returns the dialect of driver, which has been validated. With
+// -driver none no strategy runs SQL, and the MySQL dialect stands in.
+func NewDialect(driver string, tidb TiDB) Dialect {
+	if newD, ok := dialects[driver]; ok {
+		return newD(tidb)
+	}
+	return mysqlDialect{}
+}
+
+// DriverNames returns the registered -driver names in sorted order.
+func DriverNames() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// productsTableSQL creates the products table in every dialect.
+const productsTableSQL = "CREATE TABLE products (id INT PRIMARY KEY, name VARCHAR(255), count BIGINT, version BIGINT NOT NULL DEFAULT 0)"
+
+// conditionalDecrementSQL is the guarded decrement every dialect shares.
+const conditionalDecrementSQL = "UPDATE products SET count = count - ? WHERE id = ? AND count >= ?"
+
+// lockClause returns the SQL:2008-style locking clause that MySQL, TiDB,
+// PostgreSQL and CockroachDB all understand.
+func lockClause(lock RowLock) string {
+	switch lock {
+	case LockNoWait:
+		return " FOR UPDATE NOWAIT"
+	case LockSkipLocked:
+		return " FOR UPDATE SKIP LOCKED"
+	default:
+		return " FOR UPDATE"
+	}
+}
+
+// lastInsertID is InsertID for drivers that support LastInsertId.
+func lastInsertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// mysqlDialect is MySQL and TiDB.
+type mysqlDialect struct {
+	schema TiDB
+}
+
+func (mysqlDialect) DriverName() string           { return "mysql" }
+func (mysqlDialect) Rebind(query string) string   { return query }
+func (mysqlDialect) ConditionalDecrement() string { return conditionalDecrementSQL }
+func (mysqlDialect) Serial() string               { return "BIGINT AUTO_INCREMENT PRIMARY KEY" }
+func (mysqlDialect) Timestamp() string            { return "DATETIME(6)" }
+
+func (d mysqlDialect) CreateSchema() []string {
+	return []string{d.schema.productsTableSQL()}
+}
+
+func (mysqlDialect) SelectForUpdate(query string, lock RowLock) string {
+	return query + lockClause(lock)
+}
+
+func (mysqlDialect) InsertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	return lastInsertID(ctx, tx, query, args...)
+}
+
+// postgresDialect is PostgreSQL and CockroachDB. Its driver rebinds
+// placeholders itself, see rebindDriver.
+type postgresDialect struct{}
+
+func (postgresDialect) DriverName() string           { return postgresDriverName }
+func (postgresDialect) Rebind(query string) string   { return rebindPlaceholders(query) }
+func (postgresDialect) CreateSchema() []string       { return []string{productsTableSQL} }
+func (postgresDialect) ConditionalDecrement() string { return conditionalDecrementSQL }
+func (postgresDialect) Serial() string               { return "BIGSERIAL PRIMARY KEY" }
+func (postgresDialect) Timestamp() string            { return "TIMESTAMP(6)" }
+
+func (postgresDialect) SelectForUpdate(query string, lock RowLock) string {
+	return query + lockClause(lock)
+}
+
+// InsertID reads the id back with RETURNING, as pgx does not implement
+// LastInsertId.
+func (postgresDialect) InsertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+	return id, err
+}
+
+// sqliteDialect is SQLite, whose transactions take the database write lock
+// up front (see SQLiteDSN).
+type sqliteDialect struct{}
+
+func (sqliteDialect) DriverName() string           { return "sqlite" }
+func (sqliteDialect) Rebind(query string) string   { return query }
+func (sqliteDialect) CreateSchema() []string       { return []string{productsTableSQL} }
+func (sqliteDialect) ConditionalDecrement() string { return conditionalDecrementSQL }
+func (sqliteDialect) Serial() string               { return "INTEGER PRIMARY KEY AUTOINCREMENT" }
+func (sqliteDialect) Timestamp() string            { return "TIMESTAMP" }
+
+// SelectForUpdate returns query unchanged: SQLite has no row locks, and the
+// BEGIN IMMEDIATE every transaction starts with already serializes writers.
+// No row is ever seen locked, so LockNoWait and LockSkipLocked need nothing
+// either.
+func (sqliteDialect) SelectForUpdate(query string, lock RowLock) string {
+	return query
+}
+
+func (sqliteDialect) InsertID(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	return lastInsertID(ctx, tx, query, args...)
+}
@@ -0,0 +1,307 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenDryRun returns a database that runs nothing: it writes every
+// statement to w instead, with its placeholders filled in, and BEGIN,
+// COMMIT and ROLLBACK for the transactions around them. Every statement
+// affects one row and every query returns one row of 1s, which lets a
+// purchase go through once as it would against a product in stock. The
+// writer it returns puts comments in between the statements.
+func OpenDryRun(w io.Writer) (*sql.DB, io.Writer) {
+	dw := &dryRunWriter{w: w}
+	return sql.OpenDB(dryRunConnector{w: dw}), dw
+}
+
+// dryRunWriter serializes the statements of concurrent connections. A run
+// of the same statement with only other values, such as the INSERT of every
+// product, is printed once with a count of the rest.
+type dryRunWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	last     string // the statement last printed, before it was filled in
+	repeated int
+}
+
+func (w *dryRunWriter) print(query, stmt string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if query == w.last && query != "" {
+		w.repeated++
+		return
+	}
+	w.flush()
+	w.last = query
+	fmt.Fprintln(w.w, strings.TrimSuffix(stmt, ";")+";")
+}
+
+// flush notes how often the last statement was repeated. w.mu must be
+// held.
+func (w *dryRunWriter) flush() {
+	if w.repeated > 0 {
+		fmt.Fprintf(w.w, "-- ... and %d more like it\n", w.repeated)
+		w.repeated = 0
+	}
+}
+
+// Write lets comments between the statements go through w, after the count
+// of the statements before them.
+func (w *dryRunWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+	w.last = ""
+	return w.w.Write(p)
+}
+
+type dryRunConnector struct {
+	w *dryRunWriter
+}
+
+func (c dryRunConnector) Connect(context.Context) (driver.Conn, error) {
+	return dryRunConn{w: c.w}, nil
+}
+
+func (c dryRunConnector) Driver() driver.Driver {
+	return dryRunDriver{w: c.w}
+}
+
+type dryRunDriver struct {
+	w *dryRunWriter
+}
+
+func (d dryRunDriver) Open(string) (driver.Conn, error) {
+	return dryRunConn{w: d.w}, nil
+}
+
+// dryRunConn prints what it is given to run.
+type dryRunConn struct {
+	w *dryRunWriter
+}
+
+var (
+	_ driver.ConnBeginTx        = dryRunConn{}
+	_ driver.ConnPrepareContext = dryRunConn{}
+	_ driver.ExecerContext      = dryRunConn{}
+	_ driver.QueryerContext     = dryRunConn{}
+)
+
+func (c dryRunConn) Prepare(query string) (driver.Stmt, error) {
+	return dryRunStmt{conn: c, query: query}, nil
+}
+
+func (c dryRunConn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c dryRunConn) Close() error { return nil }
+
+func (c dryRunConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c dryRunConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmt := "BEGIN"
+	if level := sql.IsolationLevel(opts.Isolation); level != sql.LevelDefault {
+		stmt = "SET TRANSACTION ISOLATION LEVEL " + strings.ToUpper(level.String()) + ";\n" + stmt
+	}
+	c.w.print(stmt, stmt)
+	return dryRunTx(c), nil
+}
+
+func (c dryRunConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.w.print(query, fillPlaceholders(query, args))
+	return dryRunResult{}, nil
+}
+
+func (c dryRunConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.w.print(query, fillPlaceholders(query, args))
+	return &dryRunRows{columns: make([]string, resultColumns(query))}, nil
+}
+
+type dryRunTx dryRunConn
+
+func (tx dryRunTx) Commit() error {
+	tx.w.print("COMMIT", "COMMIT")
+	return nil
+}
+
+func (tx dryRunTx) Rollback() error {
+	tx.w.print("ROLLBACK", "ROLLBACK")
+	return nil
+}
+
+type dryRunStmt struct {
+	conn  dryRunConn
+	query string
+}
+
+func (s dryRunStmt) Close() error  { return nil }
+func (s dryRunStmt) NumInput() int { return -1 }
+
+func (s dryRunStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedArgs(args))
+}
+
+func (s dryRunStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedArgs(args))
+}
+
+// namedArgs numbers args, the reverse of namedValues.
+func namedArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return named
+}
+
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) { return 1, nil }
+func (dryRunResult) RowsAffected() (int64, error) { return 1, nil }
+
+// dryRunRows is the single row of 1s of a query.
+type dryRunRows struct {
+	columns []string
+	done    bool
+}
+
+func (r *dryRunRows) Columns() []string { return r.columns }
+func (r *dryRunRows) Close() error      { return nil }
+
+func (r *dryRunRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	for i := range dest {
+		dest[i] = int64(1)
+	}
+	return nil
+}
+
+// resultColumns counts the columns a query returns: those of its
+// RETURNING clause, or else of its outermost select list. Statements such
+// as CALL return one.
+func resultColumns(query string) int {
+	upper := strings.ToUpper(query)
+	list := ""
+	if i := topLevelIndex(upper, " RETURNING "); i >= 0 {
+		list = upper[i+len(" RETURNING "):]
+	} else if strings.HasPrefix(strings.TrimSpace(upper), "SELECT ") {
+		list = strings.TrimPrefix(strings.TrimSpace(upper), "SELECT ")
+		if i := topLevelIndex(list, " FROM "); i >= 0 {
+			list = list[:i]
+		}
+	}
+	if list == "" {
+		return 1
+	}
+	n := 1
+	depth := 0
+	for _, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// topLevelIndex returns the index of the first sep in s outside
+// parentheses, or -1.
+func topLevelIndex(s, sep string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		default:
+			if depth == 0 && strings.HasPrefix(s[i:], sep) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// fillPlaceholders replaces the ? placeholders of query, outside quoted
+// strings and identifiers, and PostgreSQL's numbered ones with the SQL
+// literals of args, as rebindPlaceholders finds them.
+func fillPlaceholders(query string, args []driver.NamedValue) string {
+	literal := func(n int) string {
+		if n < 1 || n > len(args) {
+			return "?"
+		}
+		return sqlLiteral(args[n-1].Value)
+	}
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString(literal(n))
+			continue
+		case c == '$' && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			ordinal, _ := strconv.Atoi(query[i+1 : j])
+			b.WriteString(literal(ordinal))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// sqlLiteral writes v, one of the driver.Value types, as a SQL literal.
+func sqlLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(v), "'", "''") + "'"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,49 @@
+package schema
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// MySQL server error numbers that purchases under contention commonly fail with.
+const (
+	MySQLTooManyConnections = 1040
+	errDupEntry             = 1062
+	MySQLServerShutdown     = 1053
+	MySQLLockWaitTimeout    = 1205
+	MySQLDeadlock           = 1213
+	MySQLReadOnlyOption     = 1290 // --read-only, as on a demoted primary
+	MySQLReadOnlyMode       = 1836
+)
+
+// IsMySQLError reports whether err is a MySQL server error with the given number.
+func IsMySQLError(err error, number uint16) bool {
+	var myErr *mysql.MySQLError
+	return errors.As(err, &myErr) && myErr.Number == number
+}
+
+// IsLockConflict reports whether err is a MySQL deadlock or lock wait
+// timeout, or a TiDB write conflict: errors of a purchase that lost the race
+// for a row, which trying the transaction again may win.
+func IsLockConflict(err error) bool {
+	return IsMySQLError(err, MySQLDeadlock) || IsMySQLError(err, MySQLLockWaitTimeout) || IsTiDBWriteConflict(err)
+}
+
+// IsUniqueViolation reports whether err is a duplicate key error of any of
+// the SQL drivers.
+func IsUniqueViolation(err error) bool {
+	var e *sqlite.Error
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &e):
+		return e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY || e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	case SQLState(err) != "":
+		return SQLState(err) == pgUniqueViolation
+	default:
+		return IsMySQLError(err, errDupEntry)
+	}
+}
@@ -0,0 +1,164 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// postgresDriverName is the database/sql driver of postgresDialect: pgx, with
+// the strategies' ? placeholders rebound by postgresDialect.Rebind so the same
+// SQL runs unchanged.
+const postgresDriverName = "pgx-rebind"
+
+func init() {
+	sql.Register(postgresDriverName, rebindDriver{stdlib.GetDefaultDriver()})
+}
+
+// PostgreSQL SQLSTATE codes that purchases under contention commonly fail with.
+const (
+	PGSerializationFailure = "40001"
+	PGDeadlockDetected     = "40P01"
+	PGLockNotAvailable     = "55P03"
+	PGQueryCanceled        = "57014"
+	PGAdminShutdown        = "57P01"
+	PGReadOnlyTransaction  = "25006"
+	pgUniqueViolation      = "23505"
+)
+
+// SQLState returns the SQLSTATE of a PostgreSQL server error, or "".
+func SQLState(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// IsSerializationFailure reports whether err is a PostgreSQL or CockroachDB
+// serialization failure that the whole transaction can be retried after.
+func IsSerializationFailure(err error) bool {
+	return SQLState(err) == PGSerializationFailure
+}
+
+// rebindPlaceholders rewrites the ? placeholders of query, outside quoted
+// strings and identifiers, into PostgreSQL's numbered form.
+func rebindPlaceholders(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+type rebindDriver struct {
+	driver.Driver
+}
+
+func (d rebindDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{c}, nil
+}
+
+// rebindConn rebinds every query and forwards the optional interfaces that
+// pgx's connection implements, so database/sql keeps using them.
+type rebindConn struct {
+	driver.Conn
+}
+
+var (
+	_ driver.ConnBeginTx        = rebindConn{}
+	_ driver.ConnPrepareContext = rebindConn{}
+	_ driver.ExecerContext      = rebindConn{}
+	_ driver.QueryerContext     = rebindConn{}
+	_ driver.Pinger             = rebindConn{}
+	_ driver.SessionResetter    = rebindConn{}
+	_ driver.NamedValueChecker  = rebindConn{}
+	_ driver.Validator          = rebindConn{}
+)
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(postgresDialect{}.Rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, postgresDialect{}.Rebind(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, postgresDialect{}.Rebind(query), args)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, postgresDialect{}.Rebind(query), args)
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+// Package schema creates the tables of a benchmark and hides the
+// differences between the SQL databases: their dialects, DSN options and
+// error codes.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// Init drops and recreates the products table of dialect d with
+// numProducts products of stock units each. With -driver vitess, a vindex
+// shards the table.
+func Init(ctx context.Context, db *sql.DB, d Dialect, vindex string, numProducts int, stock int64) error {
+	slog.Info("Initializing schema", "products", numProducts)
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS products"); err != nil {
+		return fmt.Errorf("drop table: %w", err)
+	}
+	for _, stmt := range d.CreateSchema() {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create table: %w", err)
+		}
+	}
+	if _, ok := d.(vitessDialect); ok && vindex != "" {
+		if err := applyVSchema(ctx, db, vindex); err != nil {
+			return err
+		}
+	}
+	insertSQL := "INSERT INTO products (id, name, count) VALUES (?, ?, ?)"
+	for i := 1; i <= numProducts; i++ {
+		productName := fmt.Sprintf("T-Shirt-%d", i)
+		if _, err := db.ExecContext(ctx, insertSQL, i, productName, stock); err != nil {
+			return fmt.Errorf("insert data for product %d: %w", i, err)
+		}
+	}
+	slog.Info("Initialized products", "products", numProducts)
+	return nil
+}
+
+// CreateOrders drops and recreates the orders table of dialect d, one row
+// per order, whose unique keys allow each user a single order of each
+// product and each idempotency key a single order. Orders without a user or
+// key leave them NULL, which the keys ignore. The restocks table, which logs
+// the units restocks add beside the orders, is recreated too, so that the
+// orders can be checked against the stock later.
+func CreateOrders(ctx context.Context, db *sql.DB, d Dialect) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS orders"); err != nil {
+		return fmt.Errorf("drop orders table: %w", err)
+	}
+	createTableSQL := "CREATE TABLE orders (id " + d.Serial() + ", product_id INT NOT NULL, user_id INT NULL, quantity BIGINT NOT NULL, idempotency_key VARCHAR(36) NULL, created_at " + d.Timestamp() + " NOT NULL, UNIQUE (user_id, product_id), UNIQUE (idempotency_key))"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return fmt.Errorf("create orders table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS restocks"); err != nil {
+		return fmt.Errorf("drop restocks table: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "CREATE TABLE restocks (id "+d.Serial()+", units BIGINT NOT NULL, created_at "+d.Timestamp()+" NOT NULL)"); err != nil {
+		return fmt.Errorf("create restocks table: %w", err)
+	}
+	return nil
+}
+
+// Drop drops the products, orders and restocks tables.
+func Drop(ctx context.Context, db *sql.DB) error {
+	for _, table := range []string{"products", "orders", "restocks"} {
+		if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS "+table); err != nil {
+			return fmt.Errorf("drop %s table: %w", table, err)
+		}
+	}
+	return nil
+}
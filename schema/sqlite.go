@@ -0,0 +1,47 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DefaultSQLiteDSN is the database file used by -driver sqlite when DB_DSN is
+// not set.
+const DefaultSQLiteDSN = "file:hot-product.db"
+
+// SQLiteDSN makes every transaction of dsn start with BEGIN IMMEDIATE, which
+// takes the database write lock up front and so stands in for SELECT ... FOR
+// UPDATE, and lets writers queue on that lock for a while instead of failing
+// with SQLITE_BUSY at once.
+func SQLiteDSN(dsn string) string {
+	params := url.Values{}
+	params.Set("_txlock", "immediate")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + params.Encode()
+}
+
+// SQLiteErrorClass returns the error class of a SQLite error, or "".
+func SQLiteErrorClass(err error) string {
+	var e *sqlite.Error
+	if !errors.As(err, &e) {
+		return ""
+	}
+	switch e.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY:
+		return "busy"
+	case sqlite3.SQLITE_LOCKED:
+		return "locked"
+	default:
+		return fmt.Sprintf("sqlite_%d", e.Code()&0xff)
+	}
+}
@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// StatementRecorder receives every statement run with a context from
+// WithStatementRecorder on a database that OpenDB opened with recording:
+// its SQL with the placeholders filled in, how long it took and its error.
+type StatementRecorder interface {
+	RecordStatement(stmt string, d time.Duration, err error)
+}
+
+type statementRecorderKey struct{}
+
+// WithStatementRecorder returns a copy of ctx whose statements are recorded
+// by r. A transaction's COMMIT and ROLLBACK go to the recorder of its
+// BEGIN.
+func WithStatementRecorder(ctx context.Context, r StatementRecorder) context.Context {
+	return context.WithValue(ctx, statementRecorderKey{}, r)
+}
+
+// recordStatement passes stmt to the recorder of ctx, if it has one, and
+// returns err.
+func recordStatement(ctx context.Context, start time.Time, stmt func() string, err error) error {
+	if r, ok := ctx.Value(statementRecorderKey{}).(StatementRecorder); ok {
+		r.RecordStatement(stmt(), time.Since(start), err)
+	}
+	return err
+}
+
+// dsnConnector opens dsn with a driver that may not be a
+// driver.DriverContext.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(c.dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// recordingConnector opens recordingConns over the connections of another
+// connector.
+type recordingConnector struct {
+	driver.Connector
+}
+
+func (c recordingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return recordingConn{conn}, nil
+}
+
+// recordingConn passes the statements run with a StatementRecorder to it
+// and forwards the optional interfaces of the drivers' connections, like
+// timeoutConn.
+type recordingConn struct {
+	driver.Conn
+}
+
+var (
+	_ driver.ConnBeginTx        = recordingConn{}
+	_ driver.ConnPrepareContext = recordingConn{}
+	_ driver.ExecerContext      = recordingConn{}
+	_ driver.QueryerContext     = recordingConn{}
+	_ driver.Pinger             = recordingConn{}
+	_ driver.SessionResetter    = recordingConn{}
+	_ driver.NamedValueChecker  = recordingConn{}
+	_ driver.Validator          = recordingConn{}
+)
+
+func (c recordingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return recordingStmt{Stmt: s, query: query}, nil
+}
+
+func (c recordingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+	if err := recordStatement(ctx, start, func() string { return "BEGIN" }, err); err != nil {
+		return nil, err
+	}
+	return recordingTx{Tx: tx, ctx: ctx}, nil
+}
+
+func (c recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	return res, recordStatement(ctx, start, func() string { return fillPlaceholders(query, args) }, err)
+}
+
+func (c recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	if err == driver.ErrSkip {
+		return nil, err
+	}
+	return rows, recordStatement(ctx, start, func() string { return fillPlaceholders(query, args) }, err)
+}
+
+func (c recordingConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c recordingConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c recordingConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c recordingConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// recordingTx records COMMIT and ROLLBACK, which database/sql issues
+// without a context, with the context of BEGIN.
+type recordingTx struct {
+	driver.Tx
+	ctx context.Context
+}
+
+func (tx recordingTx) Commit() error {
+	start := time.Now()
+	return recordStatement(tx.ctx, start, func() string { return "COMMIT" }, tx.Tx.Commit())
+}
+
+func (tx recordingTx) Rollback() error {
+	start := time.Now()
+	return recordStatement(tx.ctx, start, func() string { return "ROLLBACK" }, tx.Tx.Rollback())
+}
+
+// recordingStmt records every execution of a prepared statement.
+type recordingStmt struct {
+	driver.Stmt
+	query string
+}
+
+var (
+	_ driver.StmtExecContext  = recordingStmt{}
+	_ driver.StmtQueryContext = recordingStmt{}
+)
+
+func (s recordingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedValues(args))
+	}
+	return res, recordStatement(ctx, start, func() string { return fillPlaceholders(s.query, args) }, err)
+}
+
+func (s recordingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args))
+	}
+	return rows, recordStatement(ctx, start, func() string { return fillPlaceholders(s.query, args) }, err)
+}
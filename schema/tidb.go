@@ -0,0 +1,136 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TiDBWriteConflict is the TiDB error number for a transaction that lost
+// an optimistic write conflict at commit.
+const TiDBWriteConflict = 9007
+
+// withSessionVar returns dsn with a session variable that the driver sets on
+// every new connection.
+func withSessionVar(dsn, name, value string) (string, error) {
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	if c.Params == nil {
+		c.Params = make(map[string]string)
+	}
+	c.Params[name] = "'" + value + "'"
+	return c.FormatDSN(), nil
+}
+
+// TiDB are the TiDB options the products table is created with. They
+// decide how its rows map to TiKV regions, and so whether purchases of
+// different products contend on the same region hotspot. The zero value is a
+// plain table that MySQL accepts as well.
+type TiDB struct {
+	// PrimaryKey is "clustered", "nonclustered" or "" for the server
+	// default.
+	PrimaryKey string `json:"primary_key,omitempty"`
+
+	// ShardRowIDBits scatters the implicit _tidb_rowid of a nonclustered
+	// table over 2^ShardRowIDBits shards.
+	ShardRowIDBits int `json:"shard_row_id_bits,omitempty"`
+
+	// PreSplitRegions splits the table into 2^PreSplitRegions regions when it
+	// is created rather than as it grows.
+	PreSplitRegions int `json:"pre_split_regions,omitempty"`
+
+	// AutoRandomBits, when set, keys the table by a row_id BIGINT
+	// AUTO_RANDOM(AutoRandomBits) column instead of the product ID, which
+	// becomes a unique key.
+	AutoRandomBits int `json:"auto_random_bits,omitempty"`
+}
+
+// validate rejects combinations TiDB would refuse at CREATE TABLE.
+func (s TiDB) Validate() error {
+	switch s.PrimaryKey {
+	case "", "clustered", "nonclustered":
+	default:
+		return fmt.Errorf("unknown primary key type %q (want clustered or nonclustered)", s.PrimaryKey)
+	}
+	switch {
+	case s.ShardRowIDBits < 0 || s.ShardRowIDBits > 15:
+		return fmt.Errorf("shard row ID bits %d out of range 0-15", s.ShardRowIDBits)
+	case s.AutoRandomBits < 0 || s.AutoRandomBits > 15:
+		return fmt.Errorf("auto random bits %d out of range 0-15", s.AutoRandomBits)
+	case s.PreSplitRegions < 0:
+		return fmt.Errorf("negative pre-split regions %d", s.PreSplitRegions)
+	case s.ShardRowIDBits > 0 && s.PrimaryKey != "nonclustered":
+		return fmt.Errorf("shard row ID bits require a nonclustered primary key")
+	case s.ShardRowIDBits > 0 && s.AutoRandomBits > 0:
+		return fmt.Errorf("shard row ID bits and auto random are mutually exclusive")
+	case s.AutoRandomBits > 0 && s.PrimaryKey == "nonclustered":
+		return fmt.Errorf("auto random requires a clustered primary key")
+	case s.PreSplitRegions > 0 && s.ShardRowIDBits == 0 && s.AutoRandomBits == 0:
+		return fmt.Errorf("pre-split regions require shard row ID bits or auto random")
+	case s.PreSplitRegions > max(s.ShardRowIDBits, s.AutoRandomBits):
+		return fmt.Errorf("pre-split regions %d exceed the shard bits", s.PreSplitRegions)
+	}
+	return nil
+}
+
+// productsTableSQL returns the CREATE TABLE statement of the products table.
+func (s TiDB) productsTableSQL() string {
+	if s == (TiDB{}) {
+		return productsTableSQL
+	}
+	var b strings.Builder
+	b.WriteString("CREATE TABLE products (")
+	if s.AutoRandomBits > 0 {
+		fmt.Fprintf(&b, "row_id BIGINT AUTO_RANDOM(%d), id INT NOT NULL, ", s.AutoRandomBits)
+	} else {
+		b.WriteString("id INT, ")
+	}
+	b.WriteString("name VARCHAR(255), count BIGINT, version BIGINT NOT NULL DEFAULT 0, ")
+	if s.AutoRandomBits > 0 {
+		b.WriteString("PRIMARY KEY (row_id) CLUSTERED, UNIQUE KEY uk_id (id))")
+	} else {
+		b.WriteString("PRIMARY KEY (id)")
+		if s.PrimaryKey != "" {
+			b.WriteString(" " + strings.ToUpper(s.PrimaryKey))
+		}
+		b.WriteString(")")
+	}
+	if s.ShardRowIDBits > 0 {
+		fmt.Fprintf(&b, " SHARD_ROW_ID_BITS = %d", s.ShardRowIDBits)
+	}
+	if s.PreSplitRegions > 0 {
+		fmt.Fprintf(&b, " PRE_SPLIT_REGIONS = %d", s.PreSplitRegions)
+	}
+	return b.String()
+}
+
+// IsTiDB reports whether the server behind db is TiDB rather than MySQL.
+func IsTiDB(ctx context.Context, db *sql.DB) (bool, error) {
+	var version string
+	if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+		return false, fmt.Errorf("query server version: %w", err)
+	}
+	return strings.Contains(version, "TiDB"), nil
+}
+
+// IsTiDBWriteConflict reports whether err is a TiDB optimistic write conflict.
+func IsTiDBWriteConflict(err error) bool {
+	return IsMySQLError(err, TiDBWriteConflict)
+}
+
+// TxnModeDSN applies -txn-mode to dsn.
+func TxnModeDSN(dsn, mode string) (string, error) {
+	switch mode {
+	case "":
+		return dsn, nil
+	case "optimistic", "pessimistic":
+		return withSessionVar(dsn, "tidb_txn_mode", mode)
+	default:
+		return "", fmt.Errorf("unknown txn mode %q (want optimistic or pessimistic)", mode)
+	}
+}
@@ -0,0 +1,242 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrStatementTimeout wraps the error of a statement that OpenDB's
+// statement timeout cut short.
+var ErrStatementTimeout = errors.New("statement timeout")
+
+// OpenDB opens dsn with the database/sql driver driverName. With a
+// stmtTimeout, every BEGIN, query, statement and prepare runs under a
+// deadline of its own, so that statements stuck behind row locks fail with
+// ErrStatementTimeout instead of waiting for the server's lock wait timeout;
+// COMMIT and ROLLBACK, which database/sql issues without a context, do not.
+// With record, the statements run with a context from
+// WithStatementRecorder go to its recorder.
+func OpenDB(driverName, dsn string, stmtTimeout time.Duration, record bool) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil || stmtTimeout <= 0 && !record {
+		return db, err
+	}
+	drv := db.Driver()
+	db.Close()
+	var c driver.Connector = dsnConnector{driver: drv, dsn: dsn}
+	if stmtTimeout > 0 {
+		c = timeoutConnector{driver: drv, dsn: dsn, timeout: stmtTimeout}
+	}
+	if record {
+		c = recordingConnector{c}
+	}
+	return sql.OpenDB(c), nil
+}
+
+// timeoutConnector opens timeoutConns.
+type timeoutConnector struct {
+	driver  driver.Driver
+	dsn     string
+	timeout time.Duration
+}
+
+func (c timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := dsnConnector{driver: c.driver, dsn: c.dsn}.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return timeoutConn{Conn: conn, timeout: c.timeout}, nil
+}
+
+func (c timeoutConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// timeoutConn gives every statement a deadline and forwards the optional
+// interfaces of the drivers' connections, like rebindConn.
+type timeoutConn struct {
+	driver.Conn
+	timeout time.Duration
+}
+
+var (
+	_ driver.ConnBeginTx        = timeoutConn{}
+	_ driver.ConnPrepareContext = timeoutConn{}
+	_ driver.ExecerContext      = timeoutConn{}
+	_ driver.QueryerContext     = timeoutConn{}
+	_ driver.Pinger             = timeoutConn{}
+	_ driver.SessionResetter    = timeoutConn{}
+	_ driver.NamedValueChecker  = timeoutConn{}
+	_ driver.Validator          = timeoutConn{}
+)
+
+// timeoutErr wraps err in ErrStatementTimeout if the deadline of stmtCtx,
+// rather than that of its parent ctx, ended the statement.
+func timeoutErr(ctx, stmtCtx context.Context, timeout time.Duration, err error) error {
+	if err == nil || err == driver.ErrSkip || ctx.Err() != nil || !errors.Is(stmtCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return fmt.Errorf("%w after %v: %w", ErrStatementTimeout, timeout, err)
+}
+
+func (c timeoutConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmtCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = p.PrepareContext(stmtCtx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, timeoutErr(ctx, stmtCtx, c.timeout, err)
+	}
+	return timeoutStmt{Stmt: s, timeout: c.timeout}, nil
+}
+
+func (c timeoutConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	stmtCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	tx, err := c.Conn.(driver.ConnBeginTx).BeginTx(stmtCtx, opts)
+	return tx, timeoutErr(ctx, stmtCtx, c.timeout, err)
+}
+
+func (c timeoutConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmtCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	res, err := e.ExecContext(stmtCtx, query, args)
+	return res, timeoutErr(ctx, stmtCtx, c.timeout, err)
+}
+
+func (c timeoutConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	stmtCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	rows, err := q.QueryContext(stmtCtx, query, args)
+	if err != nil {
+		cancel()
+		return nil, timeoutErr(ctx, stmtCtx, c.timeout, err)
+	}
+	return timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+func (c timeoutConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c timeoutConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c timeoutConn) CheckNamedValue(v *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c timeoutConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// timeoutStmt gives every execution of a prepared statement a deadline. Its
+// arguments are checked by the connection.
+type timeoutStmt struct {
+	driver.Stmt
+	timeout time.Duration
+}
+
+var (
+	_ driver.StmtExecContext  = timeoutStmt{}
+	_ driver.StmtQueryContext = timeoutStmt{}
+)
+
+func (s timeoutStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	stmtCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(stmtCtx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedValues(args))
+	}
+	return res, timeoutErr(ctx, stmtCtx, s.timeout, err)
+}
+
+func (s timeoutStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	stmtCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(stmtCtx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args))
+	}
+	if err != nil {
+		cancel()
+		return nil, timeoutErr(ctx, stmtCtx, s.timeout, err)
+	}
+	return timeoutRows{Rows: rows, cancel: cancel}, nil
+}
+
+// namedValues drops the names of args.
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+// timeoutRows keeps the deadline of its query until the rows are closed.
+type timeoutRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+var _ driver.RowsNextResultSet = timeoutRows{}
+
+func (r timeoutRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+func (r timeoutRows) HasNextResultSet() bool {
+	n, ok := r.Rows.(driver.RowsNextResultSet)
+	return ok && n.HasNextResultSet()
+}
+
+func (r timeoutRows) NextResultSet() error {
+	if n, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return n.NextResultSet()
+	}
+	return io.EOF
+}
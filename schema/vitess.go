@@ -0,0 +1,128 @@
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// VitessOptions are the settings of -driver vitess, which talks to a VTGate
+// in front of a possibly sharded keyspace, named by the database of DB_DSN.
+type VitessOptions struct {
+	// Vindex, if set, is the primary vindex type, such as hash or xxhash,
+	// that the products table is sharded by on its id. Every product then
+	// lives on exactly one shard, so a purchase stays a single-shard
+	// transaction. It needs no VSchema set up beforehand, but VTGate must
+	// allow VSchema DDL (--vschema_ddl_authorized_users). Strategies with
+	// tables of their own need those added to the VSchema as well.
+	Vindex string `json:"vindex,omitempty"`
+
+	// TxnMode is VTGate's transaction_mode: "single" fails transactions
+	// that would span shards rather than commit them non-atomically,
+	// "multi" allows best-effort multi-shard commits and "twopc" two-phase
+	// commits.
+	TxnMode string `json:"txn_mode"`
+
+	// LockWaitTimeout sets innodb_lock_wait_timeout for the FOR UPDATE
+	// waits on the hot row. The tablets can only honour a session variable
+	// on a reserved connection, which VTGate then keeps for the session
+	// instead of sharing the tablet's pool.
+	LockWaitTimeout time.Duration `json:"lock_wait_timeout,omitempty"`
+}
+
+func (o VitessOptions) Validate() error {
+	switch o.TxnMode {
+	case "single", "multi", "twopc":
+	default:
+		return fmt.Errorf("unknown vitess txn mode %q (want single, multi or twopc)", o.TxnMode)
+	}
+	if o.LockWaitTimeout != 0 && o.LockWaitTimeout < time.Second {
+		return fmt.Errorf("-vitess-lock-wait-timeout must be at least 1s")
+	}
+	return nil
+}
+
+// VitessDSN applies o to dsn.
+func VitessDSN(dsn string, o VitessOptions) (string, error) {
+	dsn, err := withSessionVar(dsn, "transaction_mode", strings.ToUpper(o.TxnMode))
+	if err != nil || o.LockWaitTimeout == 0 {
+		return dsn, err
+	}
+	c, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	c.Params["innodb_lock_wait_timeout"] = strconv.Itoa(int(o.LockWaitTimeout / time.Second))
+	return c.FormatDSN(), nil
+}
+
+// vitessDialect is MySQL behind VTGate.
+type vitessDialect struct {
+	mysqlDialect
+}
+
+func (vitessDialect) CreateSchema() []string { return []string{productsTableSQL} }
+
+// applyVSchema adds the primary vindex to the products table unless it
+// already has one, as it does after an earlier run: dropping the table
+// leaves its VSchema in place.
+func applyVSchema(ctx context.Context, db *sql.DB, vindex string) error {
+	rows, err := db.QueryContext(ctx, "SHOW VSCHEMA VINDEXES ON products")
+	if err != nil {
+		return fmt.Errorf("show vschema: %w", err)
+	}
+	found := rows.Next()
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("show vschema: %w", err)
+	}
+	if found {
+		return nil
+	}
+	stmt := fmt.Sprintf("ALTER VSCHEMA ON products ADD VINDEX %[1]s(id) USING %[1]s", vindex)
+	if _, err := db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("add vindex: %w", err)
+	}
+	slog.Info("Sharded products by vindex", "vindex", vindex)
+	return nil
+}
+
+// VitessErrorClass returns the error class of an error raised by VTGate or a
+// tablet rather than by MySQL, or "".
+func VitessErrorClass(err error) string {
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) {
+		return ""
+	}
+	msg := myErr.Message
+	switch {
+	case !strings.Contains(msg, "vttablet") && !strings.Contains(msg, "vtgate") && !strings.Contains(msg, "multi-db"):
+		return ""
+	case strings.Contains(msg, "exceeded timeout"), strings.Contains(msg, "tx killer"), strings.Contains(msg, "ended at"):
+		// The tablet's transaction killer rolled back a transaction that
+		// ran longer than its transaction timeout.
+		return "tx_killed"
+	case strings.Contains(msg, "transaction pool connection limit exceeded"):
+		return "tx_pool_full"
+	case strings.Contains(msg, "multi-db transaction attempted"):
+		return "cross_shard"
+	}
+	return ""
+}
+
+// IsVitessRetryable reports whether err is a purchase that Vitess gave up on
+// rather than one that failed, so trying it again may succeed.
+func IsVitessRetryable(err error) bool {
+	switch VitessErrorClass(err) {
+	case "tx_killed", "tx_pool_full":
+		return true
+	}
+	return false
+}
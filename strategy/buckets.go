@@ -0,0 +1,90 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// bucketStrategy splits every product's stock across several rows of the
+// product_buckets table and decrements a randomly chosen bucket, so that
+// concurrent purchases of one product rarely contend on the same row. An
+// order must be served from a single bucket, so a product reports sold out
+// once no bucket holds the order quantity, even if the buckets together do.
+type bucketStrategy struct {
+	numProducts int
+	numBuckets  int
+	stock       int64
+}
+
+// Init creates the product_buckets table and spreads the stock of every
+// product evenly across its buckets.
+func (s bucketStrategy) Init(ctx context.Context, db *sql.DB) error {
+	if err := s.Start(ctx, db); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS product_buckets"); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE product_buckets (product_id INT, bucket_id INT, count BIGINT, PRIMARY KEY (product_id, bucket_id));"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+
+	insertSQL := "INSERT INTO product_buckets (product_id, bucket_id, count) VALUES (?, ?, ?)"
+	perBucket := s.stock / int64(s.numBuckets)
+	remainder := s.stock % int64(s.numBuckets)
+	for p := 1; p <= s.numProducts; p++ {
+		for b := 0; b < s.numBuckets; b++ {
+			count := perBucket
+			if int64(b) < remainder {
+				count++
+			}
+			if _, err := db.ExecContext(ctx, insertSQL, p, b, count); err != nil {
+				return fmt.Errorf("insert bucket %d for product %d: %w", b, p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Start checks the number of buckets, which purchases draw from.
+func (s bucketStrategy) Start(ctx context.Context, db *sql.DB) error {
+	if s.numBuckets < 1 {
+		return fmt.Errorf("buckets must be at least 1, got %d", s.numBuckets)
+	}
+	return nil
+}
+
+// Clean drops the product_buckets table.
+func (bucketStrategy) Clean(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS product_buckets")
+	return err
+}
+
+func (s bucketStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	// Start at a random bucket and walk the others once it runs dry.
+	first := Rand(ctx).Intn(s.numBuckets)
+	for i := 0; i < s.numBuckets; i++ {
+		bucketID := (first + i) % s.numBuckets
+		res, err := db.ExecContext(ctx, "UPDATE product_buckets SET count = count - ? WHERE product_id = ? AND bucket_id = ? AND count >= ?", order.Quantity, order.ProductID, bucketID, order.Quantity)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			return nil
+		}
+	}
+	return ErrSoldOut
+}
+
+// TotalStock sums the remaining stock over all buckets.
+func (bucketStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	var total int64
+	err := db.QueryRowContext(ctx, "SELECT SUM(count) FROM product_buckets").Scan(&total)
+	return total, err
+}
@@ -0,0 +1,142 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cacheStrategy answers stock checks from an in-process cache and only goes
+// to the database, with a conditional decrement, when the cache still shows
+// stock. A reconciliation loop periodically reloads the cache from the
+// products table and records how far the two had drifted apart.
+type cacheStrategy struct {
+	interval  time.Duration
+	decrement conditionalStrategy
+
+	db    *sql.DB
+	stock []atomic.Int64 // cached stock, indexed by product ID
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	maxDrift        atomic.Int64
+	reconciles      atomic.Int64
+	reconcileTime   atomic.Int64 // nanoseconds summed over all reconciliations
+	maxReconcileDur atomic.Int64
+	cacheRejects    atomic.Int64
+}
+
+func newCacheStrategy(cfg *Config) *cacheStrategy {
+	return &cacheStrategy{
+		interval:  cfg.ReconcileInterval,
+		decrement: conditionalStrategy{dialect: cfg.Dialect()},
+		stock:     make([]atomic.Int64, cfg.NumProducts+1),
+	}
+}
+
+// Start fills the cache and starts the reconciliation loop.
+func (s *cacheStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.db = db
+	if err := s.reconcile(ctx); err != nil {
+		return err
+	}
+	s.maxDrift.Store(0)
+
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.reconcileLoop()
+	return nil
+}
+
+func (s *cacheStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	cached := &s.stock[order.ProductID]
+	if cached.Load() < order.Quantity {
+		s.cacheRejects.Add(1)
+		return ErrSoldOut
+	}
+
+	err := s.decrement.Purchase(ctx, db, order)
+	if err == nil {
+		cached.Add(-order.Quantity)
+	}
+	return err
+}
+
+// reconcileLoop reloads the cache every interval until Stop.
+func (s *cacheStrategy) reconcileLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.reconcile(context.Background()); err != nil {
+				slog.Error("Cache reconciliation failed", "err", err)
+			}
+		}
+	}
+}
+
+// reconcile overwrites the cache with the products table, tracking the
+// largest per-product drift and how long the pass took.
+func (s *cacheStrategy) reconcile(ctx context.Context) error {
+	start := time.Now()
+	rows, err := s.db.QueryContext(ctx, "SELECT id, count FROM products")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		if id < 1 || id >= len(s.stock) {
+			continue
+		}
+		drift := s.stock[id].Swap(count) - count
+		storeMax(&s.maxDrift, max(drift, -drift))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	elapsed := int64(time.Since(start))
+	s.reconciles.Add(1)
+	s.reconcileTime.Add(elapsed)
+	storeMax(&s.maxReconcileDur, elapsed)
+	return nil
+}
+
+// Stop halts the reconciliation loop and reports the observed drift.
+func (s *cacheStrategy) Stop(ctx context.Context) error {
+	close(s.stop)
+	s.wg.Wait()
+	if err := s.reconcile(ctx); err != nil {
+		return err
+	}
+
+	n := s.reconciles.Load()
+	slog.Info("Cache stats", "reconciliations", n, "max_drift", s.maxDrift.Load(),
+		"reconcile_avg", time.Duration(s.reconcileTime.Load()/n), "reconcile_max", time.Duration(s.maxReconcileDur.Load()),
+		"rejected_from_cache", s.cacheRejects.Load())
+	return nil
+}
+
+// storeMax raises v to n if n is larger.
+func storeMax(v *atomic.Int64, n int64) {
+	for {
+		cur := v.Load()
+		if n <= cur || v.CompareAndSwap(cur, n) {
+			return
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+
+	"update_one_record/schema"
+)
+
+// cartStrategy buys a cart of several distinct products in one transaction,
+// the order quantity of each.
+// Each item runs under its own savepoint, so a sold-out item is rolled back
+// and dropped from the order without aborting the rest of the cart.
+type cartStrategy struct {
+	dialect     schema.Dialect
+	cartSize    int
+	numProducts int
+
+	db      *sql.DB
+	initial []int64        // stock at Start, indexed by product ID
+	sold    []atomic.Int64 // units sold, indexed by product ID
+}
+
+func newCartStrategy(cfg *Config) *cartStrategy {
+	return &cartStrategy{
+		dialect:     cfg.Dialect(),
+		cartSize:    max(1, min(cfg.CartSize, cfg.NumProducts)),
+		numProducts: cfg.NumProducts,
+		initial:     make([]int64, cfg.NumProducts+1),
+		sold:        make([]atomic.Int64, cfg.NumProducts+1),
+	}
+}
+
+// Start notes the stock of every product, fresh or left by an earlier run,
+// for Stop to check against.
+func (s *cartStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.db = db
+	return s.scanStock(ctx, func(id int, count int64) {
+		s.initial[id] = count
+	})
+}
+
+// scanStock calls f with the stock of every product of the run.
+func (s *cartStrategy) scanStock(ctx context.Context, f func(id int, count int64)) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, count FROM products WHERE id BETWEEN ? AND ? ORDER BY id", 1, s.numProducts)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		f(id, count)
+	}
+	return rows.Err()
+}
+
+// Purchase buys the ordered product plus cartSize-1 other random products. It
+// returns ErrSoldOut only when every item of the cart was sold out.
+func (s *cartStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	items := s.cart(ctx, order.ProductID)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var bought []int
+	for i, id := range items {
+		savepoint := fmt.Sprintf("item%d", i)
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+			return err
+		}
+
+		var currentStock int64
+		if err := tx.QueryRowContext(ctx, s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", schema.LockWait), id).Scan(&currentStock); err != nil {
+			return err
+		}
+		if currentStock < order.Quantity {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", order.Quantity, id); err != nil {
+			return err
+		}
+		bought = append(bought, id)
+	}
+
+	if len(bought) == 0 {
+		return ErrSoldOut
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, id := range bought {
+		s.sold[id].Add(order.Quantity)
+	}
+	return nil
+}
+
+// cart returns productID and cartSize-1 other distinct products in ascending
+// order, so that concurrent carts lock rows in the same order and cannot
+// deadlock each other.
+func (s *cartStrategy) cart(ctx context.Context, productID int) []int {
+	items := []int{productID}
+	seen := map[int]bool{productID: true}
+	for len(items) < s.cartSize {
+		id := Rand(ctx).Intn(s.numProducts) + 1
+		if !seen[id] {
+			seen[id] = true
+			items = append(items, id)
+		}
+	}
+	sort.Ints(items)
+	return items
+}
+
+// UnitsSold returns the number of units sold over all carts.
+func (s *cartStrategy) UnitsSold() int64 {
+	var total int64
+	for i := range s.sold {
+		total += s.sold[i].Load()
+	}
+	return total
+}
+
+// Stop checks every product's remaining stock against the units the carts
+// sold of it.
+func (s *cartStrategy) Stop(ctx context.Context) error {
+	var mismatched int
+	err := s.scanStock(ctx, func(id int, count int64) {
+		if want := s.initial[id] - s.sold[id].Load(); count != want {
+			mismatched++
+			slog.Error("Cart stock mismatch", "product", id, "count", count, "expected", want)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("%d products disagree with the units sold by carts", mismatched)
+	}
+	slog.Info("Cart stock matches units sold", "products", s.numProducts, "units_sold", s.UnitsSold())
+	return nil
+}
@@ -0,0 +1,111 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// casStrategy reads the stock without locking and applies the decrement only
+// if the count is unchanged (compare-and-swap), retrying with exponential
+// backoff and full jitter up to maxRetries times.
+type casStrategy struct {
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+
+	// retries[n] counts purchases that succeeded or sold out after n retries;
+	// the last slot counts purchases that gave up.
+	retries []atomic.Int64
+}
+
+func newCASStrategy(cfg *Config) *casStrategy {
+	return &casStrategy{
+		maxRetries:  cfg.MaxRetries,
+		backoffBase: cfg.BackoffBase,
+		backoffMax:  cfg.BackoffMax,
+		retries:     make([]atomic.Int64, cfg.MaxRetries+2),
+	}
+}
+
+func (s *casStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			NoteRetry(ctx)
+			if err := SleepContext(ctx, JitteredBackoff(ctx, s.backoffBase, s.backoffMax, attempt)); err != nil {
+				return err
+			}
+		}
+
+		var currentStock int64
+		phaseCtx, end := StartPhase(ctx, "select")
+		err := db.QueryRowContext(phaseCtx, "SELECT count FROM products WHERE id = ?", order.ProductID).Scan(&currentStock)
+		end(err)
+		if err != nil {
+			return err
+		}
+		if currentStock < order.Quantity {
+			s.retries[attempt].Add(1)
+			return ErrSoldOut
+		}
+
+		phaseCtx, end = StartPhase(ctx, "update")
+		res, err := db.ExecContext(phaseCtx, "UPDATE products SET count = count - ? WHERE id = ? AND count = ?", order.Quantity, order.ProductID, currentStock)
+		end(err)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			s.retries[attempt].Add(1)
+			return nil
+		}
+	}
+	s.retries[s.maxRetries+1].Add(1)
+	return ErrTooManyRetries
+}
+
+// Stop reports how many retries purchases needed.
+func (s *casStrategy) Stop(ctx context.Context) error {
+	var b strings.Builder
+	for n := 0; n <= s.maxRetries; n++ {
+		if c := s.retries[n].Load(); c > 0 {
+			fmt.Fprintf(&b, " %d:%d", n, c)
+		}
+	}
+	fmt.Fprintf(&b, " gave-up:%d", s.retries[s.maxRetries+1].Load())
+	slog.Info("CAS retries per purchase", "retries:purchases", strings.TrimSpace(b.String()))
+	return nil
+}
+
+// JitteredBackoff returns a random delay in [0, min(maxDelay, base*2^(attempt-1))),
+// drawn from the generator of ctx.
+func JitteredBackoff(ctx context.Context, base, maxDelay time.Duration, attempt int) time.Duration {
+	d := base << (attempt - 1)
+	if d <= 0 || d > maxDelay {
+		d = maxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(Rand(ctx).Int63n(int64(d)))
+}
+
+// SleepContext sleeps for d or until ctx is done.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
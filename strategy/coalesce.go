@@ -0,0 +1,176 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// coalesceStrategy batches concurrent purchases of the same product that
+// arrive within a short window and applies each batch with a single
+// count = count - N statement, N being the summed quantity of the batch, and
+// acknowledges every caller individually.
+type coalesceStrategy struct {
+	dialect schema.Dialect
+	window  time.Duration
+
+	db     *sql.DB
+	mu     sync.Mutex
+	queues map[int]chan coalesceRequest
+	wg     sync.WaitGroup
+
+	batches   atomic.Int64
+	purchases atomic.Int64
+}
+
+// coalesceRequest is one pending purchase waiting for its batch to commit.
+type coalesceRequest struct {
+	quantity int64
+	done     chan error
+}
+
+func newCoalesceStrategy(cfg *Config) *coalesceStrategy {
+	return &coalesceStrategy{
+		dialect: cfg.Dialect(),
+		window:  cfg.CoalesceWindow,
+		queues:  make(map[int]chan coalesceRequest),
+	}
+}
+
+func (s *coalesceStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.db = db
+	return nil
+}
+
+// Purchase queues the order for the next batch of its product and waits for
+// the batch to commit. Once queued, the order is applied or refused whatever
+// becomes of ctx, so Purchase waits for the outcome rather than report one it
+// does not know.
+func (s *coalesceStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	req := coalesceRequest{quantity: order.Quantity, done: make(chan error, 1)}
+	select {
+	case s.queue(order.ProductID) <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+// queue returns the request queue of productID, starting its aggregator on
+// first use.
+func (s *coalesceStrategy) queue(productID int) chan<- coalesceRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[productID]
+	if !ok {
+		q = make(chan coalesceRequest, 1024)
+		s.queues[productID] = q
+		s.wg.Add(1)
+		go s.aggregate(productID, q)
+	}
+	return q
+}
+
+// aggregate collects requests for one product until the window after the
+// first request elapses, then applies them as one batch.
+func (s *coalesceStrategy) aggregate(productID int, requests <-chan coalesceRequest) {
+	defer s.wg.Done()
+
+	for first := range requests {
+		batch := []coalesceRequest{first}
+		timer := time.NewTimer(s.window)
+	collect:
+		for {
+			select {
+			case req, ok := <-requests:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, req)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		s.apply(productID, batch)
+	}
+}
+
+// apply grants the requests of batch in arrival order for as long as the
+// stock covers them, and fails the rest with ErrSoldOut.
+func (s *coalesceStrategy) apply(productID int, batch []coalesceRequest) {
+	granted, err := s.decrement(productID, batch)
+	for i, req := range batch {
+		switch {
+		case err != nil:
+			req.done <- err
+		case granted[i]:
+			req.done <- nil
+		default:
+			req.done <- ErrSoldOut
+		}
+	}
+	s.batches.Add(1)
+}
+
+// decrement takes the quantities of the granted requests of batch off
+// productID in one transaction and reports which requests were granted.
+func (s *coalesceStrategy) decrement(productID int, batch []coalesceRequest) ([]bool, error) {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var currentStock int64
+	err = tx.QueryRowContext(ctx, s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", schema.LockWait), productID).Scan(&currentStock)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make([]bool, len(batch))
+	var taken, orders int64
+	for i, req := range batch {
+		if currentStock-taken >= req.quantity {
+			granted[i] = true
+			taken += req.quantity
+			orders++
+		}
+	}
+	if taken == 0 {
+		return granted, nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", taken, productID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	s.purchases.Add(orders)
+	return granted, nil
+}
+
+// Stop shuts the aggregators down and reports the achieved batching.
+func (s *coalesceStrategy) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	for _, q := range s.queues {
+		close(q)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	batches, purchases := s.batches.Load(), s.purchases.Load()
+	var avg float64
+	if batches > 0 {
+		avg = float64(purchases) / float64(batches)
+	}
+	slog.Info("Coalesce stats", "purchases", purchases, "batches", batches, "per_batch", round1(avg))
+	return nil
+}
@@ -0,0 +1,65 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+
+	"update_one_record/schema"
+)
+
+// conditionalStrategy decrements the stock in a single statement guarded by
+// count >= quantity, using RowsAffected to detect that the product is sold out.
+// With orders set the statement runs in a transaction that also records the
+// order.
+type conditionalStrategy struct {
+	dialect schema.Dialect
+	orders  bool
+}
+
+func (conditionalStrategy) RecordsOrders() {}
+
+func (s conditionalStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	if !s.orders {
+		return s.decrement(ctx, db, order)
+	}
+	_, end := StartPhase(ctx, "begin")
+	tx, err := db.BeginTx(ctx, nil)
+	end(err)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := s.decrement(ctx, tx, order); err != nil {
+		return err
+	}
+	if err := recordOrder(ctx, tx, order); err != nil {
+		return err
+	}
+	_, end = StartPhase(ctx, "commit")
+	err = tx.Commit()
+	end(err)
+	return err
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// decrement runs the guarded UPDATE on db.
+func (s conditionalStrategy) decrement(ctx context.Context, db execer, order Order) error {
+	phaseCtx, end := StartPhase(ctx, "update")
+	res, err := db.ExecContext(phaseCtx, s.dialect.ConditionalDecrement(), order.Quantity, order.ProductID, order.Quantity)
+	end(err)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSoldOut
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach-go/v2/crdb"
+	"update_one_record/schema"
+)
+
+// crdbStrategy runs the for-update transaction under CockroachDB's client-side
+// retry protocol: the work happens behind SAVEPOINT cockroach_restart and a
+// serialization failure (40001) rolls back to the savepoint and retries in
+// the same transaction, up to maxRetries times.
+type crdbStrategy struct {
+	dialect    schema.Dialect
+	maxRetries int
+	orders     bool
+}
+
+func (crdbStrategy) RecordsOrders() {}
+
+func (s crdbStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	attempt := 0
+	err := crdb.ExecuteTx(crdb.WithMaxRetries(ctx, s.maxRetries), db, nil, func(tx *sql.Tx) error {
+		if attempt++; attempt > 1 {
+			NoteRetry(ctx)
+		}
+		var currentStock int64
+		if err := tx.QueryRowContext(ctx, s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", schema.LockWait), order.ProductID).Scan(&currentStock); err != nil {
+			return err
+		}
+		if currentStock < order.Quantity {
+			return ErrSoldOut
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", order.Quantity, order.ProductID); err != nil {
+			return err
+		}
+		if s.orders {
+			return recordOrder(ctx, tx, order)
+		}
+		return nil
+	})
+	var maxErr *crdb.MaxRetriesExceededError
+	if errors.As(err, &maxErr) {
+		return fmt.Errorf("%w: %w", ErrTooManyRetries, err)
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// dynamoTableTimeout bounds how long Seed waits for a new table to become
+// active.
+const dynamoTableTimeout = 2 * time.Minute
+
+// dynamoStrategy keeps the stock in a DynamoDB table with one item per
+// product and decrements it with a conditional UpdateItem, so every purchase
+// of a product hits the same partition key the way the SQL strategies hit
+// the same row. It needs no SQL database.
+type dynamoStrategy struct {
+	table       string
+	endpoint    string
+	numProducts int
+
+	client *dynamodb.Client
+}
+
+func newDynamoStrategy(cfg *Config) *dynamoStrategy {
+	return &dynamoStrategy{table: cfg.DynamoDBTable, endpoint: cfg.DynamoDBEndpoint, numProducts: cfg.NumProducts}
+}
+
+func dynamoKey(productID int) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)}}
+}
+
+// connect creates the client, unless Seed or Start already did.
+func (s *dynamoStrategy) connect(ctx context.Context) error {
+	if s.client != nil {
+		return nil
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("load aws config: %w", err)
+	}
+	s.client = dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if s.endpoint != "" {
+			o.BaseEndpoint = aws.String(s.endpoint)
+		}
+	})
+	return nil
+}
+
+// Seed creates the table unless it exists, with on-demand capacity, and
+// writes the stock item of every product.
+func (s *dynamoStrategy) Seed(ctx context.Context, numProducts int, stock int64) error {
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	_, err := s.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(s.table),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("id"), AttributeType: types.ScalarAttributeTypeN}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("id"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("create table %s: %w", s.table, err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(s.client)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(s.table)}, dynamoTableTimeout); err != nil {
+		return fmt.Errorf("wait for table %s: %w", s.table, err)
+	}
+
+	for id := 1; id <= numProducts; id++ {
+		item := dynamoKey(id)
+		item["stock"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(stock, 10)}
+		if _, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String(s.table), Item: item}); err != nil {
+			return fmt.Errorf("seed product %d: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// Start creates the client for a run that reuses the stock of an earlier
+// one.
+func (s *dynamoStrategy) Start(ctx context.Context, db *sql.DB) error {
+	return s.connect(ctx)
+}
+
+func (s *dynamoStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	quantity := &types.AttributeValueMemberN{Value: strconv.FormatInt(order.Quantity, 10)}
+	phaseCtx, end := StartPhase(ctx, "update")
+	_, err := s.client.UpdateItem(phaseCtx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.table),
+		Key:                       dynamoKey(order.ProductID),
+		UpdateExpression:          aws.String("SET stock = stock - :q"),
+		ConditionExpression:       aws.String("stock >= :q"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":q": quantity},
+	})
+	end(err)
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return ErrSoldOut
+	}
+	return err
+}
+
+// TotalStock sums the stock items with strongly consistent reads.
+func (s *dynamoStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	if err := s.connect(ctx); err != nil {
+		return 0, err
+	}
+	var total int64
+	for id := 1; id <= s.numProducts; id++ {
+		out, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.table),
+			Key:            dynamoKey(id),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("read product %d: %w", id, err)
+		}
+		v, ok := out.Item["stock"].(*types.AttributeValueMemberN)
+		if !ok {
+			return 0, fmt.Errorf("product %d has no stock", id)
+		}
+		n, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("stock of product %d: %w", id, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// dynamoErrorClass returns the error class of a DynamoDB error, or "".
+func dynamoErrorClass(err error) string {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	switch code := apiErr.ErrorCode(); code {
+	case "ProvisionedThroughputExceededException", "ThrottlingException", "RequestLimitExceeded":
+		return "throttled"
+	case "TransactionConflictException":
+		return "write_conflict"
+	default:
+		return "dynamodb_" + code
+	}
+}
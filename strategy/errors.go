@@ -0,0 +1,75 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+	"update_one_record/schema"
+)
+
+// ErrorClass returns the key under which a failed purchase is counted in the
+// error breakdown.
+func ErrorClass(err error) string {
+	var (
+		myErr  *mysql.MySQLError
+		netErr net.Error
+	)
+	switch {
+	case errors.Is(err, ErrTooManyRetries):
+		return "too_many_retries"
+	case errors.Is(err, schema.ErrStatementTimeout):
+		return "stmt_timeout"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn), errors.Is(err, sql.ErrConnDone), errors.As(err, &netErr):
+		return "connection"
+	case schema.SQLiteErrorClass(err) != "":
+		return schema.SQLiteErrorClass(err)
+	case dynamoErrorClass(err) != "":
+		return dynamoErrorClass(err)
+	case schema.VitessErrorClass(err) != "":
+		return schema.VitessErrorClass(err)
+	case schema.SQLState(err) != "":
+		switch code := schema.SQLState(err); code {
+		case schema.PGDeadlockDetected:
+			return "deadlock"
+		case schema.PGLockNotAvailable:
+			return "lock_nowait"
+		case schema.PGSerializationFailure:
+			return "serialization_failure"
+		case schema.PGQueryCanceled:
+			return "timeout"
+		case schema.PGReadOnlyTransaction:
+			return "read_only"
+		case schema.PGAdminShutdown:
+			return "connection"
+		default:
+			return "pg_" + code
+		}
+	case errors.As(err, &myErr):
+		switch myErr.Number {
+		case schema.MySQLLockWaitTimeout:
+			return "lock_wait_timeout"
+		case schema.MySQLDeadlock:
+			return "deadlock"
+		case errLockNowait:
+			return "lock_nowait"
+		case schema.TiDBWriteConflict:
+			return "write_conflict"
+		case schema.MySQLTooManyConnections, schema.MySQLServerShutdown:
+			return "connection"
+		case schema.MySQLReadOnlyOption, schema.MySQLReadOnlyMode:
+			return "read_only"
+		}
+		return fmt.Sprintf("mysql_%d", myErr.Number)
+	default:
+		return "other"
+	}
+}
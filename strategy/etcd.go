@@ -0,0 +1,155 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdDialTimeout bounds connecting to the etcd cluster.
+const etcdDialTimeout = 5 * time.Second
+
+// etcdStrategy keeps the stock of every product under one etcd key and
+// decrements it with a compare-and-swap transaction on the key's mod
+// revision, retried up to maxRetries times when another purchase got there
+// first. Every write goes through Raft on the leader, which shows how a
+// consensus store serializes a hot key compared with a row lock. It needs no
+// SQL database.
+type etcdStrategy struct {
+	endpoints   []string
+	numProducts int
+	maxRetries  int
+
+	client *clientv3.Client
+}
+
+func newEtcdStrategy(cfg *Config) *etcdStrategy {
+	return &etcdStrategy{endpoints: strings.Split(cfg.EtcdEndpoints, ","), numProducts: cfg.NumProducts, maxRetries: cfg.MaxRetries}
+}
+
+func etcdStockKey(productID int) string {
+	return fmt.Sprintf("/hot-product/stock/%d", productID)
+}
+
+// connect connects to the cluster, unless Seed or Start already did.
+func (s *etcdStrategy) connect(ctx context.Context) error {
+	if s.client != nil {
+		return nil
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: s.endpoints, DialTimeout: etcdDialTimeout})
+	if err != nil {
+		return fmt.Errorf("connect to etcd: %w", err)
+	}
+	pingCtx, cancel := context.WithTimeout(ctx, etcdDialTimeout)
+	defer cancel()
+	if _, err := client.Status(pingCtx, s.endpoints[0]); err != nil {
+		client.Close()
+		return fmt.Errorf("connect to etcd: %w", err)
+	}
+	s.client = client
+	return nil
+}
+
+// Seed writes the initial stock of every product.
+func (s *etcdStrategy) Seed(ctx context.Context, numProducts int, stock int64) error {
+	if err := s.connect(ctx); err != nil {
+		return err
+	}
+	value := strconv.FormatInt(stock, 10)
+	for p := 1; p <= numProducts; p++ {
+		if _, err := s.client.Put(ctx, etcdStockKey(p), value); err != nil {
+			return fmt.Errorf("seed product %d: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// Start connects to the cluster for a run that reuses the stock of an
+// earlier one.
+func (s *etcdStrategy) Start(ctx context.Context, db *sql.DB) error {
+	return s.connect(ctx)
+}
+
+func (s *etcdStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	key := etcdStockKey(order.ProductID)
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			NoteRetry(ctx)
+		}
+		swapped, err := s.decrement(ctx, key, order.Quantity)
+		if err != nil || swapped {
+			return err
+		}
+	}
+	return ErrTooManyRetries
+}
+
+// decrement reads key and writes it back quantity lower unless it changed in
+// between. It reports whether the swap happened.
+func (s *etcdStrategy) decrement(ctx context.Context, key string, quantity int64) (bool, error) {
+	phaseCtx, end := StartPhase(ctx, "select")
+	resp, err := s.client.Get(phaseCtx, key)
+	end(err)
+	if err != nil {
+		return false, err
+	}
+	if len(resp.Kvs) == 0 {
+		return false, fmt.Errorf("stock key %s missing", key)
+	}
+	kv := resp.Kvs[0]
+	currentStock, err := strconv.ParseInt(string(kv.Value), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("decode stock %q: %w", kv.Value, err)
+	}
+	if currentStock < quantity {
+		return false, ErrSoldOut
+	}
+
+	phaseCtx, end = StartPhase(ctx, "update")
+	txn, err := s.client.Txn(phaseCtx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(key, strconv.FormatInt(currentStock-quantity, 10))).
+		Commit()
+	end(err)
+	if err != nil {
+		return false, err
+	}
+	return txn.Succeeded, nil
+}
+
+// TotalStock sums the stock keys of all products.
+func (s *etcdStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	if err := s.connect(ctx); err != nil {
+		return 0, err
+	}
+	resp, err := s.client.Get(ctx, "/hot-product/stock/", clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+	values := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+	var total int64
+	for p := 1; p <= s.numProducts; p++ {
+		n, err := strconv.ParseInt(values[etcdStockKey(p)], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("decode stock of product %d: %w", p, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Close closes the etcd client once the stock has been verified.
+func (s *etcdStrategy) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
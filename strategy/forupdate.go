@@ -0,0 +1,117 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// errLockNowait is the MySQL/TiDB error number returned when a NOWAIT
+// locking read finds the row already locked.
+const errLockNowait = 3572
+
+// forUpdateStrategy locks the product row with SELECT ... FOR UPDATE, checks
+// the stock and decrements it in the same transaction. With nowait set the
+// locking read fails immediately instead of queueing behind the lock holder.
+// With hold set the transaction sleeps that long before it commits, keeping
+// the row locked, so that by Little's law the product cannot sell faster
+// than one order per hold time however many workers buy it. With orders set
+// every purchase is recorded in the orders table before the commit.
+type forUpdateStrategy struct {
+	dialect schema.Dialect
+	nowait  bool
+	hold    time.Duration
+	orders  bool
+
+	locked   atomic.Int64
+	aborted  atomic.Int64
+	lockWait atomic.Int64 // nanoseconds spent acquiring granted locks
+}
+
+func (s *forUpdateStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	_, end := StartPhase(ctx, "begin")
+	tx, err := db.BeginTx(ctx, nil)
+	end(err)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	lock := schema.LockWait
+	if s.nowait {
+		lock = schema.LockNoWait
+	}
+	query := s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", lock)
+
+	var currentStock int64
+	start := time.Now()
+	phaseCtx, end := StartPhase(ctx, "select")
+	err = tx.QueryRowContext(phaseCtx, query, order.ProductID).Scan(&currentStock)
+	end(err)
+	if err != nil {
+		if schema.IsMySQLError(err, errLockNowait) || schema.SQLState(err) == schema.PGLockNotAvailable {
+			s.aborted.Add(1)
+		}
+		return err
+	}
+	s.locked.Add(1)
+	s.lockWait.Add(int64(time.Since(start)))
+
+	if currentStock < order.Quantity {
+		return ErrSoldOut
+	}
+
+	phaseCtx, end = StartPhase(ctx, "update")
+	_, err = tx.ExecContext(phaseCtx, "UPDATE products SET count = count - ? WHERE id = ?", order.Quantity, order.ProductID)
+	end(err)
+	if err != nil {
+		return err
+	}
+	if s.orders {
+		if err := recordOrder(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	if s.hold > 0 {
+		_, end = StartPhase(ctx, "hold")
+		err = SleepContext(ctx, s.hold)
+		end(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, end = StartPhase(ctx, "commit")
+	err = tx.Commit()
+	end(err)
+	return err
+}
+
+func (*forUpdateStrategy) RecordsOrders() {}
+
+// Stop reports how the locking reads fared.
+func (s *forUpdateStrategy) Stop(ctx context.Context) error {
+	locked, aborted := s.locked.Load(), s.aborted.Load()
+	var avgWait time.Duration
+	if locked > 0 {
+		avgWait = time.Duration(s.lockWait.Load() / locked)
+	}
+	if s.nowait {
+		var rate float64
+		if total := locked + aborted; total > 0 {
+			rate = float64(aborted) / float64(total) * 100
+		}
+		slog.Info("NOWAIT locks", "granted", locked, "aborted", aborted, "aborted_pct", round1(rate), "avg_lock_wait", avgWait)
+	} else {
+		slog.Info("FOR UPDATE locks", "granted", locked, "avg_lock_wait", avgWait)
+	}
+	if s.hold > 0 {
+		slog.Info("Lock hold time caps each product", "hold_time", s.hold, "max_tps_per_product", round1(1/s.hold.Seconds()))
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// advisoryLockTimeout is how many seconds GET_LOCK waits for the named lock.
+const advisoryLockTimeout = 10
+
+var errAdvisoryLockTimeout = errors.New("advisory lock timeout")
+
+// getLockStrategy serializes purchases of a product with the MySQL named lock
+// product:<id> instead of an InnoDB row lock, then reads and decrements the
+// stock without locking the row.
+type getLockStrategy struct {
+	orders bool
+}
+
+func (getLockStrategy) RecordsOrders() {}
+
+func (s getLockStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) (err error) {
+	// Named locks belong to a session, so the lock, the transaction and the
+	// release must share one connection.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	name := fmt.Sprintf("product:%d", order.ProductID)
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, advisoryLockTimeout).Scan(&got); err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return errAdvisoryLockTimeout
+	}
+	defer func() {
+		var released sql.NullInt64
+		if relErr := conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", name).Scan(&released); relErr != nil && err == nil {
+			err = relErr
+		}
+	}()
+
+	return unlockedDecrement(ctx, conn, order, s.orders)
+}
@@ -0,0 +1,180 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// ledgerStrategy never updates the product row during the sale. Purchases are
+// appended to the purchase_ledger table and a background aggregator folds the
+// ledger into products.count every interval.
+//
+// The sold-out check reads the count as of the last fold, so a product can
+// be oversold by up to one interval's worth of purchases.
+type ledgerStrategy struct {
+	dialect  schema.Dialect
+	interval time.Duration
+
+	db      *sql.DB
+	initial int64 // units in the ledger and the products table at Start
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	folds   atomic.Int64
+	batch   atomic.Int64
+}
+
+func (*ledgerStrategy) MirrorsStock() {}
+
+// Init creates the ledger table.
+func (s *ledgerStrategy) Init(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS purchase_ledger"); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE purchase_ledger (id " + s.dialect.Serial() + ", product_id INT NOT NULL, quantity BIGINT NOT NULL, batch BIGINT NULL, created_at " + s.dialect.Timestamp() + " NOT NULL)"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "CREATE INDEX idx_batch ON purchase_ledger (batch)")
+	return err
+}
+
+// Start notes the units the ledger and the products table hold between
+// them, which the purchases only move from one to the other, numbers its
+// batches after those of earlier runs and starts the aggregator.
+func (s *ledgerStrategy) Start(ctx context.Context, db *sql.DB) error {
+	ledgered, remaining, err := s.units(ctx, db)
+	if err != nil {
+		return err
+	}
+	s.initial = ledgered + remaining
+	var lastBatch int64
+	if err := db.QueryRowContext(ctx, "SELECT COALESCE(MAX(batch), 0) FROM purchase_ledger").Scan(&lastBatch); err != nil {
+		return err
+	}
+	s.batch.Store(lastBatch)
+	s.db = db
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.foldLoop()
+	return nil
+}
+
+// Clean drops the purchase_ledger table.
+func (*ledgerStrategy) Clean(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS purchase_ledger")
+	return err
+}
+
+func (s *ledgerStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	var currentStock int64
+	if err := db.QueryRowContext(ctx, "SELECT count FROM products WHERE id = ?", order.ProductID).Scan(&currentStock); err != nil {
+		return err
+	}
+	if currentStock < order.Quantity {
+		return ErrSoldOut
+	}
+	_, err := db.ExecContext(ctx, "INSERT INTO purchase_ledger (product_id, quantity, created_at) VALUES (?, ?, ?)", order.ProductID, order.Quantity, time.Now().UTC())
+	return err
+}
+
+// foldLoop folds the ledger every interval until Stop.
+func (s *ledgerStrategy) foldLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.fold(context.Background()); err != nil {
+				slog.Error("Ledger aggregation failed", "err", err)
+			}
+		}
+	}
+}
+
+// fold claims every unfolded ledger row for a new batch and subtracts the
+// batch from products.count, all in one transaction. It runs at READ
+// COMMITTED so that claiming rows does not gap-lock concurrent inserts.
+func (s *ledgerStrategy) fold(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	batch := s.batch.Add(1)
+	res, err := tx.ExecContext(ctx, "UPDATE purchase_ledger SET batch = ? WHERE batch IS NULL", batch)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT product_id, SUM(quantity) FROM purchase_ledger WHERE batch = ? GROUP BY product_id", batch)
+	if err != nil {
+		return err
+	}
+	counts := make(map[int]int64)
+	for rows.Next() {
+		var productID int
+		var n int64
+		if err := rows.Scan(&productID, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		counts[productID] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for productID, n := range counts {
+		if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", n, productID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.folds.Add(1)
+	return nil
+}
+
+// Stop runs a final fold and checks that the ledger plus the remaining stock
+// adds up to the initial stock.
+func (s *ledgerStrategy) Stop(ctx context.Context) error {
+	close(s.stop)
+	s.wg.Wait()
+	if err := s.fold(ctx); err != nil {
+		return err
+	}
+
+	ledgered, remaining, err := s.units(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	slog.Info("Ledger stats", "units_folded", ledgered, "aggregations", s.folds.Load(), "ledger_plus_remaining", ledgered+remaining, "initial", s.initial)
+	if ledgered+remaining != s.initial {
+		return fmt.Errorf("ledger and stock disagree by %d units", s.initial-ledgered-remaining)
+	}
+	return nil
+}
+
+// units returns the units in the ledger and those left in the products
+// table.
+func (s *ledgerStrategy) units(ctx context.Context, db *sql.DB) (ledgered, remaining int64, err error) {
+	err = db.QueryRowContext(ctx, "SELECT (SELECT COALESCE(SUM(quantity), 0) FROM purchase_ledger), (SELECT SUM(count) FROM products)").Scan(&ledgered, &remaining)
+	return ledgered, remaining, err
+}
@@ -0,0 +1,75 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// mutexStrategy serializes purchases of each product with an in-process
+// mutex and then reads and decrements the stock without any row lock. It is
+// only correct while this process is the sole writer.
+type mutexStrategy struct {
+	locks  []sync.Mutex // indexed by product ID
+	orders bool
+}
+
+func newMutexStrategy(cfg *Config) *mutexStrategy {
+	return &mutexStrategy{locks: make([]sync.Mutex, cfg.NumProducts+1), orders: cfg.RecordOrders}
+}
+
+func (s *mutexStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	mu := &s.locks[order.ProductID]
+	mu.Lock()
+	defer mu.Unlock()
+	return unlockedDecrement(ctx, db, order, s.orders)
+}
+
+func (*mutexStrategy) RecordsOrders() {}
+
+// txBeginner is satisfied by both *sql.DB and *sql.Conn.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// unlockedDecrement reads the stock without a row lock and decrements it in
+// the same transaction, recording the order too if orders is set. Callers
+// must guarantee they are the only writer of the ordered product.
+func unlockedDecrement(ctx context.Context, db txBeginner, order Order, orders bool) error {
+	_, end := StartPhase(ctx, "begin")
+	tx, err := db.BeginTx(ctx, nil)
+	end(err)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var currentStock int64
+	phaseCtx, end := StartPhase(ctx, "select")
+	err = tx.QueryRowContext(phaseCtx, "SELECT count FROM products WHERE id = ?", order.ProductID).Scan(&currentStock)
+	end(err)
+	if err != nil {
+		return err
+	}
+
+	if currentStock < order.Quantity {
+		return ErrSoldOut
+	}
+
+	phaseCtx, end = StartPhase(ctx, "update")
+	_, err = tx.ExecContext(phaseCtx, "UPDATE products SET count = count - ? WHERE id = ?", order.Quantity, order.ProductID)
+	end(err)
+	if err != nil {
+		return err
+	}
+	if orders {
+		if err := recordOrder(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	_, end = StartPhase(ctx, "commit")
+	err = tx.Commit()
+	end(err)
+	return err
+}
@@ -0,0 +1,47 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+)
+
+// optimisticStrategy reads the stock and version without locking and applies
+// the decrement only if the version is unchanged, retrying on conflict.
+type optimisticStrategy struct {
+	maxRetries int
+}
+
+func (s optimisticStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			NoteRetry(ctx)
+		}
+		var currentStock, version int64
+		phaseCtx, end := StartPhase(ctx, "select")
+		err := db.QueryRowContext(phaseCtx, "SELECT count, version FROM products WHERE id = ?", order.ProductID).Scan(&currentStock, &version)
+		end(err)
+		if err != nil {
+			return err
+		}
+
+		if currentStock < order.Quantity {
+			return ErrSoldOut
+		}
+
+		phaseCtx, end = StartPhase(ctx, "update")
+		res, err := db.ExecContext(phaseCtx, "UPDATE products SET count = count - ?, version = version + 1 WHERE id = ? AND version = ?", order.Quantity, order.ProductID, version)
+		end(err)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 1 {
+			return nil
+		}
+		// Another purchase bumped the version in between; read again.
+	}
+	return ErrTooManyRetries
+}
@@ -0,0 +1,40 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// OrderRecorder is implemented by strategies that, with Config.RecordOrders,
+// insert a row into the orders table for every purchase in the transaction
+// that takes its stock, so that the orders account for exactly the units
+// sold.
+type OrderRecorder interface {
+	RecordsOrders()
+}
+
+// recordOrder inserts the row of order into the orders table in tx. The
+// table allows each user one order of a product and each idempotency key
+// one order, so with -users a second order and with -idempotency a
+// purchase already applied fail with ErrAlreadyPurchased and roll the
+// purchase back.
+func recordOrder(ctx context.Context, tx *sql.Tx, order Order) error {
+	// NULL, which the unique keys ignore, without -users or -idempotency.
+	var userID, key any
+	if order.UserID != 0 {
+		userID = order.UserID
+	}
+	if order.Key != "" {
+		key = order.Key
+	}
+	phaseCtx, end := StartPhase(ctx, "order")
+	_, err := tx.ExecContext(phaseCtx, "INSERT INTO orders (product_id, user_id, quantity, idempotency_key, created_at) VALUES (?, ?, ?, ?, ?)", order.ProductID, userID, order.Quantity, key, time.Now().UTC())
+	if schema.IsUniqueViolation(err) {
+		err = ErrAlreadyPurchased
+	}
+	end(err)
+	return err
+}
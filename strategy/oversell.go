@@ -0,0 +1,211 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// oversellStrategy decrements unconditionally, letting the counter go
+// negative, and records every sale in the oversell_orders table. A
+// compensation worker periodically cancels the newest orders of oversold
+// products and restores their stock. It exists to show how much cleanup this
+// anti-pattern needs.
+type oversellStrategy struct {
+	dialect  schema.Dialect
+	interval time.Duration
+
+	db          *sql.DB
+	stop        chan struct{}
+	wg          sync.WaitGroup
+	compensated atomic.Int64
+	unitsBefore int64 // of the orders left standing at Start
+	unitsSold   int64
+}
+
+// Init creates the orders table.
+func (s *oversellStrategy) Init(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS oversell_orders"); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE oversell_orders (id " + s.dialect.Serial() + ", product_id INT NOT NULL, quantity BIGINT NOT NULL, status VARCHAR(16) NOT NULL)"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "CREATE INDEX idx_product_status ON oversell_orders (product_id, status)")
+	return err
+}
+
+// Start notes the units of the orders earlier runs left standing and starts
+// the compensation worker.
+func (s *oversellStrategy) Start(ctx context.Context, db *sql.DB) error {
+	_, units, err := placedOrders(ctx, db)
+	if err != nil {
+		return err
+	}
+	s.unitsBefore = units
+	s.db = db
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.compensateLoop()
+	return nil
+}
+
+// Clean drops the oversell_orders table.
+func (*oversellStrategy) Clean(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS oversell_orders")
+	return err
+}
+
+func (s *oversellStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", order.Quantity, order.ProductID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO oversell_orders (product_id, quantity, status) VALUES (?, ?, 'placed')", order.ProductID, order.Quantity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// compensateLoop runs a compensation pass every interval until Stop.
+func (s *oversellStrategy) compensateLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.compensate(context.Background()); err != nil {
+				slog.Error("Oversell compensation failed", "err", err)
+			}
+		}
+	}
+}
+
+// compensate cancels enough of the newest orders of every oversold product to
+// bring its stock back to zero.
+func (s *oversellStrategy) compensate(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM products WHERE count < 0")
+	if err != nil {
+		return err
+	}
+	var oversold []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		oversold = append(oversold, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, productID := range oversold {
+		if err := s.compensateProduct(ctx, productID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compensateProduct cancels the newest orders of productID until its stock
+// is no longer negative.
+func (s *oversellStrategy) compensateProduct(ctx context.Context, productID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var currentStock int64
+	if err := tx.QueryRowContext(ctx, s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", schema.LockWait), productID).Scan(&currentStock); err != nil {
+		return err
+	}
+	if currentStock >= 0 {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, s.dialect.SelectForUpdate("SELECT id, quantity FROM oversell_orders WHERE product_id = ? AND status = 'placed' ORDER BY id DESC", schema.LockWait), productID)
+	if err != nil {
+		return err
+	}
+	var cancel []any
+	var restored int64
+	for restored < -currentStock && rows.Next() {
+		var id, quantity int64
+		if err := rows.Scan(&id, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		cancel = append(cancel, id)
+		restored += quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(cancel) == 0 {
+		return nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(cancel)), ",")
+	if _, err := tx.ExecContext(ctx, "UPDATE oversell_orders SET status = 'cancelled' WHERE id IN ("+placeholders+")", cancel...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count + ? WHERE id = ?", restored, productID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.compensated.Add(int64(len(cancel)))
+	return nil
+}
+
+// Stop runs a final compensation pass and reports how many orders had to be
+// cancelled.
+func (s *oversellStrategy) Stop(ctx context.Context) error {
+	close(s.stop)
+	s.wg.Wait()
+	if err := s.compensate(ctx); err != nil {
+		return err
+	}
+
+	placed, units, err := placedOrders(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	s.unitsSold = units - s.unitsBefore
+	slog.Info("Oversell stats", "orders_kept", placed, "orders_cancelled", s.compensated.Load())
+	return nil
+}
+
+// placedOrders returns the orders left standing and their units.
+func placedOrders(ctx context.Context, db *sql.DB) (orders, units int64, err error) {
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(SUM(quantity), 0) FROM oversell_orders WHERE status = 'placed'").Scan(&orders, &units)
+	return orders, units, err
+}
+
+// UnitsSold returns the units of the orders the run left standing after
+// compensation. It is only valid after Stop.
+func (s *oversellStrategy) UnitsSold() int64 {
+	return s.unitsSold
+}
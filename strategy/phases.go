@@ -0,0 +1,53 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PhaseRecorder receives the latency of every phase of the purchases made
+// with a context from WithPhaseRecorder.
+type PhaseRecorder interface {
+	RecordPhase(phase string, d time.Duration)
+}
+
+type phaseRecorderKey struct{}
+
+// WithPhaseRecorder returns a copy of ctx whose phases are recorded by r.
+func WithPhaseRecorder(ctx context.Context, r PhaseRecorder) context.Context {
+	return context.WithValue(ctx, phaseRecorderKey{}, r)
+}
+
+// StartPhase starts a child span of the purchase span of ctx for one phase of
+// a purchase transaction (begin, select, update, commit). The returned
+// function ends it, marking the span failed if err is an error other than
+// ErrSoldOut, and records the phase latency.
+func StartPhase(ctx context.Context, phase string) (context.Context, func(err error)) {
+	start := time.Now()
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer("update_one_record")
+	spanCtx, span := tracer.Start(ctx, phase)
+	return spanCtx, func(err error) {
+		if r, ok := ctx.Value(phaseRecorderKey{}).(PhaseRecorder); ok {
+			r.RecordPhase(phase, time.Since(start))
+		}
+		EndSpan(span, err)
+	}
+}
+
+// EndSpan records the outcome of a purchase or phase and ends its span.
+func EndSpan(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSoldOut):
+		span.SetAttributes(attribute.Bool("sold_out", true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, ErrorClass(err))
+	}
+	span.End()
+}
@@ -0,0 +1,54 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+)
+
+// purchaseProcedureSQL performs the check-and-decrement server-side inside its
+// own transaction and returns 1 when the order was sold, 0 when sold out.
+const purchaseProcedureSQL = `CREATE PROCEDURE purchase_product(IN p_id INT, IN p_quantity BIGINT)
+BEGIN
+	DECLARE stock BIGINT;
+	DECLARE EXIT HANDLER FOR SQLEXCEPTION
+	BEGIN
+		ROLLBACK;
+		RESIGNAL;
+	END;
+
+	START TRANSACTION;
+	SELECT count INTO stock FROM products WHERE id = p_id FOR UPDATE;
+	IF stock >= p_quantity THEN
+		UPDATE products SET count = count - p_quantity WHERE id = p_id;
+		COMMIT;
+		SELECT 1;
+	ELSE
+		COMMIT;
+		SELECT 0;
+	END IF;
+END`
+
+// procedureStrategy calls a stored procedure for every purchase, so the whole
+// transaction costs the client a single round trip. It needs MySQL; TiDB does
+// not support stored procedures.
+type procedureStrategy struct{}
+
+// Start (re)creates the purchase_product procedure.
+func (procedureStrategy) Start(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DROP PROCEDURE IF EXISTS purchase_product"); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, purchaseProcedureSQL)
+	return err
+}
+
+func (procedureStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	var sold int
+	if err := db.QueryRowContext(ctx, "CALL purchase_product(?, ?)", order.ProductID, order.Quantity).Scan(&sold); err != nil {
+		return err
+	}
+	if sold == 0 {
+		return ErrSoldOut
+	}
+	return nil
+}
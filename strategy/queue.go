@@ -0,0 +1,155 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// orderQueue carries purchase requests from the workers to the consumer pool.
+// Requests for the same product always land on the same partition, so each
+// product is decremented by a single consumer at a time.
+type orderQueue interface {
+	Publish(ctx context.Context, order Order) error
+	// Consume delivers the requests of one partition to handle until the
+	// queue is closed.
+	Consume(partition int, handle func(order Order))
+	Close() error
+}
+
+// queueStrategy accepts purchases by publishing them to an orderQueue and
+// lets a pool of consumers apply the decrements in the background. Purchase
+// returns as soon as the request is queued, before a consumer may find the
+// product sold out, so the units sold are those the consumers applied.
+type queueStrategy struct {
+	cfg       *Config
+	consumers int
+	queue     orderQueue
+
+	db        *sql.DB
+	wg        sync.WaitGroup
+	published atomic.Int64
+	consumed  atomic.Int64
+	soldOut   atomic.Int64
+	failed    atomic.Int64
+	applied   atomic.Int64 // units
+}
+
+func newQueueStrategy(cfg *Config) *queueStrategy {
+	return &queueStrategy{cfg: cfg, consumers: cfg.QueueConsumers}
+}
+
+// Start connects the queue backend and starts the consumer pool.
+func (s *queueStrategy) Start(ctx context.Context, db *sql.DB) error {
+	if s.consumers < 1 {
+		return fmt.Errorf("queue-consumers must be at least 1, got %d", s.consumers)
+	}
+
+	var err error
+	switch s.cfg.Queue {
+	case "chan":
+		s.queue = newChanQueue(s.consumers)
+	case "kafka":
+		s.queue, err = newKafkaQueue(ctx, s.cfg.KafkaBrokers, s.cfg.KafkaTopic, s.consumers)
+	default:
+		err = fmt.Errorf("unknown queue backend %q", s.cfg.Queue)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.db = db
+	for i := 0; i < s.consumers; i++ {
+		s.wg.Add(1)
+		go func(partition int) {
+			defer s.wg.Done()
+			s.queue.Consume(partition, s.handle)
+		}(i)
+	}
+	return nil
+}
+
+func (s *queueStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	if err := s.queue.Publish(ctx, order); err != nil {
+		return err
+	}
+	s.published.Add(1)
+	return nil
+}
+
+// handle applies one queued purchase with a conditional decrement.
+func (s *queueStrategy) handle(order Order) {
+	defer s.consumed.Add(1)
+	err := conditionalStrategy{dialect: s.cfg.Dialect()}.Purchase(context.Background(), s.db, order)
+	switch {
+	case err == nil:
+		s.applied.Add(order.Quantity)
+	case errors.Is(err, ErrSoldOut):
+		s.soldOut.Add(1)
+	default:
+		s.failed.Add(1)
+		slog.Error("Queue consumer failed to apply purchase", "product", order.ProductID, "err", err)
+	}
+}
+
+// UnitsSold returns the units the consumers applied. It is only complete
+// after Stop.
+func (s *queueStrategy) UnitsSold() int64 {
+	return s.applied.Load()
+}
+
+// Stop waits until every published request has been consumed and shuts the
+// consumer pool down.
+func (s *queueStrategy) Stop(ctx context.Context) error {
+	for s.consumed.Load() < s.published.Load() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	err := s.queue.Close()
+	s.wg.Wait()
+	slog.Info("Queue stats", "consumed", s.consumed.Load(), "sold_out", s.soldOut.Load(), "failed", s.failed.Load())
+	return err
+}
+
+// chanQueue is the in-process orderQueue: one buffered channel per partition.
+type chanQueue struct {
+	partitions []chan Order
+}
+
+func newChanQueue(n int) *chanQueue {
+	q := &chanQueue{partitions: make([]chan Order, n)}
+	for i := range q.partitions {
+		q.partitions[i] = make(chan Order, 1024)
+	}
+	return q
+}
+
+func (q *chanQueue) Publish(ctx context.Context, order Order) error {
+	select {
+	case q.partitions[order.ProductID%len(q.partitions)] <- order:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *chanQueue) Consume(partition int, handle func(order Order)) {
+	for order := range q.partitions[partition] {
+		handle(order)
+	}
+}
+
+func (q *chanQueue) Close() error {
+	for _, ch := range q.partitions {
+		close(ch)
+	}
+	return nil
+}
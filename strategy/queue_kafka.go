@@ -0,0 +1,120 @@
+package strategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaQueue is an orderQueue backed by a Kafka topic keyed by product ID.
+// Message values are "<product ID>:<quantity>".
+// Consumers join one consumer group, so Kafka assigns each partition, and
+// therefore each product, to exactly one of them.
+type kafkaQueue struct {
+	brokers []string
+	topic   string
+	groupID string
+	writer  *kafka.Writer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newKafkaQueue creates a fresh topic for this run, named after topicPrefix,
+// with one partition per consumer.
+func newKafkaQueue(ctx context.Context, brokerList, topicPrefix string, partitions int) (*kafkaQueue, error) {
+	brokers := strings.Split(brokerList, ",")
+	runID := strconv.FormatInt(time.Now().UnixNano(), 10)
+	topic := topicPrefix + "-" + runID
+
+	if err := createKafkaTopic(ctx, brokers[0], topic, partitions); err != nil {
+		return nil, err
+	}
+	slog.Info("Publishing orders to Kafka", "topic", topic)
+
+	qctx, cancel := context.WithCancel(context.Background())
+	return &kafkaQueue{
+		brokers: brokers,
+		topic:   topic,
+		groupID: topic + "-consumers",
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+			BatchTimeout: 5 * time.Millisecond,
+		},
+		ctx:    qctx,
+		cancel: cancel,
+	}, nil
+}
+
+// createKafkaTopic creates topic through the cluster controller.
+func createKafkaTopic(ctx context.Context, broker, topic string, partitions int) error {
+	conn, err := kafka.DialContext(ctx, "tcp", broker)
+	if err != nil {
+		return fmt.Errorf("dial kafka: %w", err)
+	}
+	defer conn.Close()
+
+	controller, err := conn.Controller()
+	if err != nil {
+		return fmt.Errorf("find kafka controller: %w", err)
+	}
+	ctrlConn, err := kafka.DialContext(ctx, "tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return fmt.Errorf("dial kafka controller: %w", err)
+	}
+	defer ctrlConn.Close()
+
+	return ctrlConn.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     partitions,
+		ReplicationFactor: 1,
+	})
+}
+
+func (q *kafkaQueue) Publish(ctx context.Context, order Order) error {
+	return q.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.Itoa(order.ProductID)),
+		Value: []byte(fmt.Sprintf("%d:%d", order.ProductID, order.Quantity)),
+	})
+}
+
+func (q *kafkaQueue) Consume(partition int, handle func(order Order)) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     q.brokers,
+		GroupID:     q.groupID,
+		Topic:       q.topic,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer r.Close()
+
+	for {
+		m, err := r.ReadMessage(q.ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				slog.Error("Kafka consumer stopped", "partition", partition, "err", err)
+			}
+			return
+		}
+		var order Order
+		if _, err := fmt.Sscanf(string(m.Value), "%d:%d", &order.ProductID, &order.Quantity); err != nil {
+			slog.Warn("Kafka consumer skipped malformed message", "partition", partition, "value", string(m.Value))
+			continue
+		}
+		handle(order)
+	}
+}
+
+func (q *kafkaQueue) Close() error {
+	q.cancel()
+	return q.writer.Close()
+}
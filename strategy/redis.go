@@ -0,0 +1,241 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// redisFlushInterval is how often pending purchases are written back to
+	// the products table.
+	redisFlushInterval = 100 * time.Millisecond
+
+	// redisPendingBuffer bounds the number of purchases waiting for write-back.
+	redisPendingBuffer = 10000
+)
+
+// redisSoldOut is the sentinel decrementScript returns for sold-out products.
+const redisSoldOut = -1
+
+// decrementScript checks and decrements the stock atomically on the server,
+// so no other client can slip in between the read and the write.
+var decrementScript = redis.NewScript(`
+local stock = tonumber(redis.call('GET', KEYS[1]) or '0')
+local quantity = tonumber(ARGV[1])
+if stock < quantity then
+	return -1
+end
+return redis.call('DECRBY', KEYS[1], quantity)
+`)
+
+// redisStrategy deducts stock in Redis and writes successful purchases back to
+// the products table asynchronously from a background flusher. With lua set
+// the deduction runs as decrementScript instead of DECRBY with compensation.
+type redisStrategy struct {
+	client *redis.Client
+	lua    bool
+
+	db        *sql.DB
+	pending   chan Order
+	done      chan struct{}
+	unflushed map[int]int64 // left by flushLoop for Stop to write back
+}
+
+func newRedisStrategy(cfg *Config, lua bool) *redisStrategy {
+	return &redisStrategy{
+		lua:     lua,
+		client:  redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, PoolSize: cfg.Concurrency}),
+		pending: make(chan Order, redisPendingBuffer),
+		done:    make(chan struct{}),
+	}
+}
+
+func (*redisStrategy) MirrorsStock() {}
+
+func redisStockKey(productID int) string {
+	return fmt.Sprintf("stock:%d", productID)
+}
+
+// Start copies the initial stock of every product into Redis and starts the
+// write-back flusher.
+func (s *redisStrategy) Start(ctx context.Context, db *sql.DB) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ping redis: %w", err)
+	}
+	if err := seedRedisStock(ctx, s.client, db); err != nil {
+		return err
+	}
+	s.db = db
+	go s.flushLoop()
+	return nil
+}
+
+// seedRedisStock copies the current count of every product into Redis.
+func seedRedisStock(ctx context.Context, client *redis.Client, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, count FROM products")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	pipe := client.Pipeline()
+	for rows.Next() {
+		var id int
+		var count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return err
+		}
+		pipe.Set(ctx, redisStockKey(id), count, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("seed redis stock: %w", err)
+	}
+	return nil
+}
+
+func (s *redisStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	var err error
+	if s.lua {
+		err = redisDecrementLua(ctx, s.client, order)
+	} else {
+		err = redisDecrement(ctx, s.client, order)
+	}
+	if err != nil {
+		return err
+	}
+	s.pending <- order
+	return nil
+}
+
+// redisDecrement uses DECRBY and gives the units back with INCRBY when the
+// counter went below zero. Between the two a concurrent buyer can observe a
+// negative stock and be turned away even though units are left.
+func redisDecrement(ctx context.Context, client *redis.Client, order Order) error {
+	key := redisStockKey(order.ProductID)
+	left, err := client.DecrBy(ctx, key, order.Quantity).Result()
+	if err != nil {
+		return err
+	}
+	if left < 0 {
+		// Give back the units we could not have.
+		if err := client.IncrBy(ctx, key, order.Quantity).Err(); err != nil {
+			return err
+		}
+		return ErrSoldOut
+	}
+	return nil
+}
+
+// redisDecrementLua runs decrementScript, which never lets the counter go
+// negative.
+func redisDecrementLua(ctx context.Context, client *redis.Client, order Order) error {
+	left, err := decrementScript.Run(ctx, client, []string{redisStockKey(order.ProductID)}, order.Quantity).Int64()
+	if err != nil {
+		return err
+	}
+	if left == redisSoldOut {
+		return ErrSoldOut
+	}
+	return nil
+}
+
+// flushLoop aggregates pending purchases per product and applies them to the
+// products table every redisFlushInterval until pending is closed, leaving
+// what it has not applied yet in unflushed.
+func (s *redisStrategy) flushLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(redisFlushInterval)
+	defer ticker.Stop()
+
+	counts := make(map[int]int64)
+	for {
+		select {
+		case order, ok := <-s.pending:
+			if !ok {
+				s.unflushed = counts
+				return
+			}
+			counts[order.ProductID] += order.Quantity
+		case <-ticker.C:
+			if err := s.flush(context.Background(), counts); err != nil {
+				slog.Error("Redis write-back failed; retrying at the next flush", "err", err)
+			}
+		}
+	}
+}
+
+// flush writes the aggregated decrements to the products table and clears
+// counts. Failed products are kept for the next flush, and the error of the
+// last of them is returned.
+func (s *redisStrategy) flush(ctx context.Context, counts map[int]int64) error {
+	var failed int
+	var lastErr error
+	for productID, n := range counts {
+		if _, err := s.db.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", n, productID); err != nil {
+			failed++
+			lastErr = fmt.Errorf("product %d: %w", productID, err)
+			continue
+		}
+		delete(counts, productID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("write back %d products: %w", failed, lastErr)
+	}
+	return nil
+}
+
+// Stop drains the write-back queue, applies what is left of it and
+// reconciles the Redis stock against the products table.
+func (s *redisStrategy) Stop(ctx context.Context) error {
+	close(s.pending)
+	<-s.done
+	defer s.client.Close()
+	if err := s.flush(ctx, s.unflushed); err != nil {
+		return err
+	}
+	return reconcileRedisStock(ctx, s.client, s.db)
+}
+
+// reconcileRedisStock compares every product's count with its Redis
+// counterpart and reports the products that disagree.
+func reconcileRedisStock(ctx context.Context, client *redis.Client, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, "SELECT id, count FROM products ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var mismatched int
+	for rows.Next() {
+		var id int
+		var dbCount int64
+		if err := rows.Scan(&id, &dbCount); err != nil {
+			return err
+		}
+		redisCount, err := client.Get(ctx, redisStockKey(id)).Int64()
+		if err != nil {
+			return fmt.Errorf("read redis stock for product %d: %w", id, err)
+		}
+		if redisCount != dbCount {
+			mismatched++
+			slog.Error("Redis stock mismatch", "product", id, "redis", redisCount, "db", dbCount)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if mismatched > 0 {
+		return fmt.Errorf("%d products differ between Redis and the database", mismatched)
+	}
+	slog.Info("Redis and database stock match")
+	return nil
+}
@@ -0,0 +1,80 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisOnlyStrategy keeps the stock in Redis and nowhere else, as a baseline
+// for inventory that lives only in a cache. Purchases use DECRBY with
+// compensation, or decrementScript with lua set, like redisStrategy, but
+// nothing is written back to a database.
+type redisOnlyStrategy struct {
+	client      *redis.Client
+	lua         bool
+	numProducts int
+}
+
+func newRedisOnlyStrategy(cfg *Config, lua bool) *redisOnlyStrategy {
+	return &redisOnlyStrategy{
+		lua:         lua,
+		numProducts: cfg.NumProducts,
+		client:      redis.NewClient(&redis.Options{Addr: cfg.RedisAddr, PoolSize: cfg.Concurrency}),
+	}
+}
+
+// Seed sets the stock key of every product.
+func (s *redisOnlyStrategy) Seed(ctx context.Context, numProducts int, stock int64) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("ping redis: %w", err)
+	}
+	pipe := s.client.Pipeline()
+	for id := 1; id <= numProducts; id++ {
+		pipe.Set(ctx, redisStockKey(id), stock, 0)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("seed redis stock: %w", err)
+	}
+	return nil
+}
+
+func (s *redisOnlyStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	if s.lua {
+		return redisDecrementLua(ctx, s.client, order)
+	}
+	return redisDecrement(ctx, s.client, order)
+}
+
+// TotalStock sums the stock keys.
+func (s *redisOnlyStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	keys := make([]string, s.numProducts)
+	for i := range keys {
+		keys[i] = redisStockKey(i + 1)
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for i, v := range values {
+		str, ok := v.(string)
+		if !ok {
+			return 0, fmt.Errorf("stock of product %d missing from redis", i+1)
+		}
+		n, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("stock of product %d: %w", i+1, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// Close closes the Redis client once the stock has been verified.
+func (s *redisOnlyStrategy) Close() error {
+	return s.client.Close()
+}
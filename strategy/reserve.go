@@ -0,0 +1,216 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"update_one_record/schema"
+)
+
+var (
+	// errReservationAbandoned is returned when the simulated buyer walks away
+	// after reserving; the reservation is left for the reaper.
+	errReservationAbandoned = errors.New("reservation abandoned")
+
+	// errReservationExpired is returned when the reaper released the
+	// reservation before it could be confirmed.
+	errReservationExpired = errors.New("reservation expired")
+)
+
+// reserveStrategy sells in two phases. Reserve takes the order quantity off
+// the stock and records a pending reservation with a deadline; confirm marks
+// it confirmed.
+// A background reaper returns the stock of reservations that were not
+// confirmed in time.
+type reserveStrategy struct {
+	dialect     schema.Dialect
+	ttl         time.Duration
+	abandonRate float64
+
+	db   *sql.DB
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Init creates the reservations table.
+func (s *reserveStrategy) Init(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS reservations"); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE reservations (id " + s.dialect.Serial() + ", product_id INT NOT NULL, quantity BIGINT NOT NULL, status VARCHAR(16) NOT NULL, expires_at " + s.dialect.Timestamp() + " NOT NULL)"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "CREATE INDEX idx_status_expires ON reservations (status, expires_at)")
+	return err
+}
+
+// Start starts the reaper.
+func (s *reserveStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.db = db
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.reapLoop()
+	return nil
+}
+
+// Clean drops the reservations table.
+func (*reserveStrategy) Clean(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS reservations")
+	return err
+}
+
+func (s *reserveStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	reservationID, err := s.reserve(ctx, db, order)
+	if err != nil {
+		return err
+	}
+
+	if Rand(ctx).Float64() < s.abandonRate {
+		return errReservationAbandoned
+	}
+
+	res, err := db.ExecContext(ctx, "UPDATE reservations SET status = 'confirmed' WHERE id = ? AND status = 'pending'", reservationID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errReservationExpired
+	}
+	return nil
+}
+
+// reserve takes the order off the stock and records a pending reservation
+// for it, returning the reservation ID.
+func (s *reserveStrategy) reserve(ctx context.Context, db *sql.DB, order Order) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, s.dialect.ConditionalDecrement(), order.Quantity, order.ProductID, order.Quantity)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrSoldOut
+	}
+
+	expiresAt := time.Now().Add(s.ttl).UTC()
+	id, err := s.dialect.InsertID(ctx, tx, "INSERT INTO reservations (product_id, quantity, status, expires_at) VALUES (?, ?, 'pending', ?)", order.ProductID, order.Quantity, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// reapLoop releases expired reservations every half TTL until Stop.
+func (s *reserveStrategy) reapLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if _, err := s.reap(context.Background(), time.Now()); err != nil {
+				slog.Error("Reservation reaper failed", "err", err)
+			}
+		}
+	}
+}
+
+// reap releases every pending reservation that expired before deadline and
+// returns how many it released.
+func (s *reserveStrategy) reap(ctx context.Context, deadline time.Time) (int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, product_id, quantity FROM reservations WHERE status = 'pending' AND expires_at < ?", deadline.UTC())
+	if err != nil {
+		return 0, err
+	}
+	type reservation struct{ id, productID, quantity int64 }
+	var expired []reservation
+	for rows.Next() {
+		var r reservation
+		if err := rows.Scan(&r.id, &r.productID, &r.quantity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var released int
+	for _, r := range expired {
+		ok, err := s.release(ctx, r.id, r.productID, r.quantity)
+		if err != nil {
+			return released, err
+		}
+		if ok {
+			released++
+		}
+	}
+	return released, nil
+}
+
+// release expires one reservation and returns its quantity to the stock,
+// unless it was confirmed in the meantime.
+func (s *reserveStrategy) release(ctx context.Context, reservationID, productID, quantity int64) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE reservations SET status = 'expired' WHERE id = ? AND status = 'pending'", reservationID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count + ? WHERE id = ?", quantity, productID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Stop halts the reaper and releases every reservation still pending, since
+// no buyer is left to confirm it.
+func (s *reserveStrategy) Stop(ctx context.Context) error {
+	close(s.stop)
+	s.wg.Wait()
+
+	if _, err := s.reap(ctx, time.Now().Add(s.ttl)); err != nil {
+		return err
+	}
+
+	var confirmed, expired int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(SUM(CASE WHEN status = 'confirmed' THEN 1 ELSE 0 END), 0), COALESCE(SUM(CASE WHEN status = 'expired' THEN 1 ELSE 0 END), 0) FROM reservations").Scan(&confirmed, &expired)
+	if err != nil {
+		return err
+	}
+	slog.Info("Reservation stats", "confirmed", confirmed, "expired", expired)
+	return nil
+}
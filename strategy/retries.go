@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type retryCounterKey struct{}
+
+// WithRetryCounter returns a copy of ctx that counts the retries of one
+// purchase, and the counter.
+func WithRetryCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	n := new(atomic.Int64)
+	return context.WithValue(ctx, retryCounterKey{}, n), n
+}
+
+// NoteRetry records that the purchase issued with ctx is being retried.
+// Retrying strategies call it before every attempt but the first.
+func NoteRetry(ctx context.Context) {
+	if n, ok := ctx.Value(retryCounterKey{}).(*atomic.Int64); ok {
+		n.Add(1)
+	}
+}
+
+// ConflictRetrier retries purchases that fail with a conflict error, such as
+// a TiDB write conflict or a CockroachDB serialization failure, up to
+// MaxRetries times, and counts how often that happened. Purchases still
+// conflicting after that fail with ErrTooManyRetries. With BackoffBase set,
+// every retry waits a JitteredBackoff of at most BackoffMax first.
+type ConflictRetrier struct {
+	Strategy
+	MaxRetries  int
+	IsConflict  func(error) bool
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+
+	Retries   atomic.Int64
+	Abandoned atomic.Int64
+}
+
+func (r *ConflictRetrier) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	for attempt := 0; ; attempt++ {
+		err := r.Strategy.Purchase(ctx, db, order)
+		if !r.IsConflict(err) {
+			return err
+		}
+		if attempt == r.MaxRetries {
+			r.Abandoned.Add(1)
+			return fmt.Errorf("%w: %w", ErrTooManyRetries, err)
+		}
+		r.Retries.Add(1)
+		NoteRetry(ctx)
+		if r.BackoffBase > 0 && SleepContext(ctx, JitteredBackoff(ctx, r.BackoffBase, r.BackoffMax, attempt+1)) != nil {
+			return err
+		}
+	}
+}
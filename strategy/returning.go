@@ -0,0 +1,27 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"update_one_record/schema"
+)
+
+// returningStrategy decrements the stock and reads back what is left in a
+// single round trip with UPDATE ... RETURNING, which PostgreSQL (and
+// CockroachDB) support but MySQL does not.
+type returningStrategy struct {
+	dialect schema.Dialect
+}
+
+func (s returningStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	var remaining int64
+	phaseCtx, end := StartPhase(ctx, "update")
+	err := db.QueryRowContext(phaseCtx, s.dialect.ConditionalDecrement()+" RETURNING count", order.Quantity, order.ProductID, order.Quantity).Scan(&remaining)
+	end(err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSoldOut
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// serializerStrategy runs one goroutine per product that executes that
+// product's purchases one after another. Workers submit a request and wait
+// for its result, modelling a "single writer per SKU" service.
+type serializerStrategy struct {
+	numProducts int
+	orders      bool
+
+	requests []chan serializerRequest // indexed by product ID
+	wg       sync.WaitGroup
+}
+
+// serializerRequest is one purchase handed to a product's writer goroutine.
+type serializerRequest struct {
+	ctx   context.Context
+	order Order
+	done  chan error
+}
+
+// Start launches the writer goroutine of every product.
+func (s *serializerStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.requests = make([]chan serializerRequest, s.numProducts+1)
+	for productID := 1; productID <= s.numProducts; productID++ {
+		ch := make(chan serializerRequest)
+		s.requests[productID] = ch
+		s.wg.Add(1)
+		go func(productID int) {
+			defer s.wg.Done()
+			for req := range ch {
+				req.done <- unlockedDecrement(req.ctx, db, req.order, s.orders)
+			}
+		}(productID)
+	}
+	return nil
+}
+
+func (s *serializerStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	req := serializerRequest{ctx: ctx, order: order, done: make(chan error, 1)}
+	select {
+	case s.requests[order.ProductID] <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.done
+}
+
+func (*serializerStrategy) RecordsOrders() {}
+
+// Stop shuts the writer goroutines down.
+func (s *serializerStrategy) Stop(ctx context.Context) error {
+	for _, ch := range s.requests[1:] {
+		close(ch)
+	}
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,148 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"update_one_record/schema"
+)
+
+// unitInsertBatch is the number of inventory units inserted per statement.
+const unitInsertBatch = 1000
+
+// errUnitsLocked is returned by skipLockedStrategy.claim when other
+// purchases hold locks on the unsold units it skipped over.
+var errUnitsLocked = errors.New("unsold units locked by other purchases")
+
+// skipLockedStrategy keeps one inventory_units row per sellable unit. Workers
+// claim as many unsold units as they order with SELECT ... FOR UPDATE SKIP
+// LOCKED, so concurrent buyers of the same product lock different rows
+// instead of queueing. A purchase that finds too few units unlocked while
+// enough are unsold retries with backoff up to maxRetries times, since the
+// purchases holding them may yet roll back.
+type skipLockedStrategy struct {
+	dialect     schema.Dialect
+	numProducts int
+	stock       int64
+	orders      bool
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+}
+
+func (skipLockedStrategy) RecordsOrders() {}
+
+// Init creates the inventory_units table with stock unsold units per product.
+func (s skipLockedStrategy) Init(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS inventory_units"); err != nil {
+		return err
+	}
+	createTableSQL := "CREATE TABLE inventory_units (id " + s.dialect.Serial() + ", product_id INT NOT NULL, sold BOOLEAN NOT NULL DEFAULT FALSE)"
+	if _, err := db.ExecContext(ctx, createTableSQL); err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx, "CREATE INDEX idx_product_sold ON inventory_units (product_id, sold)"); err != nil {
+		return err
+	}
+
+	for p := 1; p <= s.numProducts; p++ {
+		for done := int64(0); done < s.stock; done += unitInsertBatch {
+			n := min(s.stock-done, unitInsertBatch)
+			values := strings.TrimSuffix(strings.Repeat("(?),", int(n)), ",")
+			args := make([]any, n)
+			for i := range args {
+				args[i] = p
+			}
+			if _, err := db.ExecContext(ctx, "INSERT INTO inventory_units (product_id) VALUES "+values, args...); err != nil {
+				return fmt.Errorf("insert units for product %d: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Clean drops the inventory_units table.
+func (skipLockedStrategy) Clean(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, "DROP TABLE IF EXISTS inventory_units")
+	return err
+}
+
+func (s skipLockedStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			NoteRetry(ctx)
+			if err := SleepContext(ctx, JitteredBackoff(ctx, s.backoffBase, s.backoffMax, attempt)); err != nil {
+				return err
+			}
+		}
+		if err := s.claim(ctx, db, order); !errors.Is(err, errUnitsLocked) {
+			return err
+		}
+	}
+	return ErrTooManyRetries
+}
+
+// claim marks the ordered quantity of unlocked units sold in one
+// transaction. It returns ErrSoldOut if fewer units are unsold, and
+// errUnitsLocked if enough are but some of them were locked.
+func (s skipLockedStrategy) claim(ctx context.Context, db *sql.DB, order Order) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, s.dialect.SelectForUpdate("SELECT id FROM inventory_units WHERE product_id = ? AND sold = FALSE LIMIT ?", schema.LockSkipLocked), order.ProductID, order.Quantity)
+	if err != nil {
+		return err
+	}
+	var unitIDs []any
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		unitIDs = append(unitIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if int64(len(unitIDs)) < order.Quantity {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		var unsold int64
+		if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory_units WHERE product_id = ? AND sold = FALSE", order.ProductID).Scan(&unsold); err != nil {
+			return err
+		}
+		if unsold < order.Quantity {
+			return ErrSoldOut
+		}
+		return errUnitsLocked
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(unitIDs)), ",")
+	if _, err := tx.ExecContext(ctx, "UPDATE inventory_units SET sold = TRUE WHERE id IN ("+placeholders+")", unitIDs...); err != nil {
+		return err
+	}
+	if s.orders {
+		if err := recordOrder(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// TotalStock counts the unsold units.
+func (skipLockedStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	var total int64
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM inventory_units WHERE sold = FALSE").Scan(&total)
+	return total, err
+}
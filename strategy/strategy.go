@@ -0,0 +1,358 @@
+// Package strategy implements the ways of decrementing the stock of a hot
+// product, each a Strategy registered by name.
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"update_one_record/schema"
+)
+
+var (
+	// ErrSoldOut is returned by a Strategy when the product has no stock left.
+	ErrSoldOut = errors.New("sold out")
+
+	// ErrTooManyRetries is returned by retrying strategies once
+	// Config.MaxRetries attempts have been exhausted.
+	ErrTooManyRetries = errors.New("too many retries")
+
+	// ErrAlreadyPurchased is returned with -users when the user already
+	// bought the product.
+	ErrAlreadyPurchased = errors.New("already purchased")
+)
+
+// Order is one purchase attempt: Quantity units of the product ProductID.
+type Order struct {
+	ProductID int
+	Quantity  int64
+	UserID    int    // 0 unless -users is set
+	Key       string // idempotency key, "" unless -idempotency is set
+}
+
+// Strategy performs a single purchase of an order.
+//
+// Implementations own the whole transaction: they open it, decrement the
+// stock by the order quantity, or fail with ErrSoldOut if fewer units are
+// left, and commit or roll back before returning.
+type Strategy interface {
+	Purchase(ctx context.Context, db *sql.DB, order Order) error
+}
+
+// Starter is implemented by strategies that need to prepare state or start
+// background work once the products table has been initialized.
+type Starter interface {
+	Start(ctx context.Context, db *sql.DB) error
+}
+
+// Initializer is implemented by strategies that keep the stock in tables of
+// their own. Init drops and creates them afresh with the stock of every
+// product once the products table has been initialized; runs that reuse the
+// stock skip it, and their Start finds the tables as an earlier run left
+// them.
+type Initializer interface {
+	Init(ctx context.Context, db *sql.DB) error
+}
+
+// Stopper is implemented by strategies with background work that must be
+// drained after the workers finish and before the stock is verified.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Cleaner is implemented by strategies that leave tables of their own
+// behind, which Clean drops.
+type Cleaner interface {
+	Clean(ctx context.Context, db *sql.DB) error
+}
+
+// StockCounter is implemented by strategies that keep the stock somewhere
+// other than products.count. TotalStock reports the remaining stock summed
+// over all products.
+type StockCounter interface {
+	TotalStock(ctx context.Context, db *sql.DB) (int64, error)
+}
+
+// StockMirror is implemented by strategies that keep products.count in step
+// with stock they deduct somewhere else, and check at Stop that the two
+// agree. Units added to products.count alone, as refunds and restocks are,
+// would set them apart.
+type StockMirror interface {
+	MirrorsStock()
+}
+
+type workerIDKey struct{}
+
+// WithWorkerID returns a copy of ctx carrying the ID of the worker that issues
+// purchases with it.
+func WithWorkerID(ctx context.Context, workerID int) context.Context {
+	return context.WithValue(ctx, workerIDKey{}, workerID)
+}
+
+// WorkerID returns the worker ID carried by ctx, or 0 if there is none.
+func WorkerID(ctx context.Context) int {
+	id, _ := ctx.Value(workerIDKey{}).(int)
+	return id
+}
+
+type randKey struct{}
+
+// WithRand returns a copy of ctx carrying the random number generator of the
+// worker that issues purchases with it, from which strategies draw their
+// choices so that a run with the same -seed repeats them.
+func WithRand(ctx context.Context, rng *rand.Rand) context.Context {
+	return context.WithValue(ctx, randKey{}, rng)
+}
+
+// Rand returns the random number generator carried by ctx, or one shared by
+// every goroutine and seeded at random if there is none.
+func Rand(ctx context.Context) *rand.Rand {
+	if rng, ok := ctx.Value(randKey{}).(*rand.Rand); ok {
+		return rng
+	}
+	return sharedRand
+}
+
+var sharedRand = rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())})
+
+// lockedSource makes a rand.Source safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// Seeder is implemented by strategies that keep the whole stock outside the
+// database. Seed stores numProducts products of stock units each in place of
+// the products table; together with StockCounter this lets such strategies
+// run with -driver none, without any SQL database, in which case the db
+// passed to them is nil.
+type Seeder interface {
+	Seed(ctx context.Context, numProducts int, stock int64) error
+}
+
+// SoldCounter is implemented by strategies whose purchases do not take exactly
+// the ordered quantity. UnitsSold reports the units sold over the whole run.
+type SoldCounter interface {
+	UnitsSold() int64
+}
+
+// Config holds the options of the strategies, which loadgen.Config embeds.
+type Config struct {
+	// Concurrency workers sell NumProducts products of Stock units each.
+	Concurrency int   `json:"concurrency"`
+	NumProducts int   `json:"products"`
+	Stock       int64 `json:"stock"`
+
+	// Driver selects the database behind DB_DSN: "mysql" (MySQL or TiDB),
+	// "postgres", "cockroach", "sqlite" or "vitess" (a VTGate), or "none"
+	// for strategies that are a Seeder. With cockroach, purchases failing
+	// with a serialization error are retried up to MaxRetries times; with
+	// vitess, those the tablet's transaction killer rolled back.
+	Driver string `json:"driver"`
+
+	// TiDB lays out the products table for TiDB's region hotspots.
+	TiDBSchema schema.TiDB `json:"tidb_schema"`
+
+	// MaxRetries caps how often retrying strategies re-attempt a purchase.
+	// BackoffBase and BackoffMax bound the delay between attempts.
+	MaxRetries  int           `json:"max_retries"`
+	BackoffBase time.Duration `json:"backoff_base"`
+	BackoffMax  time.Duration `json:"backoff_max"`
+
+	// NoWait makes the for-update strategy lock with FOR UPDATE NOWAIT.
+	NoWait bool `json:"nowait"`
+
+	// RecordOrders makes the strategies that are an OrderRecorder insert a
+	// row into the orders table in the transaction of every purchase.
+	RecordOrders bool `json:"record_orders,omitempty"`
+
+	// HoldTime is how long the for-update strategy keeps the row locked
+	// after its update, before it commits.
+	HoldTime time.Duration `json:"hold_time,omitempty"`
+
+	// RedisAddr is the Redis server used by the redis strategies.
+	RedisAddr string `json:"redis_addr"`
+
+	// DynamoDBTable is the table of the dynamodb strategy, on DynamoDBEndpoint
+	// if set (e.g. DynamoDB Local) and otherwise on AWS in the configured
+	// region.
+	DynamoDBTable    string `json:"dynamodb_table"`
+	DynamoDBEndpoint string `json:"dynamodb_endpoint"`
+
+	// EtcdEndpoints lists the etcd endpoints used by the etcd strategy.
+	EtcdEndpoints string `json:"etcd_endpoints"`
+
+	// PDAddrs lists the PD endpoints of the cluster used by the tikv strategy.
+	PDAddrs string `json:"pd_addrs"`
+
+	// Buckets is the number of stock rows per product for the buckets strategy.
+	Buckets int `json:"buckets"`
+
+	// CartSize is the number of distinct products bought per cart.
+	CartSize int `json:"cart_size"`
+
+	// Queue selects the queue strategy backend ("chan" or "kafka").
+	Queue          string `json:"queue"`
+	QueueConsumers int    `json:"queue_consumers"`
+	KafkaBrokers   string `json:"kafka_brokers"`
+	KafkaTopic     string `json:"kafka_topic"`
+
+	// CoalesceWindow is how long the coalesce strategy collects purchases of
+	// one product before applying them together.
+	CoalesceWindow time.Duration `json:"coalesce_window"`
+
+	// ReservationTTL and AbandonRate configure the reserve strategy: how long
+	// a reservation may stay unconfirmed and the fraction of buyers who never
+	// confirm.
+	ReservationTTL time.Duration `json:"reservation_ttl"`
+	AbandonRate    float64       `json:"abandon_rate"`
+
+	// TokenQuota is how many units a worker claims at once in the tokens strategy.
+	TokenQuota int64 `json:"token_quota"`
+
+	// FoldInterval is how often the ledger strategy folds purchases into
+	// products.count.
+	FoldInterval time.Duration `json:"fold_interval"`
+
+	// CompensateInterval is how often the oversell strategy cancels orders of
+	// products whose stock went negative.
+	CompensateInterval time.Duration `json:"compensate_interval"`
+
+	// ReconcileInterval is how often the cache strategy reloads its cache.
+	ReconcileInterval time.Duration `json:"reconcile_interval"`
+}
+
+// Dialect returns the dialect of c.Driver.
+func (c *Config) Dialect() schema.Dialect {
+	return schema.NewDialect(c.Driver, c.TiDBSchema)
+}
+
+// Factory constructs a Strategy configured by cfg.
+type Factory func(cfg *Config) Strategy
+
+// strategies maps -strategy names to their constructors; strategiesMu
+// guards it against Register.
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Factory{
+		"for-update": func(cfg *Config) Strategy {
+			return &forUpdateStrategy{dialect: cfg.Dialect(), nowait: cfg.NoWait, hold: cfg.HoldTime, orders: cfg.RecordOrders}
+		},
+		"cache": func(cfg *Config) Strategy { return newCacheStrategy(cfg) },
+		"cart":  func(cfg *Config) Strategy { return newCartStrategy(cfg) },
+		"cas":   func(cfg *Config) Strategy { return newCASStrategy(cfg) },
+		"crdb": func(cfg *Config) Strategy {
+			return crdbStrategy{dialect: cfg.Dialect(), maxRetries: cfg.MaxRetries, orders: cfg.RecordOrders}
+		},
+		"coalesce": func(cfg *Config) Strategy { return newCoalesceStrategy(cfg) },
+		"dynamodb": func(cfg *Config) Strategy { return newDynamoStrategy(cfg) },
+		"etcd":     func(cfg *Config) Strategy { return newEtcdStrategy(cfg) },
+		"tokens":   func(cfg *Config) Strategy { return newTokenStrategy(cfg) },
+		"buckets": func(cfg *Config) Strategy {
+			return bucketStrategy{numProducts: cfg.NumProducts, numBuckets: cfg.Buckets, stock: cfg.Stock}
+		},
+		"conditional": func(cfg *Config) Strategy {
+			return conditionalStrategy{dialect: cfg.Dialect(), orders: cfg.RecordOrders}
+		},
+		"get-lock": func(cfg *Config) Strategy { return getLockStrategy{orders: cfg.RecordOrders} },
+		"ledger": func(cfg *Config) Strategy {
+			return &ledgerStrategy{dialect: cfg.Dialect(), interval: cfg.FoldInterval}
+		},
+		"mutex":      func(cfg *Config) Strategy { return newMutexStrategy(cfg) },
+		"optimistic": func(cfg *Config) Strategy { return optimisticStrategy{maxRetries: cfg.MaxRetries} },
+		"redis":      func(cfg *Config) Strategy { return newRedisStrategy(cfg, false) },
+		"redis-lua":  func(cfg *Config) Strategy { return newRedisStrategy(cfg, true) },
+		"redis-only": func(cfg *Config) Strategy { return newRedisOnlyStrategy(cfg, false) },
+		"redis-only-lua": func(cfg *Config) Strategy {
+			return newRedisOnlyStrategy(cfg, true)
+		},
+		"oversell": func(cfg *Config) Strategy {
+			return &oversellStrategy{dialect: cfg.Dialect(), interval: cfg.CompensateInterval}
+		},
+		"procedure": func(cfg *Config) Strategy { return procedureStrategy{} },
+		"queue":     func(cfg *Config) Strategy { return newQueueStrategy(cfg) },
+		"returning": func(cfg *Config) Strategy { return returningStrategy{dialect: cfg.Dialect()} },
+		"reserve": func(cfg *Config) Strategy {
+			return &reserveStrategy{dialect: cfg.Dialect(), ttl: cfg.ReservationTTL, abandonRate: cfg.AbandonRate}
+		},
+		"serializer": func(cfg *Config) Strategy {
+			return &serializerStrategy{numProducts: cfg.NumProducts, orders: cfg.RecordOrders}
+		},
+		"tikv": func(cfg *Config) Strategy { return newTiKVStrategy(cfg) },
+		"skip-locked": func(cfg *Config) Strategy {
+			return skipLockedStrategy{
+				dialect:     cfg.Dialect(),
+				numProducts: cfg.NumProducts,
+				stock:       cfg.Stock,
+				orders:      cfg.RecordOrders,
+				maxRetries:  cfg.MaxRetries,
+				backoffBase: cfg.BackoffBase,
+				backoffMax:  cfg.BackoffMax,
+			}
+		},
+	}
+)
+
+// Register makes the strategy that factory constructs available as name to
+// New, and so to -strategy and -compare, typically from the init function of
+// the package that implements it; a Go plugin loaded with -plugin registers
+// its strategies that way too. Like sql.Register, it panics if factory is nil
+// or name is empty or taken.
+func Register(name string, factory Factory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if factory == nil || name == "" {
+		panic("strategy: Register needs a name and a factory")
+	}
+	if _, dup := strategies[name]; dup {
+		panic("strategy: Register called twice for strategy " + name)
+	}
+	strategies[name] = factory
+}
+
+// New returns the strategy registered as name, configured by cfg.
+func New(name string, cfg *Config) (Strategy, error) {
+	strategiesMu.RLock()
+	newS, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q", name)
+	}
+	return newS(cfg), nil
+}
+
+// Names returns the registered strategy names in sorted order.
+func Names() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// round1 rounds f to one decimal for log attributes.
+func round1(f float64) float64 {
+	return math.Round(f*10) / 10
+}
@@ -0,0 +1,145 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tikverr "github.com/tikv/client-go/v2/error"
+	"github.com/tikv/client-go/v2/txnkv"
+)
+
+// tikvStrategy bypasses SQL and keeps the stock of every product under one
+// TiKV key, decremented in optimistic client-go transactions that are retried
+// on write conflicts up to maxRetries times. The products table is left
+// untouched, and the strategy runs with -driver none too; verification reads
+// the keys instead.
+type tikvStrategy struct {
+	pdAddrs     []string
+	numProducts int
+	maxRetries  int
+
+	client *txnkv.Client
+}
+
+func newTiKVStrategy(cfg *Config) *tikvStrategy {
+	return &tikvStrategy{
+		pdAddrs:     strings.Split(cfg.PDAddrs, ","),
+		numProducts: cfg.NumProducts,
+		maxRetries:  cfg.MaxRetries,
+	}
+}
+
+func tikvStockKey(productID int) []byte {
+	return []byte(fmt.Sprintf("hot-product/stock/%d", productID))
+}
+
+// connect connects to the cluster through PD, unless Seed or Start already
+// did.
+func (s *tikvStrategy) connect() error {
+	if s.client != nil {
+		return nil
+	}
+	client, err := txnkv.NewClient(s.pdAddrs)
+	if err != nil {
+		return fmt.Errorf("connect to tikv: %w", err)
+	}
+	s.client = client
+	return nil
+}
+
+// Seed writes the initial stock of every product.
+func (s *tikvStrategy) Seed(ctx context.Context, numProducts int, stock int64) error {
+	if err := s.connect(); err != nil {
+		return err
+	}
+	txn, err := s.client.Begin()
+	if err != nil {
+		return err
+	}
+	value := []byte(strconv.FormatInt(stock, 10))
+	for p := 1; p <= numProducts; p++ {
+		if err := txn.Set(tikvStockKey(p), value); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit(ctx)
+}
+
+// Start connects to the cluster for a run that reuses the stock of an
+// earlier one.
+func (s *tikvStrategy) Start(ctx context.Context, db *sql.DB) error {
+	return s.connect()
+}
+
+func (s *tikvStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	key := tikvStockKey(order.ProductID)
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			NoteRetry(ctx)
+		}
+		err := s.decrement(ctx, key, order.Quantity)
+		if !tikverr.IsErrWriteConflict(err) {
+			return err
+		}
+	}
+	return ErrTooManyRetries
+}
+
+// decrement reads key and takes quantity off it in one optimistic transaction.
+func (s *tikvStrategy) decrement(ctx context.Context, key []byte, quantity int64) error {
+	txn, err := s.client.Begin()
+	if err != nil {
+		return err
+	}
+
+	value, err := txn.Get(ctx, key)
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+	currentStock, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		txn.Rollback()
+		return fmt.Errorf("decode stock %q: %w", value, err)
+	}
+	if currentStock < quantity {
+		txn.Rollback()
+		return ErrSoldOut
+	}
+
+	if err := txn.Set(key, []byte(strconv.FormatInt(currentStock-quantity, 10))); err != nil {
+		txn.Rollback()
+		return err
+	}
+	return txn.Commit(ctx)
+}
+
+// TotalStock sums the stock keys of all products.
+func (s *tikvStrategy) TotalStock(ctx context.Context, db *sql.DB) (int64, error) {
+	if err := s.connect(); err != nil {
+		return 0, err
+	}
+	txn, err := s.client.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer txn.Rollback()
+
+	var total int64
+	for p := 1; p <= s.numProducts; p++ {
+		value, err := txn.Get(ctx, tikvStockKey(p))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("decode stock %q: %w", value, err)
+		}
+		total += n
+	}
+	return total, nil
+}
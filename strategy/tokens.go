@@ -0,0 +1,124 @@
+package strategy
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"update_one_record/schema"
+)
+
+// tokenStrategy lets every worker claim a quota of stock in one transaction
+// and then sell from that local quota without touching the database. Unused
+// tokens are returned to the products table when the run ends.
+type tokenStrategy struct {
+	dialect schema.Dialect
+	quota   int64
+	wallets []tokenWallet // indexed by worker ID
+	db      *sql.DB
+
+	claims atomic.Int64
+	served atomic.Int64
+}
+
+// tokenWallet holds the unsold tokens one worker claimed, per product.
+type tokenWallet struct {
+	mu     sync.Mutex
+	tokens map[int]int64
+}
+
+func newTokenStrategy(cfg *Config) *tokenStrategy {
+	s := &tokenStrategy{dialect: cfg.Dialect(), quota: cfg.TokenQuota, wallets: make([]tokenWallet, cfg.Concurrency+1)}
+	for i := range s.wallets {
+		s.wallets[i].tokens = make(map[int]int64)
+	}
+	return s
+}
+
+func (s *tokenStrategy) Start(ctx context.Context, db *sql.DB) error {
+	s.db = db
+	return nil
+}
+
+// Purchase serves the order from the worker's wallet, first claiming enough
+// tokens to cover it if necessary. Tokens claimed for an order that still
+// cannot be covered stay in the wallet.
+func (s *tokenStrategy) Purchase(ctx context.Context, db *sql.DB, order Order) error {
+	w := &s.wallets[WorkerID(ctx)%len(s.wallets)]
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if have := w.tokens[order.ProductID]; have < order.Quantity {
+		granted, err := s.claim(ctx, db, order.ProductID, max(s.quota, order.Quantity-have))
+		if err != nil {
+			return err
+		}
+		w.tokens[order.ProductID] += granted
+		if w.tokens[order.ProductID] < order.Quantity {
+			return ErrSoldOut
+		}
+	}
+	w.tokens[order.ProductID] -= order.Quantity
+	s.served.Add(1)
+	return nil
+}
+
+// claim takes up to n units of productID off the stock and returns how many
+// it got.
+func (s *tokenStrategy) claim(ctx context.Context, db *sql.DB, productID int, n int64) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var currentStock int64
+	if err := tx.QueryRowContext(ctx, s.dialect.SelectForUpdate("SELECT count FROM products WHERE id = ?", schema.LockWait), productID).Scan(&currentStock); err != nil {
+		return 0, err
+	}
+
+	granted := min(n, max(currentStock, 0))
+	if granted == 0 {
+		return 0, nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE products SET count = count - ? WHERE id = ?", granted, productID); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	s.claims.Add(1)
+	return granted, nil
+}
+
+// Stop returns every unused token to the stock and reports how much stock sat
+// stranded in wallets when the run ended.
+func (s *tokenStrategy) Stop(ctx context.Context) error {
+	var stranded int64
+	for i := range s.wallets {
+		w := &s.wallets[i]
+		w.mu.Lock()
+		for productID, n := range w.tokens {
+			if n == 0 {
+				continue
+			}
+			if _, err := s.db.ExecContext(ctx, "UPDATE products SET count = count + ? WHERE id = ?", n, productID); err != nil {
+				w.mu.Unlock()
+				return err
+			}
+			stranded += n
+			delete(w.tokens, productID)
+		}
+		w.mu.Unlock()
+	}
+
+	claims, served := s.claims.Load(), s.served.Load()
+	var perClaim float64
+	if claims > 0 {
+		perClaim = float64(served) / float64(claims)
+	}
+	slog.Info("Token stats", "purchases", served, "claims", claims, "per_claim", round1(perClaim), "returned", stranded)
+	return nil
+}